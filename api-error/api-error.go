@@ -3,6 +3,8 @@ package apierror
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/rodrwan/fakeproviders/requestid"
 )
 
 // Response ...
@@ -13,12 +15,21 @@ type Response struct {
 
 // Message ...
 type Message struct {
-	Message string `json:"message"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // Write writes a ApplicationResposne to the given response writer encoded as JSON.
+// The request id echoed by requestid.Handle is included in the body.
 func (er *Response) Write(w http.ResponseWriter) error {
-	b, err := json.Marshal(er)
+	resp := *er
+	if er.Error != nil && er.Error.RequestID == "" {
+		msg := *er.Error
+		msg.RequestID = w.Header().Get(requestid.HeaderKey)
+		resp.Error = &msg
+	}
+
+	b, err := json.Marshal(&resp)
 	if err != nil {
 		return err
 	}
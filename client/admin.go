@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ResetState restores the startup state of the server and returns its cards.
+func (c *Client) ResetState(ctx context.Context) ([]*Card, error) {
+	var cards []*Card
+	if err := c.do(ctx, http.MethodPost, "/_admin/reset", adminTokenAuth, nil, &cards); err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+// ClearState drops every card, verification key, TOTP enrollment and
+// scenario of the server.
+func (c *Client) ClearState(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/_admin/clear", adminTokenAuth, nil, nil)
+}
+
+// ImportCards adds cards and their users in bulk.
+func (c *Client) ImportCards(ctx context.Context, cards []*ImportedCard) ([]*Card, error) {
+	in := struct {
+		Cards []*ImportedCard `json:"cards"`
+	}{cards}
+
+	var imported []*Card
+	if err := c.do(ctx, http.MethodPost, "/_admin/import", adminTokenAuth, in, &imported); err != nil {
+		return nil, err
+	}
+	return imported, nil
+}
+
+// SetCard sets the balance or the status of a card directly.
+func (c *Client) SetCard(ctx context.Context, id string, state *CardState) (*Card, error) {
+	card := &Card{}
+	path := "/_admin/cards/" + url.PathEscape(id)
+	if err := c.do(ctx, http.MethodPatch, path, adminTokenAuth, state, card); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// PendingKeys lists the verification keys not used yet.
+func (c *Client) PendingKeys(ctx context.Context) ([]*PendingKey, error) {
+	var keys []*PendingKey
+	if err := c.do(ctx, http.MethodGet, "/_admin/keys", adminTokenAuth, nil, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Snapshot exports the state of the server. The snapshot is opaque, it is
+// meant to be stored and given back to RestoreSnapshot.
+func (c *Client) Snapshot(ctx context.Context) (json.RawMessage, error) {
+	var snapshot json.RawMessage
+	if err := c.do(ctx, http.MethodGet, "/_admin/snapshot", adminTokenAuth, nil, &snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// RestoreSnapshot replaces the state of the server by a snapshot and returns
+// its cards.
+func (c *Client) RestoreSnapshot(ctx context.Context, snapshot json.RawMessage) ([]*Card, error) {
+	var cards []*Card
+	if err := c.do(ctx, http.MethodPut, "/_admin/snapshot", adminTokenAuth, snapshot, &cards); err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+// Clock returns the time of the server clock.
+func (c *Client) Clock(ctx context.Context) (*ClockState, error) {
+	state := &ClockState{}
+	if err := c.do(ctx, http.MethodGet, "/_admin/clock", adminTokenAuth, nil, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// SetClock sets the server clock to now, unless it is zero, and freezes it
+// or lets it run.
+func (c *Client) SetClock(ctx context.Context, now time.Time, frozen bool) (*ClockState, error) {
+	in := struct {
+		Now    *time.Time `json:"now,omitempty"`
+		Frozen bool       `json:"frozen"`
+	}{Frozen: frozen}
+	if !now.IsZero() {
+		in.Now = &now
+	}
+
+	state := &ClockState{}
+	if err := c.do(ctx, http.MethodPut, "/_admin/clock", adminTokenAuth, in, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// AdvanceClock moves the server clock forward by d.
+func (c *Client) AdvanceClock(ctx context.Context, d time.Duration) (*ClockState, error) {
+	in := struct {
+		Duration string `json:"duration"`
+	}{d.String()}
+
+	state := &ClockState{}
+	if err := c.do(ctx, http.MethodPost, "/_admin/clock/advance", adminTokenAuth, in, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Chaos returns the chaos settings of the server.
+func (c *Client) Chaos(ctx context.Context) (*Chaos, error) {
+	chaos := &Chaos{}
+	if err := c.do(ctx, http.MethodGet, "/_admin/chaos", adminTokenAuth, nil, chaos); err != nil {
+		return nil, err
+	}
+	return chaos, nil
+}
+
+// SetChaos replaces the chaos settings of the server.
+func (c *Client) SetChaos(ctx context.Context, chaos *Chaos) (*Chaos, error) {
+	updated := &Chaos{}
+	if err := c.do(ctx, http.MethodPut, "/_admin/chaos", adminTokenAuth, chaos, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// JIT returns the JIT funding settings of the server.
+func (c *Client) JIT(ctx context.Context) (*JIT, error) {
+	jit := &JIT{}
+	if err := c.do(ctx, http.MethodGet, "/_admin/jit", adminTokenAuth, nil, jit); err != nil {
+		return nil, err
+	}
+	return jit, nil
+}
+
+// SetJIT replaces the JIT funding settings of the server, an empty URL
+// disables the JIT mode.
+func (c *Client) SetJIT(ctx context.Context, jit *JIT) (*JIT, error) {
+	updated := &JIT{}
+	if err := c.do(ctx, http.MethodPut, "/_admin/jit", adminTokenAuth, jit, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// RateLimits returns the rate limit policies of the server.
+func (c *Client) RateLimits(ctx context.Context) ([]*RateLimitPolicy, error) {
+	var policies []*RateLimitPolicy
+	if err := c.do(ctx, http.MethodGet, "/_admin/rate-limits", adminTokenAuth, nil, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// SetRateLimits replaces the rate limit policies of the server, every
+// counter starts over.
+func (c *Client) SetRateLimits(ctx context.Context, policies []*RateLimitPolicy) ([]*RateLimitPolicy, error) {
+	in := struct {
+		Policies []*RateLimitPolicy `json:"policies"`
+	}{policies}
+
+	var updated []*RateLimitPolicy
+	if err := c.do(ctx, http.MethodPut, "/_admin/rate-limits", adminTokenAuth, in, &updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// LoadScenarios loads scripted response scenarios. file is encoded as JSON,
+// it can be a fakeprovider.ScenarioFile or any value of the same shape.
+func (c *Client) LoadScenarios(ctx context.Context, file interface{}) ([]*ScenarioReport, error) {
+	var reports []*ScenarioReport
+	if err := c.do(ctx, http.MethodPost, "/_admin/scenarios", adminTokenAuth, file, &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// Scenarios reports the progress of the loaded scenarios.
+func (c *Client) Scenarios(ctx context.Context) ([]*ScenarioReport, error) {
+	var reports []*ScenarioReport
+	if err := c.do(ctx, http.MethodGet, "/_admin/scenarios", adminTokenAuth, nil, &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// ClearScenarios unloads every scenario.
+func (c *Client) ClearScenarios(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/_admin/scenarios", adminTokenAuth, nil, nil)
+}
+
+// Tenants lists the tenants created so far.
+func (c *Client) Tenants(ctx context.Context) ([]*Tenant, error) {
+	var tenants []*Tenant
+	if err := c.do(ctx, http.MethodGet, "/_admin/tenants", adminTokenAuth, nil, &tenants); err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// DeleteTenant drops a tenant and its whole state, it is created again with
+// the startup state by its next request.
+func (c *Client) DeleteTenant(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/_admin/tenants/"+url.PathEscape(id), adminTokenAuth, nil, nil)
+}
@@ -0,0 +1,556 @@
+// Package client is a typed Go client of the fake provider API.
+//
+// Responses are decoded from the {"data": ...} envelope and error bodies are
+// returned as *Error. Requests answered with a 429 are retried honouring the
+// Retry-After header, and so are the GET, PUT and DELETE requests answered
+// with a 5xx, which the fake provider returns at random. POST and PATCH
+// requests carry an Idempotency-Key that is kept across the retries of a
+// call, the server doesn't deduplicate them by it.
+//
+//	c, err := client.New("http://localhost:8080", client.WithAPIToken("token"))
+//	card, err := c.CreateCard(ctx, &client.User{
+//		FirstName: "lala",
+//		LastName:  "lalo",
+//		Email:     "lala@example.org",
+//	})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader      = "X-Request-ID"
+	idempotencyKeyHeader = "Idempotency-Key"
+	tenantHeader         = "X-Tenant-ID"
+
+	// DefaultMaxRetries is the default number of retries of a call.
+	DefaultMaxRetries = 3
+	// DefaultMinBackoff is the default wait before the first retry when the
+	// server doesn't say how long to wait.
+	DefaultMinBackoff = 500 * time.Millisecond
+	// DefaultMaxBackoff is the default maximum wait between retries.
+	DefaultMaxBackoff = 15 * time.Second
+)
+
+// Client is a client of the fake provider API. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	apiToken   string
+	adminToken string
+	tenant     string
+
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu           sync.RWMutex
+	sessionToken string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client used to send the requests.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithAPIToken sets the token of the routes protected by the -token flag of
+// the server.
+func WithAPIToken(token string) Option {
+	return func(c *Client) {
+		c.apiToken = token
+	}
+}
+
+// WithAdminToken sets the token of the /_admin routes, when it differs from
+// the API token.
+func WithAdminToken(token string) Option {
+	return func(c *Client) {
+		c.adminToken = token
+	}
+}
+
+// WithSessionToken sets the cardholder session token, usually obtained with
+// Login.
+func WithSessionToken(token string) Option {
+	return func(c *Client) {
+		c.sessionToken = token
+	}
+}
+
+// WithTenant selects the tenant of every request, the server uses its
+// default tenant otherwise. It isn't needed with a tenant API token. The
+// card routes of a tenant other than the default one need WithAPIToken.
+func WithTenant(id string) Option {
+	return func(c *Client) {
+		c.tenant = id
+	}
+}
+
+// WithRetries sets the maximum number of retries of a call, zero disables
+// them.
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		c.maxRetries = n
+	}
+}
+
+// WithBackoff sets the bounds of the exponential backoff used between
+// retries when the server doesn't send a Retry-After header.
+func WithBackoff(min, max time.Duration) Option {
+	return func(c *Client) {
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+// New creates a new Client for the server listening at baseURL.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		maxRetries: DefaultMaxRetries,
+		minBackoff: DefaultMinBackoff,
+		maxBackoff: DefaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// SessionToken returns the current cardholder session token.
+func (c *Client) SessionToken() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.sessionToken
+}
+
+// SetSessionToken replaces the cardholder session token.
+func (c *Client) SetSessionToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sessionToken = token
+}
+
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey returns a copy of ctx making the calls done with it use
+// the given idempotency key instead of a generated one. It lets callers keep
+// the key across their own retries.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// auth selects the credentials sent with a request.
+type auth int
+
+const (
+	noAuth auth = iota
+	// publicAuth sends the API token when set, the public card routes need
+	// it to serve a tenant selected with WithTenant.
+	publicAuth
+	apiTokenAuth
+	sessionAuth
+	adminTokenAuth
+)
+
+// do sends the request, retrying it when needed, and decodes the data of the
+// response envelope into out.
+func (c *Client) do(ctx context.Context, method, path string, a auth, in, out interface{}) error {
+	if out == nil {
+		return c.doEnvelope(ctx, method, path, a, in, nil)
+	}
+	return c.doEnvelope(ctx, method, path, a, in, &envelope{Data: out})
+}
+
+// doEnvelope is do decoding the whole response envelope, meta included.
+func (c *Client) doEnvelope(ctx context.Context, method, path string, a auth, in interface{}, out *envelope) error {
+	var body []byte
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+
+	idempotencyKey := ""
+	if method == http.MethodPost || method == http.MethodPatch {
+		idempotencyKey, _ = ctx.Value(idempotencyKeyContextKey{}).(string)
+		if idempotencyKey == "" {
+			idempotencyKey = uuid.New().String()
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := c.newRequest(ctx, method, path, a, body)
+		if err != nil {
+			return err
+		}
+		if idempotencyKey != "" {
+			req.Header.Set(idempotencyKeyHeader, idempotencyKey)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			if method == http.MethodGet && attempt < c.maxRetries && ctx.Err() == nil {
+				if err := c.wait(ctx, c.backoff(attempt)); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			if out == nil {
+				return nil
+			}
+			return json.Unmarshal(respBody, out)
+		}
+
+		if retryable(method, resp.StatusCode) && attempt < c.maxRetries {
+			if err := c.wait(ctx, c.retryAfter(resp, attempt)); err != nil {
+				return err
+			}
+			continue
+		}
+		return newError(resp, respBody)
+	}
+}
+
+type envelope struct {
+	Data interface{} `json:"data"`
+	Meta interface{} `json:"meta"`
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, a auth, body []byte) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL.String()+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.tenant != "" {
+		req.Header.Set(tenantHeader, c.tenant)
+	}
+
+	switch a {
+	case publicAuth:
+		if c.apiToken != "" {
+			req.Header.Set("Authorization", "Bearer "+c.apiToken)
+		}
+	case apiTokenAuth:
+		req.Header.Set("Authorization", "Bearer "+c.apiToken)
+	case sessionAuth:
+		req.Header.Set("Authorization", "Bearer "+c.SessionToken())
+	case adminTokenAuth:
+		token := c.adminToken
+		if token == "" {
+			token = c.apiToken
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// retryable reports whether a response to method is retried. The server
+// doesn't deduplicate the requests by Idempotency-Key, so the 5xx are only
+// retried for the idempotent methods. The 429s are answered before the
+// request is handled.
+func retryable(method string, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return method != http.MethodPost && method != http.MethodPatch
+	}
+	return false
+}
+
+// retryAfter returns how long to wait before retrying, honouring the
+// Retry-After header, then the reset time of the rate limit, falling back to
+// the exponential backoff.
+func (c *Client) retryAfter(resp *http.Response, attempt int) time.Duration {
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			return time.Duration(secs) * time.Second
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return time.Until(t)
+		}
+	}
+
+	if v := resp.Header.Get("RateLimit-Reset"); v != "" && resp.StatusCode == http.StatusTooManyRequests {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+
+	return c.backoff(attempt)
+}
+
+// backoff returns the exponential backoff of the given attempt with full
+// jitter.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.minBackoff << uint(attempt)
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d)/2+1)) + d/2
+}
+
+func (c *Client) wait(ctx context.Context, d time.Duration) error {
+	if d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// ListCards returns every card.
+func (c *Client) ListCards(ctx context.Context) ([]*Card, error) {
+	var cards []*Card
+	params := &ListCardsParams{Limit: maxPageSize}
+	for {
+		page, err := c.ListCardsPage(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, page.Cards...)
+		if !page.HasMore || len(page.Cards) == 0 {
+			return cards, nil
+		}
+		params.StartingAfter = page.Cards[len(page.Cards)-1].ID
+	}
+}
+
+// maxPageSize is the largest page of cards the server returns.
+const maxPageSize = 1000
+
+// ListCardsPage returns a page of the cards matching params, nil params
+// returns the first page of every card.
+func (c *Client) ListCardsPage(ctx context.Context, params *ListCardsParams) (*CardPage, error) {
+	path := "/"
+	if params != nil {
+		if q := params.query().Encode(); q != "" {
+			path += "?" + q
+		}
+	}
+
+	page := &CardPage{}
+	if err := c.doEnvelope(ctx, http.MethodGet, path, publicAuth, nil, &envelope{Data: &page.Cards, Meta: &page.ListMeta}); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// CreateCard issues a card to a new cardholder.
+func (c *Client) CreateCard(ctx context.Context, u *User) (*Card, error) {
+	card := &Card{}
+	if err := c.do(ctx, http.MethodPost, "/cards", publicAuth, u, card); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// GetCard returns a card, deleted ones included.
+func (c *Client) GetCard(ctx context.Context, id string) (*Card, error) {
+	card := &Card{}
+	path := fmt.Sprintf("/cards/%s", url.PathEscape(id))
+	if err := c.do(ctx, http.MethodGet, path, publicAuth, nil, card); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// FindCardByReference returns the card with the given reference id, deleted
+// cards excluded. IsNotFound reports the error returned when there is none.
+func (c *Client) FindCardByReference(ctx context.Context, referenceID string) (*Card, error) {
+	page, err := c.ListCardsPage(ctx, &ListCardsParams{ReferenceID: referenceID, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Cards) == 0 {
+		return nil, &Error{StatusCode: http.StatusNotFound, Message: "no card with reference id " + referenceID}
+	}
+	return page.Cards[0], nil
+}
+
+// DeleteCard soft deletes a card, it requires the API token.
+func (c *Client) DeleteCard(ctx context.Context, id string) (*Card, error) {
+	card := &Card{}
+	path := fmt.Sprintf("/cards/%s", url.PathEscape(id))
+	if err := c.do(ctx, http.MethodDelete, path, apiTokenAuth, nil, card); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// Load adds amount to the balance of the card with the given reference id.
+func (c *Client) Load(ctx context.Context, referenceID string, amount int64) (*Card, error) {
+	in := struct {
+		ReferenceID string `json:"reference_id"`
+		Amount      int64  `json:"amount"`
+	}{referenceID, amount}
+
+	card := &Card{}
+	if err := c.do(ctx, http.MethodPost, "/load", publicAuth, in, card); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// PatchCardInfo overwrites the public details of a card, it requires the API
+// token.
+func (c *Client) PatchCardInfo(ctx context.Context, id string, info *CardInfo) (*Card, error) {
+	card := &Card{}
+	path := fmt.Sprintf("/cards/%s/info", url.PathEscape(id))
+	if err := c.do(ctx, http.MethodPatch, path, apiTokenAuth, info, card); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// RotateKeys makes a new key-encryption key the primary one, it requires the
+// admin token. A random key is generated when keyID and key are empty.
+func (c *Client) RotateKeys(ctx context.Context, keyID string, key []byte) (*KeyRotation, error) {
+	in := struct {
+		KeyID string `json:"key_id,omitempty"`
+		Key   []byte `json:"key,omitempty"`
+	}{keyID, key}
+
+	rotation := &KeyRotation{}
+	if err := c.do(ctx, http.MethodPost, "/_admin/kek/rotate", adminTokenAuth, in, rotation); err != nil {
+		return nil, err
+	}
+	return rotation, nil
+}
+
+// RemoveKey drops a key-encryption key no card is sealed with anymore, it
+// requires the admin token.
+func (c *Client) RemoveKey(ctx context.Context, keyID string) error {
+	path := fmt.Sprintf("/_admin/kek/%s", url.PathEscape(keyID))
+	return c.do(ctx, http.MethodDelete, path, adminTokenAuth, nil, nil)
+}
+
+// Login creates a cardholder session and keeps its token for the calls
+// requiring it. totpCode is only required once an authenticator app was
+// enrolled.
+func (c *Client) Login(ctx context.Context, username, password, totpCode string) (string, error) {
+	in := struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		TOTPCode string `json:"totp_code,omitempty"`
+	}{username, password, totpCode}
+
+	var token string
+	if err := c.do(ctx, http.MethodPost, "/login", noAuth, in, &token); err != nil {
+		return "", err
+	}
+	c.SetSessionToken(token)
+	return token, nil
+}
+
+// Me returns the card of the session cardholder.
+func (c *Client) Me(ctx context.Context) (*Card, error) {
+	card := &Card{}
+	if err := c.do(ctx, http.MethodGet, "/api/me", sessionAuth, nil, card); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// Verify creates a verification key required by RevealCard, it is valid for
+// 30 seconds.
+func (c *Client) Verify(ctx context.Context) (string, error) {
+	var key string
+	if err := c.do(ctx, http.MethodPost, "/api/me/verify", sessionAuth, nil, &key); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// RevealCard returns the sensitive details of the session cardholder card.
+func (c *Client) RevealCard(ctx context.Context, r *RevealRequest) (*RevealedCard, error) {
+	card := &RevealedCard{}
+	if err := c.do(ctx, http.MethodPost, "/api/me/card", sessionAuth, r, card); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// EnrollTOTP creates a new authenticator app secret, it must be confirmed
+// with ConfirmTOTP before being used. totpCode is only required to replace a
+// confirmed enrollment, whose secret is used until the new one is confirmed.
+func (c *Client) EnrollTOTP(ctx context.Context, totpCode string) (*TOTPEnrollment, error) {
+	in := struct {
+		TOTPCode string `json:"totp_code,omitempty"`
+	}{totpCode}
+	enrollment := &TOTPEnrollment{}
+	if err := c.do(ctx, http.MethodPost, "/api/me/totp", sessionAuth, in, enrollment); err != nil {
+		return nil, err
+	}
+	return enrollment, nil
+}
+
+// ConfirmTOTP confirms the authenticator app enrollment with a first code.
+func (c *Client) ConfirmTOTP(ctx context.Context, code string) error {
+	in := struct {
+		TOTPCode string `json:"totp_code"`
+	}{code}
+	return c.do(ctx, http.MethodPost, "/api/me/totp/confirm", sessionAuth, in, nil)
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error is returned when the server answers with a non 2xx status.
+type Error struct {
+	StatusCode int
+	Message    string
+	RequestID  string
+}
+
+func (e *Error) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("fakeprovider: %d %s (request id %s)", e.StatusCode, e.Message, e.RequestID)
+	}
+	return fmt.Sprintf("fakeprovider: %d %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 returned by the server.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized reports whether err is a 401 returned by the server.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsRateLimited reports whether err is a 429 returned by the server.
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
+
+// IsBadRequest reports whether err is a 400 returned by the server.
+func IsBadRequest(err error) bool {
+	return hasStatus(err, http.StatusBadRequest)
+}
+
+func hasStatus(err error, status int) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == status
+}
+
+// newError decodes an error body. The server answers either an apierror body
+// {"error": {"message", "request_id"}}, a {"message", "request_id"} body for
+// the API token middleware or a plain text body.
+func newError(resp *http.Response, body []byte) *Error {
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get(requestIDHeader),
+	}
+
+	var payload struct {
+		Error *struct {
+			Message   string `json:"message"`
+			RequestID string `json:"request_id"`
+		} `json:"error"`
+		Message   string `json:"message"`
+		RequestID string `json:"request_id"`
+	}
+	switch {
+	case json.Unmarshal(body, &payload) != nil:
+		e.Message = strings.TrimSpace(string(body))
+	case payload.Error != nil:
+		e.Message = payload.Error.Message
+		if payload.Error.RequestID != "" {
+			e.RequestID = payload.Error.RequestID
+		}
+	default:
+		e.Message = payload.Message
+		if payload.RequestID != "" {
+			e.RequestID = payload.RequestID
+		}
+	}
+
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
@@ -0,0 +1,227 @@
+package client
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// User is a cardholder.
+type User struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+}
+
+// Card is the public representation of a card, sensitive values are masked.
+type Card struct {
+	ID          string    `json:"id,omitempty"`
+	NameOnCard  string    `json:"name_on_card,omitempty"`
+	PAN         string    `json:"pan,omitempty"`
+	ReferenceID string    `json:"reference_id,omitempty"`
+	ExpDate     string    `json:"exp_date,omitempty"`
+	CVV         string    `json:"cvv,omitempty"`
+	Balance     int64     `json:"balance,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	User        *User     `json:"user,omitempty"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+	// DeletedAt is set on deleted cards.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// CardInfo holds the values set by PatchCardInfo.
+type CardInfo struct {
+	CardNumber  string `json:"card_number"`
+	ExpDate     string `json:"exp_date"`
+	CVV         string `json:"cvv"`
+	ReferenceID string `json:"reference_id"`
+}
+
+// RevealRequest holds the second factor required to reveal a card, either a
+// verification token or a TOTP code.
+type RevealRequest struct {
+	VerificationToken string `json:"verification_token,omitempty"`
+	TOTPCode          string `json:"totp_code,omitempty"`
+	// PublicKey is an optional public JWK, when set the details are returned
+	// encrypted to it in RevealedCard.JWE.
+	PublicKey json.RawMessage `json:"public_key,omitempty"`
+}
+
+// RevealedCard holds the sensitive details of a card. Only JWE is set when
+// the card was revealed with a public key.
+type RevealedCard struct {
+	NameOnCard string `json:"name_on_card,omitempty"`
+	CardNumber string `json:"card_number,omitempty"`
+	ExpiryDate string `json:"expiry_date,omitempty"`
+	CVV        string `json:"cvv,omitempty"`
+	JWE        string `json:"jwe,omitempty"`
+}
+
+// TOTPEnrollment holds the secret of an authenticator app enrollment.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// ImportedCard is a card added by ImportCards, empty fields are generated by
+// the server.
+type ImportedCard struct {
+	ID          string `json:"id,omitempty"`
+	ReferenceID string `json:"reference_id,omitempty"`
+	CardNumber  string `json:"card_number,omitempty"`
+	ExpDate     string `json:"exp_date,omitempty"`
+	CVV         string `json:"cvv,omitempty"`
+	Balance     int64  `json:"balance,omitempty"`
+	Status      string `json:"status,omitempty"`
+	User        *User  `json:"user"`
+}
+
+// CardState holds the values set by SetCard, nil fields are left unchanged.
+type CardState struct {
+	Balance *int64  `json:"balance,omitempty"`
+	Status  *string `json:"status,omitempty"`
+}
+
+// ListCardsParams selects a page of cards, zero fields are left to the
+// server defaults.
+type ListCardsParams struct {
+	Limit int
+	// StartingAfter is the id of the last card of the previous page.
+	StartingAfter string
+	// Sort is created_at or balance, prefixed by - for descending order.
+	Sort        string
+	Email       string
+	Status      []string
+	ReferenceID string
+	CreatedGTE  time.Time
+	CreatedLTE  time.Time
+}
+
+func (p *ListCardsParams) query() url.Values {
+	q := url.Values{}
+	if p.Limit > 0 {
+		q.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.StartingAfter != "" {
+		q.Set("starting_after", p.StartingAfter)
+	}
+	if p.Sort != "" {
+		q.Set("sort", p.Sort)
+	}
+	if p.Email != "" {
+		q.Set("email", p.Email)
+	}
+	if len(p.Status) > 0 {
+		q.Set("status", strings.Join(p.Status, ","))
+	}
+	if p.ReferenceID != "" {
+		q.Set("reference_id", p.ReferenceID)
+	}
+	if !p.CreatedGTE.IsZero() {
+		q.Set("created_gte", p.CreatedGTE.Format(time.RFC3339))
+	}
+	if !p.CreatedLTE.IsZero() {
+		q.Set("created_lte", p.CreatedLTE.Format(time.RFC3339))
+	}
+	return q
+}
+
+// CardPage is a page of the card listing.
+type CardPage struct {
+	Cards []*Card
+	ListMeta
+}
+
+// ListMeta describes a page of the card listing.
+type ListMeta struct {
+	HasMore       bool       `json:"has_more"`
+	Limit         int        `json:"limit"`
+	StartingAfter string     `json:"starting_after,omitempty"`
+	Sort          string     `json:"sort"`
+	Filters       CardFilter `json:"filters"`
+	// Total is the number of cards matching the filters.
+	Total int `json:"total"`
+}
+
+// CardFilter are the filters applied to a page of cards.
+type CardFilter struct {
+	Email       string     `json:"email,omitempty"`
+	Status      []string   `json:"status,omitempty"`
+	ReferenceID string     `json:"reference_id,omitempty"`
+	CreatedGTE  *time.Time `json:"created_gte,omitempty"`
+	CreatedLTE  *time.Time `json:"created_lte,omitempty"`
+}
+
+// PendingKey is a verification key returned by Verify and not used yet.
+type PendingKey struct {
+	UserID    string    `json:"user_id"`
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ClockState is the time of the server clock.
+type ClockState struct {
+	Now    time.Time `json:"now"`
+	Frozen bool      `json:"frozen"`
+}
+
+// Tenant is a partition of the server state.
+type Tenant struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Cards     int       `json:"cards"`
+}
+
+// Delay is a range of simulated processing times, written as durations
+// such as "2s".
+type Delay struct {
+	Min string `json:"min"`
+	Max string `json:"max"`
+}
+
+// Chaos holds the faults and delays injected by the server.
+type Chaos struct {
+	ErrorRate   float64 `json:"error_rate"`
+	CreateDelay Delay   `json:"create_delay"`
+	LoadDelay   Delay   `json:"load_delay"`
+}
+
+// JIT configures the JIT funding mode: the authorizations are decided by a
+// POST to URL, which answers {"approved": true} or {"approved": false}
+// within Timeout, a duration such as "2s". Default, approve or decline, is
+// applied when it doesn't.
+type JIT struct {
+	URL     string `json:"url"`
+	Timeout string `json:"timeout,omitempty"`
+	Default string `json:"default,omitempty"`
+	Secret  string `json:"secret,omitempty"`
+}
+
+// RateLimitPolicy allows Limit requests per Period, a duration such as
+// "24h", to some routes, counted per ip, api_key, tenant or session.
+type RateLimitPolicy struct {
+	Name   string   `json:"name"`
+	Routes []string `json:"routes,omitempty"`
+	Key    string   `json:"key,omitempty"`
+	Limit  int64    `json:"limit"`
+	Period string   `json:"period"`
+}
+
+// ScenarioReport tells how far a loaded scenario went.
+type ScenarioReport struct {
+	Name     string `json:"name"`
+	Route    string `json:"route"`
+	Steps    int    `json:"steps"`
+	Consumed int    `json:"consumed"`
+	Rounds   int    `json:"rounds"`
+	Done     bool   `json:"done"`
+}
+
+// KeyRotation is the result of RotateKeys.
+type KeyRotation struct {
+	KeyID     string `json:"key_id"`
+	Rewrapped int    `json:"rewrapped"`
+}
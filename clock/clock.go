@@ -0,0 +1,192 @@
+// Package clock provides the time source of the fake provider.
+//
+// Real follows the system clock. Virtual starts at a given time and can be
+// frozen, set or advanced; its timers fire when the virtual time reaches
+// their deadline, either because time flows or because it was moved forward.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and schedules functions.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine once d has elapsed.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a function scheduled by Clock.AfterFunc.
+type Timer interface {
+	// Stop prevents the function from being called, it returns false when
+	// it was already called or stopped.
+	Stop() bool
+}
+
+// Real is the system clock.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// Virtual is a controllable clock. It is safe for concurrent use.
+type Virtual struct {
+	mu sync.Mutex
+	// offset is the difference with the system clock while running, at the
+	// time while frozen.
+	offset time.Duration
+	frozen bool
+	at     time.Time
+
+	timers []*virtualTimer
+	// wake fires when the earliest timer is due while the clock runs.
+	wake *time.Timer
+}
+
+// NewVirtual returns a running Virtual clock set to t.
+func NewVirtual(t time.Time) *Virtual {
+	return &Virtual{offset: t.Sub(time.Now())}
+}
+
+// Now returns the virtual time.
+func (c *Virtual) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nowLocked()
+}
+
+func (c *Virtual) nowLocked() time.Time {
+	if c.frozen {
+		return c.at
+	}
+	return time.Now().Add(c.offset)
+}
+
+// Frozen reports whether the clock is frozen.
+func (c *Virtual) Frozen() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.frozen
+}
+
+// Freeze stops the time, only Set and Advance change it until Resume.
+func (c *Virtual) Freeze() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.frozen {
+		c.at = c.nowLocked()
+		c.frozen = true
+	}
+	c.scheduleLocked()
+}
+
+// Resume lets the time flow again from where it was frozen.
+func (c *Virtual) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.frozen {
+		c.offset = c.at.Sub(time.Now())
+		c.frozen = false
+	}
+	c.scheduleLocked()
+}
+
+// Set moves the clock to t, firing the timers due by then.
+func (c *Virtual) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setLocked(t)
+}
+
+// Advance moves the clock forward by d, firing the timers due by then.
+func (c *Virtual) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setLocked(c.nowLocked().Add(d))
+}
+
+func (c *Virtual) setLocked(t time.Time) {
+	if c.frozen {
+		c.at = t
+	} else {
+		c.offset = t.Sub(time.Now())
+	}
+	c.scheduleLocked()
+}
+
+type virtualTimer struct {
+	c        *Virtual
+	deadline time.Time
+	f        func()
+}
+
+// AfterFunc calls f once the virtual time reached Now() + d.
+func (c *Virtual) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &virtualTimer{c: c, deadline: c.nowLocked().Add(d), f: f}
+	c.timers = append(c.timers, t)
+	c.scheduleLocked()
+	return t
+}
+
+func (t *virtualTimer) Stop() bool {
+	c := t.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			c.scheduleLocked()
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleLocked fires the due timers and, while running, arranges to be
+// called again when the next one is due.
+func (c *Virtual) scheduleLocked() {
+	now := c.nowLocked()
+
+	var next time.Time
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if !t.deadline.After(now) {
+			go t.f()
+			continue
+		}
+		pending = append(pending, t)
+		if next.IsZero() || t.deadline.Before(next) {
+			next = t.deadline
+		}
+	}
+	// clear the tail so fired timers can be collected.
+	for i := len(pending); i < len(c.timers); i++ {
+		c.timers[i] = nil
+	}
+	c.timers = pending
+
+	if c.wake != nil {
+		c.wake.Stop()
+		c.wake = nil
+	}
+	if c.frozen || next.IsZero() {
+		return
+	}
+	c.wake = time.AfterFunc(next.Sub(now), func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.scheduleLocked()
+	})
+}
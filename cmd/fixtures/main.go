@@ -0,0 +1,107 @@
+// Command fixtures generates synthetic cardholders, either as JSON or as a
+// state snapshot the server restores with -state-file.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/clock"
+	"github.com/rodrwan/fakeproviders/fakeprovider"
+	"github.com/rodrwan/fakeproviders/fixtures"
+	"github.com/rodrwan/fakeproviders/vault"
+)
+
+// Output formats.
+const (
+	formatJSON     = "json"
+	formatSnapshot = "snapshot"
+)
+
+var (
+	count        = flag.Int("n", 100, "Number of cardholders")
+	locale       = flag.String("locale", fixtures.DefaultLocale, "Locale of the names, one of "+strings.Join(fixtures.Locales(), ", "))
+	seed         = flag.Int64("seed", 1, "Seed of the generator, the same seed and -now always generate the same cardholders")
+	now          = flag.String("now", "", "RFC 3339 time the card ages are relative to, defaults to the system time")
+	transactions = flag.Int("transactions", 0, "Maximum number of transactions per card, 0 generates no history")
+	format       = flag.String("format", formatJSON, "Output format: json lists the cardholders, snapshot is a server state for -state-file")
+	kek          = flag.String("kek", "", "Comma separated id:base64 key-encryption keys sealing the snapshot, the server needs the same -kek")
+	output       = flag.String("o", "", "Output file, defaults to the standard output")
+)
+
+func main() {
+	flag.Parse()
+
+	at := time.Now()
+	if *now != "" {
+		var err error
+		if at, err = time.Parse(time.RFC3339, *now); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	cardholders, err := fixtures.Generate(fixtures.Options{
+		Count:           *count,
+		Locale:          *locale,
+		Seed:            *seed,
+		Now:             at,
+		MaxTransactions: *transactions,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch *format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(cardholders)
+	case formatSnapshot:
+		err = writeSnapshot(w, cardholders, at)
+	default:
+		err = fmt.Errorf("invalid format %q", *format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeSnapshot writes the state of a server seeded with cardholders.
+func writeSnapshot(w io.Writer, cardholders []fakeprovider.Cardholder, at time.Time) error {
+	if *kek == "" {
+		return fmt.Errorf("the snapshot format needs -kek")
+	}
+	keyring, err := vault.ParseKeyring(*kek)
+	if err != nil {
+		return err
+	}
+
+	clk := clock.NewVirtual(at)
+	clk.Freeze()
+	server, err := fakeprovider.New(fakeprovider.Options{
+		Seed:    cardholders,
+		Clock:   clk,
+		Keyring: keyring,
+	})
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+	return server.WriteSnapshot(w)
+}
@@ -1,299 +1,463 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/rodrwan/fakeproviders/clock"
+	"github.com/rodrwan/fakeproviders/fakeprovider"
+	"github.com/rodrwan/fakeproviders/fixtures"
+	"github.com/rodrwan/fakeproviders/iso8583"
 	"github.com/rodrwan/fakeproviders/logger"
-
-	"github.com/ulule/limiter/drivers/middleware/stdlib"
-
-	"github.com/google/uuid"
-	apierror "github.com/rodrwan/fakeproviders/api-error"
-	corsLib "github.com/rs/cors"
-	"github.com/ulule/limiter"
-	"github.com/ulule/limiter/drivers/store/memory"
+	"github.com/rodrwan/fakeproviders/replay"
+	"github.com/rodrwan/fakeproviders/requestid"
+	"github.com/rodrwan/fakeproviders/tracing"
+	"github.com/rodrwan/fakeproviders/vault"
+	"github.com/sirupsen/logrus"
 )
 
+// Modes of the server.
 const (
-	minCreateProcessTime = 2
-	maxCreateProcessTime = 10
-	minLoadProcessTime   = 2
-	maxLoadProcessTime   = 10
+	modeFake   = "fake"
+	modeRecord = "record"
+	modeReplay = "replay"
 )
 
 var (
 	port  = flag.String("port", "8080", "Service port")
-	token = flag.String("token", "fasdfadfa9fj987afsdf", "Token for authenticated endpointds")
+	mode  = flag.String("mode", modeFake, "Server mode: fake serves the fake API, record proxies to -target recording to -cassette, replay serves -cassette")
+	token = flag.String("token", fakeprovider.DefaultAPIToken, "Token for authenticated endpointds")
+
+	adminToken = flag.String("admin-token", "", "Token for the /_admin endpoints, defaults to -token")
+	adminPort  = flag.String("admin-port", "", "Serve the /_admin endpoints on this port only, instead of the service port")
+
+	personalities = flag.String("personalities", fakeprovider.DefaultPersonality, "Comma separated APIs served on the service port, among "+strings.Join(fakeprovider.Personalities(), ", "))
+	listen        = flag.String("listen", "", "Comma separated port=personality+personality listeners serving other APIs on the same state, e.g. 8081=fakeprovider")
+
+	target   = flag.String("target", "", "URL of the provider proxied in record mode")
+	cassette = flag.String("cassette", "cassette.jsonl", "File the exchanges are recorded to and replayed from")
+
+	kek       = flag.String("kek", "", "Comma separated id:base64 key-encryption keys for card data, the first one is the primary key")
+	stateFile = flag.String("state-file", "", "Snapshot the state is restored from at startup, when it exists, and saved to at shutdown, needs -kek")
+
+	fixtureCount        = flag.Int("fixtures", 0, "Seed this many generated cardholders instead of the default ones")
+	fixtureLocale       = flag.String("fixtures-locale", fixtures.DefaultLocale, "Locale of the generated cardholders, one of "+strings.Join(fixtures.Locales(), ", "))
+	fixtureSeed         = flag.Int64("fixtures-seed", 1, "Seed of the cardholder generator")
+	fixtureTransactions = flag.Int("fixtures-transactions", 0, "Maximum number of transactions of each generated card")
+
+	errorRate   = flag.Float64("error-rate", fakeprovider.DefaultChaos().ErrorRate, "Probability of POST /cards failing with a 500")
+	createDelay = flag.String("create-delay", "2s-10s", "Range of the simulated processing time of POST /cards")
+	loadDelay   = flag.String("load-delay", "2s-10s", "Range of the simulated processing time of POST /load")
+	scenarios   = flag.String("scenarios", "", "YAML or JSON file scripting the responses of some routes")
+	rateLimits  = flag.String("rate-limits", "", "YAML or JSON file of rate limit policies, replacing the default limit of 2 requests per 10s per IP")
+
+	jitURL     = flag.String("jit-url", "", "Endpoint deciding the authorizations synchronously, enables the JIT funding mode")
+	jitTimeout = flag.Duration("jit-timeout", fakeprovider.DefaultJITTimeout, "Time an authorization waits for the JIT endpoint")
+	jitDefault = flag.String("jit-default", fakeprovider.JITDecline, "Decision when the JIT endpoint times out or fails, approve or decline")
+	jitSecret  = flag.String("jit-secret", "", "Secret signing the requests to the JIT endpoint")
+
+	iso8583Port     = flag.String("iso8583-port", "", "Port of a TCP listener answering ISO 8583 authorizations, financial requests and reversals")
+	iso8583Spec     = flag.String("iso8583-spec", "", "YAML or JSON file of ISO 8583 fields replacing or adding to the default spec")
+	iso8583Tenant   = flag.String("iso8583-tenant", fakeprovider.DefaultTenant, "Tenant whose cards the ISO 8583 requests are about")
+	iso8583CVVField = flag.Int("iso8583-cvv-field", fakeprovider.DefaultISO8583CVVField, "ISO 8583 field carrying the CVV")
+
+	logLevel       = flag.String("log-level", "info", "Minimum level of the logged entries")
+	logFormat      = flag.String("log-format", logger.FormatJSON, "Log format, json or text")
+	trustedProxies = flag.String("trusted-proxies", "", "Comma separated IPs or CIDR ranges of proxies whose forwarding headers are trusted by the logs and the rate limits")
+	logBodies      = flag.Bool("log-bodies", false, "Log request headers and request and response bodies")
+	logBodyLimit   = flag.Int("log-body-limit", logger.DefaultBodyLimit, "Maximum number of body bytes logged")
+	redactFields   = flag.String("redact-fields", "", "Comma separated body fields or JSON paths masked in logs, in addition to the defaults")
+	redactHeaders  = flag.String("redact-headers", "", "Comma separated headers masked in logs, in addition to the defaults")
+
+	traceExporter = flag.String("trace-exporter", tracing.ExporterNone, "Trace exporter, none, stdout or otlp")
+	otlpEndpoint  = flag.String("otlp-endpoint", "localhost:4318", "OTLP/HTTP collector endpoint used by the otlp trace exporter")
+	otlpInsecure  = flag.Bool("otlp-insecure", true, "Disable TLS when exporting traces to the OTLP collector")
+
+	validateRequests  = flag.Bool("validate-requests", false, "Reject requests that do not match the OpenAPI document")
+	validateResponses = flag.Bool("validate-responses", false, "Replace responses that do not match the OpenAPI document with a 500")
+
+	clockStart  = flag.String("clock", "", "RFC 3339 time the server clock starts at, defaults to the system time")
+	clockFrozen = flag.Bool("freeze-clock", false, "Start with the server clock frozen, it then only moves through the admin API")
+
+	totpSkew = flag.Int("totp-skew", 1, "Number of 30s time steps a TOTP code may drift from the server clock")
+
+	tenantTokens = flag.String("tenant-tokens", "", "Comma separated token:tenant API tokens bound to a tenant")
+	maxTenants   = flag.Int("max-tenants", fakeprovider.DefaultMaxTenants, "Maximum number of tenants, the default one included")
 )
 
 func main() {
 	flag.Parse()
 
-	cards := make([]*card, 0)
-	// This is where the router is useful, it allows us to declare methods that
-	// this path will be valid for
-
-	cards = append(cards, newCard(&user{
-		FirstName: "louane",
-		LastName:  "vidal",
-		Email:     "louane.vidal@example.com",
-	}))
-
-	cards = append(cards, newCard(&user{
-		FirstName: "noel",
-		LastName:  "peixoto",
-		Email:     "noel.peixoto@example.com",
-	}))
-
-	cards = append(cards, newCard(&user{
-		FirstName: "manuel",
-		LastName:  "lorenzo",
-		Email:     "manuel.lorenzo@example.com",
-	}))
-
-	cards = append(cards, newCard(&user{
-		FirstName: "alberto",
-		LastName:  "lozano",
-		Email:     "alberto.lozano@example.com",
-	}))
-
-	cards = append(cards, newCard(&user{
-		FirstName: "lala",
-		LastName:  "lalo",
-		Email:     "lala@example.com",
-	}))
-
-	userUUID := "ff2ecbed-cca9-413b-90b7-e9bd2a8d54c0"
-	cards[4].ID = userUUID
-
-	cc := &Context{
-		cards:            cards,
-		username:         "lala@example.org",
-		password:         "lala1234",
-		sessionSecretKey: []byte("awesome-sess-secret-key"),
-		sessionMaxAge:    60 * 60, // one hour
-		userUUID:         userUUID,
-		AuthKeys:         make(map[string]string),
-	}
-
-	rate := limiter.Rate{
-		Period: 10 * time.Second,
-		Limit:  2,
-	}
-	store := memory.NewStore()
+	var keyring *vault.Keyring
+	if *kek != "" {
+		var err error
+		if keyring, err = vault.ParseKeyring(*kek); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	// middlewares
-	fakeLogger := logger.NewLogger("fakeprovider")
-	rateLimitMid := stdlib.NewMiddleware(
-		limiter.New(store, rate),
-		stdlib.WithForwardHeader(true),
-		stdlib.WithLimitReachedHandler(func(w http.ResponseWriter, r *http.Request) {
-			apierror.NewError("Limit exceeded", http.StatusTooManyRequests).Write(w)
-		}),
-	)
-	auth := NewAuthMiddleware(*token)
-
-	r := NewRouter()
-	r.GET("/", fakeLogger.Handle(rateLimitMid.Handler(ContextHandler{cc, getAllCardsHandler})))
-	r.POST("/cards", fakeLogger.Handle(rateLimitMid.Handler(ContextHandler{cc, create})))
-	r.POST("/load", fakeLogger.Handle(rateLimitMid.Handler(ContextHandler{cc, loadHandler})))
-	r.PATCH("/cards/:id/info", fakeLogger.Handle(auth.Handle(ContextHandler{cc, patch})))
-
-	r.POST("/login", fakeLogger.Handle(rateLimitMid.Handler(ContextHandler{cc, createSession})))
-	r.GET("/api/me", fakeLogger.Handle(rateLimitMid.Handler(ContextHandler{cc, me})))
-	r.POST("/api/me/verify", fakeLogger.Handle(rateLimitMid.Handler(ContextHandler{cc, verify})))
-	r.POST("/api/me/card", fakeLogger.Handle(rateLimitMid.Handler(ContextHandler{cc, getCard})))
-
-	log.Printf("server running on %s", fmt.Sprintf(":%s", *port))
-
-	cors := corsLib.New(corsLib.Options{
-		AllowedOrigins:     []string{"*"},
-		AllowedHeaders:     []string{"Accept", "Authorization", "Content-Type", "Credentials"},
-		AllowedMethods:     []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"},
-		AllowCredentials:   true,
-		OptionsPassthrough: true,
-		Debug:              true,
-	})
+	chaos := fakeprovider.Chaos{ErrorRate: *errorRate}
+	var err error
+	if chaos.CreateDelay, err = fakeprovider.ParseDelay(*createDelay); err != nil {
+		log.Fatal(err)
+	}
+	if chaos.LoadDelay, err = fakeprovider.ParseDelay(*loadDelay); err != nil {
+		log.Fatal(err)
+	}
 
-	mux := http.NewServeMux()
-	mux.Handle("/", cors.Handler(r))
-	panic(http.ListenAndServe(fmt.Sprintf(":%s", *port), mux))
-}
+	jit := fakeprovider.JIT{
+		URL:     *jitURL,
+		Timeout: fakeprovider.Duration(*jitTimeout),
+		Default: *jitDefault,
+		Secret:  *jitSecret,
+	}
 
-func unmarshalJSON(r io.ReadCloser, v interface{}) error {
-	body, err := ioutil.ReadAll(r)
-	if err != nil {
-		return err
+	rateLimit := fakeprovider.DefaultRateLimit()
+	var policies []fakeprovider.RateLimitPolicy
+	if *rateLimits != "" {
+		if policies, err = fakeprovider.LoadRateLimits(*rateLimits); err != nil {
+			log.Fatal(err)
+		}
+		rateLimit = fakeprovider.RateLimit{}
 	}
 
-	return json.Unmarshal(body, v)
-}
+	tokens, err := fakeprovider.ParseTenantTokens(*tenantTokens)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-func randomProcessTime(min, max int) time.Duration {
-	rand.Seed(time.Now().UTC().UnixNano())
-	return time.Duration(rand.Intn(max-min) + min)
-}
+	var scripted []fakeprovider.Scenario
+	if *scenarios != "" {
+		if scripted, err = fakeprovider.LoadScenarios(*scenarios); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-type response struct {
-	Status int         `json:"-"`
-	Data   interface{} `json:"data,omitempty"`
-	Meta   interface{} `json:"meta,omitempty"`
-}
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName:  "fakeprovider",
+		Exporter:     *traceExporter,
+		OTLPEndpoint: *otlpEndpoint,
+		OTLPInsecure: *otlpInsecure,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
 
-// Write writes a ApplicationResposne to the given response writer encoded as JSON.
-func (r *response) Write(w http.ResponseWriter) error {
-	b, err := json.Marshal(r)
+	// middlewares
+	level, err := logrus.ParseLevel(*logLevel)
 	if err != nil {
-		return err
+		log.Fatal(err)
+	}
+	if *logFormat != logger.FormatJSON && *logFormat != logger.FormatText {
+		log.Fatalf("invalid log format %q", *logFormat)
+	}
+	proxies, err := logger.ParseTrustedProxies(splitList(*trustedProxies))
+	if err != nil {
+		log.Fatal(err)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(r.Status)
-	_, err = w.Write(b)
-	return err
-}
 
-type errorResponse struct {
-	Status int           `json:"-"`
-	Error  *errorMessage `json:"error,omitempty"`
-}
+	// redactor masks the logged bodies and the bodies of the cassettes.
+	redactor := logger.NewRedactor(
+		append(logger.DefaultRedactedFields, splitList(*redactFields)...),
+		append(logger.DefaultRedactedHeaders, splitList(*redactHeaders)...),
+	)
+	logOpts := []logger.Option{
+		logger.WithLevel(level),
+		logger.WithFormat(*logFormat),
+		logger.WithTrustedProxies(proxies),
+		logger.WithRedactor(redactor),
+	}
+	if *logBodies {
+		logOpts = append(logOpts, logger.WithBodies(*logBodyLimit))
+	}
 
-type errorMessage struct {
-	Message string `json:"message"`
-}
+	start := time.Now()
+	if *clockStart != "" {
+		if start, err = time.Parse(time.RFC3339, *clockStart); err != nil {
+			log.Fatal(err)
+		}
+	}
+	clk := clock.NewVirtual(start)
+	if *clockFrozen {
+		clk.Freeze()
+	}
 
-// Write writes a ApplicationResposne to the given response writer encoded as JSON.
-func (er *errorResponse) Write(w http.ResponseWriter) error {
-	b, err := json.Marshal(er)
-	if err != nil {
-		return err
+	var seed []fakeprovider.Cardholder
+	if *fixtureCount > 0 {
+		if seed, err = fixtures.Generate(fixtures.Options{
+			Count:           *fixtureCount,
+			Locale:          *fixtureLocale,
+			Seed:            *fixtureSeed,
+			Now:             start,
+			MaxTransactions: *fixtureTransactions,
+		}); err != nil {
+			log.Fatal(err)
+		}
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(er.Status)
-	_, err = w.Write(b)
-	return err
-}
 
-// NewError ...NewError
-func NewError(msg string, status int) *errorResponse {
-	return &errorResponse{
-		Status: status,
-		Error: &errorMessage{
-			Message: msg,
-		},
+	var state io.Reader
+	if *stateFile != "" {
+		// the card secrets of the snapshot are sealed, a random KEK would
+		// make it unreadable by the next run.
+		if *kek == "" {
+			log.Fatal("-state-file needs -kek")
+		}
+		f, err := os.Open(*stateFile)
+		switch {
+		case err == nil:
+			defer f.Close()
+			state = f
+			log.Printf("restoring state from %s", *stateFile)
+		case !os.IsNotExist(err):
+			log.Fatal(err)
+		}
 	}
-}
 
-type user struct {
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Email     string `json:"email"`
-}
+	var handler, adminHandler http.Handler
+	var server *fakeprovider.Server
+	switch *mode {
+	case modeFake:
+		server, err = fakeprovider.New(fakeprovider.Options{
+			Seed:       seed,
+			State:      state,
+			Clock:      clk,
+			Chaos:      chaos,
+			JIT:        jit,
+			RateLimit:  rateLimit,
+			RateLimits: policies,
+			Scenarios:  scripted,
+			Credentials: fakeprovider.Credentials{
+				APIToken:   *token,
+				AdminToken: *adminToken,
+			},
+			Keyring:           keyring,
+			TOTPSkew:          *totpSkew,
+			TenantTokens:      tokens,
+			MaxTenants:        *maxTenants,
+			TrustedProxies:    proxies,
+			LoggerOptions:     logOpts,
+			ValidateRequests:  *validateRequests,
+			ValidateResponses: *validateResponses,
+			CORSDebug:         true,
+			SeparateAdmin:     *adminPort != "",
+			Personalities:     splitList(*personalities),
+		})
+		if err == nil {
+			handler, adminHandler = server, server.AdminHandler()
+		}
+	case modeRecord:
+		handler, err = newRecorder(*target, *cassette, redactor, logOpts)
+	case modeReplay:
+		handler, err = newReplayer(*cassette, redactor, logOpts)
+	default:
+		err = fmt.Errorf("invalid mode %q", *mode)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 
-type card struct {
-	ID          string    `json:"id,omitempty"`
-	NameOnCard  string    `json:"name_on_card,omitempty"`
-	PAN         string    `json:"pan,omitempty"`
-	RealPAN     string    `json:"-"`
-	ReferenceID string    `json:"reference_id,omitempty"`
-	ExpDate     string    `json:"exp_date,omitempty"`
-	RealExpDate string    `json:"-"`
-	CVV         string    `json:"cvv,omitempty"`
-	RealCVV     string    `json:"-"`
-	Balance     int64     `json:"balance,omitempty"`
-	User        *user     `json:"user,omitempty"`
-	CreatedAt   time.Time `json:"created_at,omitempty"`
-	UpdatedAt   time.Time `json:"updated_at,omitempty"`
-}
+	log.Printf("%s server running on %s", *mode, fmt.Sprintf(":%s", *port))
 
-func (c *card) SetNameOnCard(u *user) {
-	c.NameOnCard = fmt.Sprintf("%s %s", u.FirstName, u.LastName)
-}
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%s", *port),
+		Handler: handler,
+	}
 
-func (c *card) SetPAN() {
-	c.RealPAN = fmt.Sprintf("5432%s", randomStringNumber(12))
-	c.PAN = fmt.Sprintf("XXXX-%s", c.RealPAN[len(c.RealPAN)-4:])
-}
+	// others are the listeners besides srv, stopped along with it.
+	var others []*http.Server
+	if *adminPort != "" && adminHandler != nil {
+		others = append(others, &http.Server{
+			Addr:    fmt.Sprintf(":%s", *adminPort),
+			Handler: adminHandler,
+		})
+		log.Printf("admin server running on :%s", *adminPort)
+	}
+	if *listen != "" {
+		if server == nil {
+			log.Fatalf("-listen needs the %s mode", modeFake)
+		}
+		listeners, err := parseListeners(*listen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, l := range listeners {
+			h, err := server.Handler(l.personalities...)
+			if err != nil {
+				log.Fatal(err)
+			}
+			others = append(others, &http.Server{
+				Addr:    fmt.Sprintf(":%s", l.port),
+				Handler: h,
+			})
+			log.Printf("%s server running on :%s", strings.Join(l.personalities, "+"), l.port)
+		}
+	}
+	var isoListener net.Listener
+	// closing tells the ISO 8583 listener it is closed on purpose.
+	closing := make(chan struct{})
+	if *iso8583Port != "" {
+		if server == nil {
+			log.Fatalf("-iso8583-port needs the %s mode", modeFake)
+		}
+		spec := iso8583.DefaultSpec()
+		if *iso8583Spec != "" {
+			if spec, err = iso8583.LoadSpec(*iso8583Spec); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if isoListener, err = net.Listen("tcp", fmt.Sprintf(":%s", *iso8583Port)); err != nil {
+			log.Fatal(err)
+		}
+		cfg := fakeprovider.ISO8583{Spec: spec, Tenant: *iso8583Tenant, CVVField: *iso8583CVVField}
+		go func() {
+			err := server.ServeISO8583(isoListener, cfg)
+			select {
+			case <-closing:
+			default:
+				log.Fatal(err)
+			}
+		}()
+		log.Printf("ISO 8583 listener running on :%s", *iso8583Port)
+	}
+	for _, other := range others {
+		other := other
+		go func() {
+			if err := other.ListenAndServe(); err != http.ErrServerClosed {
+				panic(err)
+			}
+		}()
+	}
 
-func (c *card) SetReferenceID() {
-	c.ReferenceID = randomStringNumber(8)
-}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		close(closing)
+		if isoListener != nil {
+			isoListener.Close()
+		}
+		for _, other := range others {
+			if err := other.Shutdown(context.Background()); err != nil {
+				log.Println(err)
+			}
+		}
+		if err := srv.Shutdown(context.Background()); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		panic(err)
+	}
 
-func (c *card) SetExpDate() {
-	month := pickMonth()
-	year := pickYear()
-	c.RealExpDate = fmt.Sprintf("%s/%s", month, year)
-	c.ExpDate = "**/**"
-}
+	if server != nil && *stateFile != "" {
+		if err := saveState(server, *stateFile); err != nil {
+			log.Println(err)
+		} else {
+			log.Printf("state saved to %s", *stateFile)
+		}
+	}
 
-func (c *card) SetBalance(balance int64) {
-	c.Balance = balance
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Println(err)
+	}
 }
 
-func (c *card) SetUser(u *user) {
-	c.User = u
-}
+// newRecorder returns a proxy to target recording the exchanges to cassette,
+// their bodies masked by rd.
+func newRecorder(target, cassette string, rd *logger.Redactor, logOpts []logger.Option) (http.Handler, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("record mode needs an absolute -target URL, got %q", target)
+	}
 
-func newCard(u *user) *card {
-	c := &card{}
+	rec, err := replay.NewRecorder(u, cassette, rd)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("recording exchanges with %s to %s", u, cassette)
 
-	c.ID = newID()
-	c.SetNameOnCard(u)
-	c.SetPAN()
-	c.SetExpDate()
-	c.SetReferenceID()
-	c.SetBalance(0)
-	c.SetUser(u)
-	c.CreatedAt = time.Now()
-	c.UpdatedAt = time.Now()
+	l := logger.NewLogger("fakeprovider", logOpts...)
+	return requestid.Handle(l.Handle(rec)), nil
+}
 
-	processTime := randomProcessTime(minCreateProcessTime, maxCreateProcessTime) * time.Second
-	log.Printf("Waiting for %.2fs", processTime.Seconds())
-	time.Sleep(processTime)
+// newReplayer returns a handler serving the exchanges recorded to cassette.
+func newReplayer(cassette string, rd *logger.Redactor, logOpts []logger.Option) (http.Handler, error) {
+	exchanges, err := replay.LoadCassette(cassette)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("replaying %d exchanges from %s", len(exchanges), cassette)
 
-	return c
+	l := logger.NewLogger("fakeprovider", logOpts...)
+	return requestid.Handle(l.Handle(replay.NewReplayer(exchanges, rd))), nil
 }
 
-func randomStringNumber(n int) string {
-	rand.Seed(time.Now().UnixNano())
-	var numbers = []rune("0123456789")
+// saveState writes a snapshot of server to path. The snapshot is written to
+// a temporary file first so a failure never leaves a truncated state file.
+func saveState(server *fakeprovider.Server, path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
 
-	b := make([]rune, n)
-	for i := range b {
-		b[i] = numbers[rand.Intn(len(numbers))]
+	if err := server.WriteSnapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
 	}
-	return string(b)
+	return os.Rename(f.Name(), path)
 }
 
-func pickMonth() string {
-	rand.Seed(time.Now().UnixNano())
-	var months = []string{
-		"01", "02", "03", "04", "05", "06", "07", "08", "09", "10", "11", "12",
-	}
-	return months[rand.Intn(len(months))]
+// listener is a port serving the APIs of some personalities.
+type listener struct {
+	port          string
+	personalities []string
 }
 
-func pickYear() string {
-	rand.Seed(time.Now().UnixNano())
-	var years = []string{
-		"19", "20", "21", "22", "23",
+// parseListeners parses comma separated port=personality+personality
+// listeners.
+func parseListeners(s string) ([]listener, error) {
+	var listeners []listener
+	for _, item := range splitList(s) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid listener %q, use port=personality+personality", item)
+		}
+		listeners = append(listeners, listener{
+			port:          parts[0],
+			personalities: strings.Split(parts[1], "+"),
+		})
 	}
-	return years[rand.Intn(len(years))]
+	return listeners, nil
 }
 
-// newID creates a new UUID.
-func newID() string {
-	u2, err := uuid.NewRandom()
-	if err != nil {
-		fmt.Printf("Something went wrong: %s", err)
-		return ""
+// splitList splits a comma separated flag value, ignoring empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	return u2.String()
+	return items
 }
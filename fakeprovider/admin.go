@@ -0,0 +1,339 @@
+package fakeprovider
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/clock"
+	"github.com/rodrwan/fakeproviders/logger"
+	"github.com/rodrwan/fakeproviders/requestid"
+)
+
+// resetState restores the startup state of the tenant: the startup snapshot
+// or the seed cards without verification keys nor TOTP enrollments, the
+// startup scenarios and chaos settings.
+func resetState(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	if err := ctx.resetTenant(r.Context()); err != nil {
+		return nil, err
+	}
+	logger.FromContext(r.Context()).WithField("tenant", ctx.tenant).Info("state reset")
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   ctx.store.list(r.Context()),
+	}, nil
+}
+
+// clearState drops every card, verification key, TOTP enrollment and
+// scenario of the tenant. The chaos settings are kept.
+func clearState(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	ctx.scenarios.clear()
+	ctx.store.reset(r.Context(), nil)
+	ctx.totp.reset()
+	logger.FromContext(r.Context()).WithField("tenant", ctx.tenant).Info("state cleared")
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   []*card{},
+	}, nil
+}
+
+// importedCard is a card given to the bulk import. Empty fields are
+// generated like for POST /cards, the CVV from the card number when one is
+// given, like for the seed cards.
+type importedCard struct {
+	ID          string `json:"id"`
+	ReferenceID string `json:"reference_id"`
+	CardNumber  string `json:"card_number"`
+	ExpDate     string `json:"exp_date"`
+	CVV         string `json:"cvv"`
+	Balance     int64  `json:"balance"`
+	Status      string `json:"status"`
+	User        *user  `json:"user"`
+}
+
+type importRequestData struct {
+	Cards []importedCard `json:"cards"`
+}
+
+func validCardStatus(status string) bool {
+	switch status {
+	case cardStatusActive, cardStatusBlocked, cardStatusCanceled, cardStatusExpired:
+		return true
+	}
+	return false
+}
+
+// newImportedCard creates the card of an importedCard.
+func newImportedCard(ctx *Context, in *importedCard) (*card, error) {
+	if in.User == nil || in.User.Email == "" {
+		return nil, errors.New("every card needs a user with an email")
+	}
+	if in.Status != "" && !validCardStatus(in.Status) {
+		return nil, errors.New("invalid card status " + in.Status)
+	}
+	if in.CardNumber != "" && len(in.CardNumber) < 12 {
+		return nil, errors.New("invalid card number")
+	}
+
+	u := *in.User
+	c, err := newCard(ctx.keyring, &u, ctx.now())
+	if err != nil {
+		return nil, err
+	}
+
+	if in.CardNumber != "" || in.ExpDate != "" || in.CVV != "" {
+		secrets, err := c.Reveal(ctx.keyring)
+		if err != nil {
+			return nil, err
+		}
+		if in.CardNumber != "" {
+			secrets.PAN = in.CardNumber
+			secrets.CVV = cardCVV(in.CardNumber)
+			c.SetPAN(in.CardNumber)
+		}
+		if in.ExpDate != "" {
+			secrets.ExpDate = in.ExpDate
+		}
+		if in.CVV != "" {
+			secrets.CVV = in.CVV
+		}
+		if err := c.SetSecrets(ctx.keyring, secrets.PAN, secrets.ExpDate, secrets.CVV); err != nil {
+			return nil, err
+		}
+	}
+	if in.ID != "" {
+		c.ID = in.ID
+	}
+	if in.ReferenceID != "" {
+		c.ReferenceID = in.ReferenceID
+	}
+	if in.Status != "" {
+		c.SetStatus(in.Status)
+	}
+	c.SetBalance(in.Balance)
+	return c, nil
+}
+
+// importCards adds cards and their users in bulk. Nothing is imported when
+// one of them is invalid, reuses the id of another card or belongs to a user
+// that already has a card.
+func importCards(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	var payload importRequestData
+	defer r.Body.Close()
+	if err := unmarshalJSON(r.Body, &payload); err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+
+	cards := make([]*card, 0, len(payload.Cards))
+	for i := range payload.Cards {
+		c, err := newImportedCard(ctx, &payload.Cards[i])
+		if err != nil {
+			return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+		}
+		cards = append(cards, c)
+	}
+	if err := ctx.store.addAll(r.Context(), cards); err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+
+	imported := make([]*card, len(cards))
+	for i, c := range cards {
+		imported[i] = c.clone()
+	}
+	return &response{
+		Status: http.StatusCreated,
+		Data:   imported,
+	}, nil
+}
+
+type setCardRequestData struct {
+	Balance *int64  `json:"balance"`
+	Status  *string `json:"status"`
+}
+
+// setCard sets the balance or the status of a card directly.
+func setCard(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	id, ok := r.Context().Value("id").(string)
+	if !ok {
+		return nil, errors.New("missing id")
+	}
+
+	var payload setCardRequestData
+	defer r.Body.Close()
+	if err := unmarshalJSON(r.Body, &payload); err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+	if payload.Status != nil && !validCardStatus(*payload.Status) {
+		return &response{Status: http.StatusBadRequest, Data: "invalid card status " + *payload.Status}, nil
+	}
+
+	entry := ledgerEntry{
+		Type:      ledgerAdjustment,
+		RequestID: requestid.FromContext(r.Context()),
+		CreatedAt: ctx.now(),
+	}
+	c := ctx.store.adjustBalance(r.Context(), byID(id), entry, func(c *card) {
+		if payload.Balance != nil {
+			c.SetBalance(*payload.Balance)
+		}
+		if payload.Status != nil {
+			c.SetStatus(*payload.Status)
+		}
+		c.UpdatedAt = ctx.now()
+	})
+	if c == nil {
+		return &response{Status: http.StatusNotFound}, nil
+	}
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   c,
+	}, nil
+}
+
+type pendingAuthKey struct {
+	UserID    string    `json:"user_id"`
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// listAuthKeys lists the verification keys waiting to be used in
+// POST /api/me/card.
+func listAuthKeys(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	keys := ctx.store.authKeyList(r.Context())
+
+	pending := make([]pendingAuthKey, 0, len(keys))
+	for userID, key := range keys {
+		pending = append(pending, pendingAuthKey{UserID: userID, Key: key.Key, ExpiresAt: key.ExpiresAt})
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].UserID < pending[j].UserID })
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   pending,
+	}, nil
+}
+
+// getChaos returns the chaos settings in use.
+func getChaos(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	return &response{
+		Status: http.StatusOK,
+		Data:   ctx.chaos.get(),
+	}, nil
+}
+
+// setChaos replaces the chaos settings.
+func setChaos(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	var chaos Chaos
+	defer r.Body.Close()
+	if err := unmarshalJSON(r.Body, &chaos); err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+	if err := chaos.validate(); err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+
+	ctx.chaos.set(chaos)
+	logger.FromContext(r.Context()).WithField("chaos", chaos).Info("chaos settings changed")
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   chaos,
+	}, nil
+}
+
+var errClockNotControllable = errors.New("the server clock can't be controlled")
+
+type clockState struct {
+	Now    time.Time `json:"now"`
+	Frozen bool      `json:"frozen"`
+}
+
+func newClockState(ctx *Context) *clockState {
+	state := &clockState{Now: ctx.now()}
+	if v, ok := ctx.clock.(*clock.Virtual); ok {
+		state.Frozen = v.Frozen()
+	}
+	return state
+}
+
+// getClock returns the time of the server clock.
+func getClock(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	return &response{
+		Status: http.StatusOK,
+		Data:   newClockState(ctx),
+	}, nil
+}
+
+type setClockRequestData struct {
+	Now    *time.Time `json:"now"`
+	Frozen *bool      `json:"frozen"`
+}
+
+// setClock sets the time of the server clock, freezes it or lets it run.
+// Timers due by the new time fire.
+func setClock(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	v, ok := ctx.clock.(*clock.Virtual)
+	if !ok {
+		return &response{Status: http.StatusBadRequest, Data: errClockNotControllable.Error()}, nil
+	}
+
+	var payload setClockRequestData
+	defer r.Body.Close()
+	if err := unmarshalJSON(r.Body, &payload); err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+
+	if payload.Now != nil {
+		v.Set(*payload.Now)
+	}
+	if payload.Frozen != nil {
+		if *payload.Frozen {
+			v.Freeze()
+		} else {
+			v.Resume()
+		}
+	}
+	state := newClockState(ctx)
+	logger.FromContext(r.Context()).WithField("clock", state.Now).
+		WithField("frozen", state.Frozen).Info("clock set")
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   state,
+	}, nil
+}
+
+type advanceClockRequestData struct {
+	Duration Duration `json:"duration"`
+}
+
+// advanceClock moves the server clock forward, timers due by the new time
+// fire.
+func advanceClock(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	v, ok := ctx.clock.(*clock.Virtual)
+	if !ok {
+		return &response{Status: http.StatusBadRequest, Data: errClockNotControllable.Error()}, nil
+	}
+
+	var payload advanceClockRequestData
+	defer r.Body.Close()
+	if err := unmarshalJSON(r.Body, &payload); err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+	if payload.Duration <= 0 {
+		return &response{Status: http.StatusBadRequest, Data: "duration must be positive"}, nil
+	}
+
+	v.Advance(time.Duration(payload.Duration))
+	state := newClockState(ctx)
+	logger.FromContext(r.Context()).WithField("clock", state.Now).Info("clock advanced")
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   state,
+	}, nil
+}
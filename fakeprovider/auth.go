@@ -1,4 +1,4 @@
-package main
+package fakeprovider
 
 import (
 	"encoding/json"
@@ -7,11 +7,14 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/rodrwan/fakeproviders/requestid"
 )
 
 type apiError struct {
 	StatusCode int    `json:"-"`
 	Message    string `json:"message,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
 }
 
 func (ar *apiError) Error() string {
@@ -27,7 +30,10 @@ func newError(status int, msg string) *apiError {
 
 // Write writes an aPIError to the given response writer encoded as JSON.
 func (ar *apiError) Write(w http.ResponseWriter) error {
-	b, err := json.Marshal(ar)
+	e := *ar
+	e.RequestID = w.Header().Get(requestid.HeaderKey)
+
+	b, err := json.Marshal(&e)
 	if err != nil {
 		return err
 	}
@@ -57,11 +63,25 @@ const (
 // AuthMiddleware provides a middleware to authenticate an incoming request.
 type AuthMiddleware struct {
 	Token string
+	// Tokens are accepted besides Token, e.g. the tenant API tokens.
+	Tokens []string
 }
 
 // NewAuthMiddleware creates a new AuthMiddleware with the given user session service.
-func NewAuthMiddleware(token string) *AuthMiddleware {
-	return &AuthMiddleware{Token: token}
+func NewAuthMiddleware(token string, tokens ...string) *AuthMiddleware {
+	return &AuthMiddleware{Token: token, Tokens: tokens}
+}
+
+func (m *AuthMiddleware) accepts(token string) bool {
+	if token == m.Token {
+		return true
+	}
+	for _, t := range m.Tokens {
+		if token == t {
+			return true
+		}
+	}
+	return false
 }
 
 // Handle authenticate the incoming request, if the authentication process fails then an
@@ -80,7 +100,7 @@ func (m *AuthMiddleware) Handle(next http.Handler) http.Handler {
 			return
 		}
 
-		if token != m.Token {
+		if !m.accepts(token) {
 			errTokenMismatch.Write(w)
 			return
 		}
@@ -101,3 +121,15 @@ func parseAuthToken(r *http.Request) (string, error) {
 	}
 	return header[len(tokenTypePrefix):], nil
 }
+
+// apiKey returns the API token of a request, sent as a Bearer token or, like
+// the Stripe clients do, as the username of a Basic authorization.
+func apiKey(r *http.Request) string {
+	if token, err := parseAuthToken(r); err == nil {
+		return token
+	}
+	if username, _, ok := r.BasicAuth(); ok {
+		return username
+	}
+	return ""
+}
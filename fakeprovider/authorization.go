@@ -0,0 +1,256 @@
+package fakeprovider
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/tracing"
+)
+
+// Authorization statuses. Approved authorizations hold their amount until
+// they are captured, closing them, or reversed, releasing the amount.
+// Declined authorizations are closed right away.
+const (
+	authorizationPending  = "pending"
+	authorizationClosed   = "closed"
+	authorizationReversed = "reversed"
+)
+
+// Decline reasons of the authorizations.
+const (
+	declineCardInactive      = "card_inactive"
+	declineCardExpired       = "card_expired"
+	declineInsufficientFunds = "insufficient_funds"
+)
+
+var (
+	errAuthorizationNotFound   = errors.New("authorization not found")
+	errAuthorizationNotPending = errors.New("authorization is not pending")
+	errAuthorizationCardAbsent = errors.New("card not found")
+)
+
+type merchant struct {
+	Name     string `json:"name,omitempty"`
+	Category string `json:"category,omitempty"`
+	City     string `json:"city,omitempty"`
+	Country  string `json:"country,omitempty"`
+}
+
+// authorization is a request of a merchant to hold an amount on a card.
+type authorization struct {
+	ID            string   `json:"id"`
+	CardID        string   `json:"card_id"`
+	Amount        int64    `json:"amount"`
+	Currency      string   `json:"currency"`
+	Merchant      merchant `json:"merchant"`
+	Approved      bool     `json:"approved"`
+	DeclineReason string   `json:"decline_reason,omitempty"`
+	Status        string   `json:"status"`
+	// Channel is the API the authorization came through.
+	Channel  string            `json:"channel,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// JIT is how the JIT endpoint decided the authorization, nil outside of
+	// the JIT mode.
+	JIT       *jitOutcome `json:"jit,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// authorizationRequest asks to hold Amount on a card.
+type authorizationRequest struct {
+	CardID    string
+	Amount    int64
+	Currency  string
+	Merchant  merchant
+	Channel   string
+	Metadata  map[string]string
+	RequestID string
+}
+
+// cardDeclineReason tells why a card can't be used, empty when it can.
+func cardDeclineReason(c *card) string {
+	switch {
+	case c.deleted():
+		return declineCardInactive
+	case c.Status == cardStatusExpired:
+		return declineCardExpired
+	case c.Status != cardStatusActive:
+		return declineCardInactive
+	}
+	return ""
+}
+
+// declineReason tells why a card can't hold amount, empty when it can.
+func declineReason(c *card, amount int64) string {
+	if reason := cardDeclineReason(c); reason != "" {
+		return reason
+	}
+	if c.Balance < amount {
+		return declineInsufficientFunds
+	}
+	return ""
+}
+
+// authorize decides on an authorization request and records it. Approved
+// authorizations take their amount from the balance of the card. In JIT mode
+// the JIT endpoint decides instead.
+func (ctx *Context) authorize(c context.Context, req authorizationRequest) (*authorization, error) {
+	now := ctx.now()
+	a := &authorization{
+		ID:        newID(),
+		CardID:    req.CardID,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+		Merchant:  req.Merchant,
+		Channel:   req.Channel,
+		Metadata:  req.Metadata,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if j := ctx.jit.get(); j.URL != "" {
+		return ctx.authorizeJIT(c, j, req, a)
+	}
+
+	entry := ledgerEntry{
+		Type:            ledgerAuthorization,
+		AuthorizationID: a.ID,
+		Description:     req.Merchant.Name,
+		RequestID:       req.RequestID,
+		CreatedAt:       now,
+	}
+	updated := ctx.store.adjustBalance(c, byIDWithDeleted(req.CardID), entry, func(card *card) {
+		a.DeclineReason = declineReason(card, req.Amount)
+		if a.DeclineReason != "" {
+			return
+		}
+		card.Balance -= req.Amount
+		card.UpdatedAt = now
+	})
+	if updated == nil {
+		return nil, errAuthorizationCardAbsent
+	}
+
+	a.Approved = a.DeclineReason == ""
+	a.Status = authorizationPending
+	if !a.Approved {
+		a.Status = authorizationClosed
+	}
+	ctx.store.addAuthorization(c, a)
+	return a.clone(), nil
+}
+
+// captureAuthorization closes a pending authorization, its amount is spent.
+func (ctx *Context) captureAuthorization(c context.Context, id string) (*authorization, error) {
+	now := ctx.now()
+	return ctx.store.updateAuthorization(c, id, func(a *authorization) error {
+		if a.Status != authorizationPending {
+			return errAuthorizationNotPending
+		}
+		a.Status = authorizationClosed
+		a.UpdatedAt = now
+		return nil
+	})
+}
+
+// reverseAuthorization releases the amount of a pending authorization back
+// to the balance of its card. With captured, the approved authorizations
+// already captured are reversed too, as financial transactions are.
+func (ctx *Context) reverseAuthorization(c context.Context, id, requestID string, captured bool) (*authorization, error) {
+	now := ctx.now()
+	a, err := ctx.store.updateAuthorization(c, id, func(a *authorization) error {
+		if a.Status != authorizationPending && !(captured && a.Approved && a.Status == authorizationClosed) {
+			return errAuthorizationNotPending
+		}
+		a.Status = authorizationReversed
+		a.UpdatedAt = now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entry := ledgerEntry{
+		Type:            ledgerReversal,
+		AuthorizationID: a.ID,
+		Description:     a.Merchant.Name,
+		RequestID:       requestID,
+		CreatedAt:       now,
+	}
+	// the card may have been deleted since, the amount is then lost.
+	ctx.store.adjustBalance(c, byIDWithDeleted(a.CardID), entry, func(card *card) {
+		card.Balance += a.Amount
+		card.UpdatedAt = now
+	})
+	return a, nil
+}
+
+func (a *authorization) clone() *authorization {
+	cp := *a
+	if a.JIT != nil {
+		jit := *a.JIT
+		cp.JIT = &jit
+	}
+	return &cp
+}
+
+// addAuthorization records an authorization.
+func (s *store) addAuthorization(ctx context.Context, a *authorization) {
+	_, span := tracing.Start(ctx, "store.add_authorization")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authorizations = append(s.authorizations, a.clone())
+}
+
+// authorizationList returns the authorizations, oldest first.
+func (s *store) authorizationList(ctx context.Context) []*authorization {
+	_, span := tracing.Start(ctx, "store.list_authorizations")
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	authorizations := make([]*authorization, len(s.authorizations))
+	for i, a := range s.authorizations {
+		authorizations[i] = a.clone()
+	}
+	return authorizations
+}
+
+// findAuthorization returns the authorization with the given id, or nil.
+func (s *store) findAuthorization(ctx context.Context, id string) *authorization {
+	_, span := tracing.Start(ctx, "store.find_authorization")
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, a := range s.authorizations {
+		if a.ID == id {
+			return a.clone()
+		}
+	}
+	return nil
+}
+
+// updateAuthorization applies fn to the authorization with the given id and
+// returns it updated, nothing changes when fn fails.
+func (s *store) updateAuthorization(ctx context.Context, id string, fn func(*authorization) error) (*authorization, error) {
+	_, span := tracing.Start(ctx, "store.update_authorization")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.authorizations {
+		if a.ID != id {
+			continue
+		}
+		updated := a.clone()
+		if err := fn(updated); err != nil {
+			return nil, err
+		}
+		*a = *updated
+		return updated, nil
+	}
+	return nil, errAuthorizationNotFound
+}
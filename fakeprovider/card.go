@@ -0,0 +1,181 @@
+package fakeprovider
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rodrwan/fakeproviders/vault"
+)
+
+type user struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+}
+
+type card struct {
+	ID          string    `json:"id,omitempty"`
+	NameOnCard  string    `json:"name_on_card,omitempty"`
+	PAN         string    `json:"pan,omitempty"`
+	ReferenceID string    `json:"reference_id,omitempty"`
+	ExpDate     string    `json:"exp_date,omitempty"`
+	CVV         string    `json:"cvv,omitempty"`
+	Balance     int64     `json:"balance,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	User        *user     `json:"user,omitempty"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+	// DeletedAt is set once the card is deleted, deleted cards are kept but
+	// only GET /cards/:id returns them.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Metadata holds the key-value pairs set through the Stripe API, it is
+	// replaced as a whole on changes.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// secrets holds the encrypted PAN, expiry date and CVV.
+	secrets *vault.Envelope
+}
+
+// Card statuses.
+const (
+	cardStatusActive   = "active"
+	cardStatusBlocked  = "blocked"
+	cardStatusCanceled = "canceled"
+	cardStatusExpired  = "expired"
+)
+
+const (
+	secretPAN     = "pan"
+	secretExpDate = "exp_date"
+	secretCVV     = "cvv"
+)
+
+func (c *card) SetNameOnCard(u *user) {
+	c.NameOnCard = fmt.Sprintf("%s %s", u.FirstName, u.LastName)
+}
+
+func (c *card) SetPAN(pan string) {
+	c.PAN = fmt.Sprintf("XXXX-%s", pan[len(pan)-4:])
+}
+
+func (c *card) SetReferenceID() {
+	c.ReferenceID = randomStringNumber(8)
+}
+
+func (c *card) SetExpDate() {
+	c.ExpDate = "**/**"
+}
+
+func (c *card) SetBalance(balance int64) {
+	c.Balance = balance
+}
+
+func (c *card) SetStatus(status string) {
+	c.Status = status
+}
+
+func (c *card) SetUser(u *user) {
+	c.User = u
+}
+
+func (c *card) deleted() bool {
+	return c.DeletedAt != nil
+}
+
+// SetSecrets encrypts the sensitive card data with a new data key, the
+// plaintext values are not kept.
+func (c *card) SetSecrets(kr *vault.Keyring, pan, expDate, cvv string) error {
+	env, err := kr.Seal(map[string]string{
+		secretPAN:     pan,
+		secretExpDate: expDate,
+		secretCVV:     cvv,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.secrets = env
+	return nil
+}
+
+// Reveal decrypts the sensitive card data.
+func (c *card) Reveal(kr *vault.Keyring) (*revealedCard, error) {
+	secrets, err := kr.Open(c.secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	return &revealedCard{
+		NameOnCard: c.NameOnCard,
+		PAN:        secrets[secretPAN],
+		ExpDate:    secrets[secretExpDate],
+		CVV:        secrets[secretCVV],
+	}, nil
+}
+
+func newCard(kr *vault.Keyring, u *user, now time.Time) (*card, error) {
+	c := &card{}
+
+	pan := fmt.Sprintf("5432%s", randomStringNumber(12))
+	expDate := fmt.Sprintf("%s/%s", pickMonth(), pickYear(now))
+	cvv := cardCVV(pan)
+	if err := c.SetSecrets(kr, pan, expDate, cvv); err != nil {
+		return nil, err
+	}
+
+	c.ID = newID()
+	c.SetNameOnCard(u)
+	c.SetPAN(pan)
+	c.SetExpDate()
+	c.SetReferenceID()
+	c.SetBalance(0)
+	c.SetStatus(cardStatusActive)
+	c.SetUser(u)
+	c.CreatedAt = now
+	c.UpdatedAt = now
+
+	return c, nil
+}
+
+// cardCVV returns the CVV of the card number pan, the generated and imported
+// cards derive it from their number.
+func cardCVV(pan string) string {
+	return fmt.Sprintf("%c%c%c", pan[3], pan[7], pan[11])
+}
+
+func randomStringNumber(n int) string {
+	rand.Seed(time.Now().UnixNano())
+	var numbers = []rune("0123456789")
+
+	b := make([]rune, n)
+	for i := range b {
+		b[i] = numbers[rand.Intn(len(numbers))]
+	}
+	return string(b)
+}
+
+func pickMonth() string {
+	rand.Seed(time.Now().UnixNano())
+	var months = []string{
+		"01", "02", "03", "04", "05", "06", "07", "08", "09", "10", "11", "12",
+	}
+	return months[rand.Intn(len(months))]
+}
+
+// pickYear picks an expiry year within the next five years.
+func pickYear(now time.Time) string {
+	rand.Seed(time.Now().UnixNano())
+	return fmt.Sprintf("%02d", (now.Year()+1+rand.Intn(5))%100)
+}
+
+// newID creates a new UUID.
+func newID() string {
+	u2, err := uuid.NewRandom()
+	if err != nil {
+		fmt.Printf("Something went wrong: %s", err)
+		return ""
+	}
+	return u2.String()
+}
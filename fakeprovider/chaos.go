@@ -0,0 +1,172 @@
+package fakeprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/logger"
+	"github.com/rodrwan/fakeproviders/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Delay is a range of simulated processing times.
+type Delay struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// jsonDelay is the JSON form of a Delay, with durations such as "2s".
+type jsonDelay struct {
+	Min Duration `json:"min"`
+	Max Duration `json:"max"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Delay) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonDelay{Min: Duration(d.Min), Max: Duration(d.Max)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Delay) UnmarshalJSON(b []byte) error {
+	var jd jsonDelay
+	if err := json.Unmarshal(b, &jd); err != nil {
+		return err
+	}
+	d.Min, d.Max = time.Duration(jd.Min), time.Duration(jd.Max)
+	return nil
+}
+
+func (d Delay) validate() error {
+	if d.Min < 0 || d.Max < 0 || (d.Max != 0 && d.Max < d.Min) {
+		return fmt.Errorf("invalid delay range %s-%s", d.Min, d.Max)
+	}
+	return nil
+}
+
+// Chaos configures the failures and delays injected to emulate a real
+// provider. The zero value disables them.
+type Chaos struct {
+	// ErrorRate is the probability, between 0 and 1, of POST /cards failing
+	// with a 500.
+	ErrorRate   float64 `json:"error_rate"`
+	CreateDelay Delay   `json:"create_delay"`
+	LoadDelay   Delay   `json:"load_delay"`
+}
+
+// ParseDelay parses a delay range such as "2s-10s", a single duration is a
+// fixed delay.
+func ParseDelay(s string) (Delay, error) {
+	parts := strings.SplitN(s, "-", 2)
+	min, err := time.ParseDuration(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return Delay{}, fmt.Errorf("invalid delay %q: %v", s, err)
+	}
+	d := Delay{Min: min, Max: min}
+	if len(parts) == 2 {
+		if d.Max, err = time.ParseDuration(strings.TrimSpace(parts[1])); err != nil {
+			return Delay{}, fmt.Errorf("invalid delay %q: %v", s, err)
+		}
+	}
+	if d.Min < 0 || d.Max < d.Min {
+		return Delay{}, fmt.Errorf("invalid delay %q", s)
+	}
+	return d, nil
+}
+
+func (c Chaos) validate() error {
+	if c.ErrorRate < 0 || c.ErrorRate > 1 {
+		return fmt.Errorf("invalid error rate %v, it must be between 0 and 1", c.ErrorRate)
+	}
+	if err := c.CreateDelay.validate(); err != nil {
+		return err
+	}
+	return c.LoadDelay.validate()
+}
+
+// chaosSettings holds the chaos settings in use, which the admin API changes
+// at runtime.
+type chaosSettings struct {
+	mu    sync.RWMutex
+	chaos Chaos
+}
+
+func (s *chaosSettings) get() Chaos {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.chaos
+}
+
+func (s *chaosSettings) set(c Chaos) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chaos = c
+}
+
+// DefaultChaos returns the chaos settings of the standalone server.
+func DefaultChaos() Chaos {
+	return Chaos{
+		ErrorRate:   0.3,
+		CreateDelay: Delay{Min: 2 * time.Second, Max: 10 * time.Second},
+		LoadDelay:   Delay{Min: 2 * time.Second, Max: 10 * time.Second},
+	}
+}
+
+var (
+	randMu sync.Mutex
+	// chaosRand drives the injected faults and delays, it isn't
+	// safe for concurrent use so it is guarded by randMu.
+	chaosRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func randomInt63n(n int64) int64 {
+	randMu.Lock()
+	defer randMu.Unlock()
+	return chaosRand.Int63n(n)
+}
+
+func randomFloat64() float64 {
+	randMu.Lock()
+	defer randMu.Unlock()
+	return chaosRand.Float64()
+}
+
+// randomProcessTime returns a random duration within d.
+func randomProcessTime(d Delay) time.Duration {
+	if d.Max <= d.Min {
+		return d.Min
+	}
+	return d.Min + time.Duration(randomInt63n(int64(d.Max-d.Min)))
+}
+
+func randomError(ctx *Context, r *http.Request) error {
+	if randomFloat64() < ctx.chaos.get().ErrorRate {
+		logger.FromContext(r.Context()).Warn("Something funny (:")
+		ctx.metrics.faultInjected(r)
+		return errors.New("Something went wrong")
+	}
+
+	return nil
+}
+
+// simulateProcessing sleeps for a random time within d on the server clock,
+// emulating the processing time of a real provider.
+func (ctx *Context) simulateProcessing(r *http.Request, d Delay) {
+	processTime := randomProcessTime(d)
+	if processTime <= 0 {
+		return
+	}
+
+	logger.FromContext(r.Context()).Infof("Waiting for %.2fs", processTime.Seconds())
+	ctx.metrics.delaySimulated(r, processTime)
+
+	_, span := tracing.Start(r.Context(), "simulated_processing",
+		attribute.Float64("delay_seconds", processTime.Seconds()))
+	defer span.End()
+	sleepContext(r, ctx.clock, processTime)
+}
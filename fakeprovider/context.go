@@ -0,0 +1,89 @@
+package fakeprovider
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/clock"
+	"github.com/rodrwan/fakeproviders/vault"
+)
+
+// Context context holds shared data between services and handlers
+type Context struct {
+	// tenant is the tenant whose state store, totp, scenarios, chaos and
+	// jit are, see forTenant.
+	tenant    string
+	tenants   *tenantSet
+	store     *store
+	totp      *totpStore
+	scenarios *scenarioSet
+	chaos     *chaosSettings
+	jit       *jitSettings
+
+	keyring    *vault.Keyring
+	metrics    *metrics
+	rateLimits *rateLimiter
+	webhooks   *webhookSender
+	clock      clock.Clock
+
+	// seed, seedState, seedScenarios, seedChaos and seedJIT are the startup
+	// state, restored by the admin API. seedState holds the state of some
+	// tenants by id, it replaces seed for them.
+	seed          []Cardholder
+	seedState     *seedStates
+	seedScenarios []Scenario
+	seedChaos     Chaos
+	seedJIT       JIT
+
+	username         string
+	password         string
+	userUUID         string
+	sessionSecretKey []byte
+	sessionMaxAge    int
+	totpSkew         int
+}
+
+// now returns the current time of the server clock.
+func (ctx *Context) now() time.Time {
+	return ctx.clock.Now()
+}
+
+// handlerFunc is the signature of the handlers served by ContextHandler.
+type handlerFunc func(*Context, http.ResponseWriter, *http.Request) (*response, error)
+
+// ContextHandler join context with handler signature
+type ContextHandler struct {
+	ctx *Context
+	H   handlerFunc
+	// format writes the responses, the native one when nil.
+	format apiFormat
+}
+
+// Our ServeHTTP method is mostly the same, and also has the ability to
+// access our *appContext's fields (templates, loggers, etc.) as well.
+func (ah ContextHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := ah.ctx
+	if t, ok := tenantFromContext(r.Context()); ok {
+		ctx = ctx.forTenant(t)
+	}
+	format := ah.format
+	if format == nil {
+		format = nativeFormat{}
+	}
+	resp, err := ah.H(ctx, w, r)
+	if err != nil {
+		format.writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch resp.Status {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError:
+		// errors already shaped by the handler are written as they are.
+		if data, ok := resp.Data.(string); ok || resp.Data == nil {
+			format.writeError(w, r, resp.Status, data)
+			return
+		}
+	}
+
+	format.writeResponse(w, r, resp)
+}
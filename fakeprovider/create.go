@@ -0,0 +1,44 @@
+package fakeprovider
+
+import (
+	"net/http"
+
+	"github.com/rodrwan/fakeproviders/logger"
+)
+
+type createRequestData struct {
+	user
+}
+
+func create(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	var create createRequestData
+
+	defer r.Body.Close()
+	if err := unmarshalJSON(r.Body, &create); err != nil {
+		logger.FromContext(r.Context()).WithError(err).Error("invalid request body")
+		return nil, err
+	}
+
+	if ctx.store.find(r.Context(), byEmail(create.Email)) != nil {
+		return nil, errUserHasCard
+	}
+
+	c, err := newCard(ctx.keyring, &create.user, ctx.now())
+	if err != nil {
+		return nil, err
+	}
+	ctx.simulateProcessing(r, ctx.chaos.get().CreateDelay)
+
+	if err := randomError(ctx, r); err != nil {
+		return nil, err
+	}
+	if err := ctx.store.add(r.Context(), c); err != nil {
+		return nil, err
+	}
+
+	return &response{
+		Status: http.StatusCreated,
+		Data:   c,
+	}, nil
+
+}
@@ -0,0 +1,33 @@
+package fakeprovider
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/rodrwan/fakeproviders/logger"
+)
+
+// deleteCardHandler soft deletes a card: it is kept, with its ledger, and
+// still returned by GET /cards/:id, but it is left out of the listings and
+// can't be loaded, patched nor revealed. Its user may then get a new card.
+func deleteCardHandler(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	id, ok := r.Context().Value("id").(string)
+	if !ok {
+		return nil, errors.New("missing id")
+	}
+
+	c := ctx.store.update(r.Context(), byID(id), func(c *card) {
+		now := ctx.now()
+		c.DeletedAt = &now
+		c.UpdatedAt = now
+	})
+	if c == nil {
+		return &response{Status: http.StatusNotFound}, nil
+	}
+	logger.FromContext(r.Context()).WithField("card_id", c.ID).Info("card deleted")
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   c,
+	}, nil
+}
@@ -0,0 +1,95 @@
+package fakeprovider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/clock"
+	"github.com/rodrwan/fakeproviders/logger"
+)
+
+// cardExpirySweepInterval is how often, in clock time, expired cards are
+// looked for.
+const cardExpirySweepInterval = time.Hour
+
+// expiresAt returns when a card with the given MM/YY expiry date stops
+// being valid, which is the end of that month.
+func expiresAt(expDate string) (time.Time, error) {
+	var month, year int
+	if _, err := fmt.Sscanf(expDate, "%02d/%02d", &month, &year); err != nil || month < 1 || month > 12 {
+		return time.Time{}, fmt.Errorf("invalid expiry date %q", expDate)
+	}
+	return time.Date(2000+year, time.Month(month)+1, 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+// expireCards marks the active and blocked cards past their expiry date as
+// expired.
+func (ctx *Context) expireCards(c context.Context) (int, error) {
+	now := ctx.now()
+
+	expired := 0
+	_, err := ctx.store.updateAll(c, func(card *card) error {
+		if card.Status != cardStatusActive && card.Status != cardStatusBlocked {
+			return nil
+		}
+		secrets, err := card.Reveal(ctx.keyring)
+		if err != nil {
+			return err
+		}
+		exp, err := expiresAt(secrets.ExpDate)
+		if err != nil || now.Before(exp) {
+			// imported cards may have any expiry date, those are skipped.
+			return nil
+		}
+		card.SetStatus(cardStatusExpired)
+		card.UpdatedAt = now
+		expired++
+		return nil
+	})
+	return expired, err
+}
+
+// expirySweeper runs expireCards every cardExpirySweepInterval of the
+// server clock.
+type expirySweeper struct {
+	ctx *Context
+
+	mu      sync.Mutex
+	timer   clock.Timer
+	stopped bool
+}
+
+func startExpirySweeper(ctx *Context) *expirySweeper {
+	s := &expirySweeper{ctx: ctx}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timer = ctx.clock.AfterFunc(cardExpirySweepInterval, s.run)
+	return s
+}
+
+func (s *expirySweeper) run() {
+	for _, t := range s.ctx.tenants.list() {
+		n, err := s.ctx.forTenant(t).expireCards(context.Background())
+		l := logger.FromContext(context.Background()).WithField("tenant", t.id)
+		if err != nil {
+			l.WithError(err).Error("could not sweep expired cards")
+		} else if n > 0 {
+			l.WithField("cards", n).Info("cards expired")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped {
+		s.timer = s.ctx.clock.AfterFunc(cardExpirySweepInterval, s.run)
+	}
+}
+
+func (s *expirySweeper) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	s.timer.Stop()
+}
@@ -0,0 +1,205 @@
+package fakeprovider
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits of the card listing page size.
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// Sort orders of the card listing, a leading - sorts in descending order.
+const (
+	sortCreatedAt = "created_at"
+	sortBalance   = "balance"
+)
+
+// cardFilter selects the listed cards, empty fields match every card.
+type cardFilter struct {
+	Email       string     `json:"email,omitempty"`
+	Status      []string   `json:"status,omitempty"`
+	ReferenceID string     `json:"reference_id,omitempty"`
+	CreatedGTE  *time.Time `json:"created_gte,omitempty"`
+	CreatedLTE  *time.Time `json:"created_lte,omitempty"`
+}
+
+func (f *cardFilter) match(c *card) bool {
+	if c.deleted() {
+		return false
+	}
+	if f.Email != "" && (c.User == nil || !strings.EqualFold(c.User.Email, f.Email)) {
+		return false
+	}
+	if len(f.Status) > 0 && !containsString(f.Status, c.Status) {
+		return false
+	}
+	if f.ReferenceID != "" && c.ReferenceID != f.ReferenceID {
+		return false
+	}
+	if f.CreatedGTE != nil && c.CreatedAt.Before(*f.CreatedGTE) {
+		return false
+	}
+	if f.CreatedLTE != nil && c.CreatedAt.After(*f.CreatedLTE) {
+		return false
+	}
+	return true
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// listMeta describes a page of the card listing.
+type listMeta struct {
+	HasMore       bool       `json:"has_more"`
+	Limit         int        `json:"limit"`
+	StartingAfter string     `json:"starting_after,omitempty"`
+	Sort          string     `json:"sort"`
+	Filters       cardFilter `json:"filters"`
+	// Total is the number of cards matching the filters, on every page.
+	Total int `json:"total"`
+}
+
+// parseListQuery reads the paging, filtering and sorting parameters.
+func parseListQuery(q url.Values) (*listMeta, error) {
+	meta := &listMeta{
+		Limit:         defaultListLimit,
+		StartingAfter: q.Get("starting_after"),
+		Sort:          sortCreatedAt,
+		Filters: cardFilter{
+			Email:       q.Get("email"),
+			ReferenceID: q.Get("reference_id"),
+		},
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return nil, errors.New("limit must be between 1 and " + strconv.Itoa(maxListLimit))
+		}
+		meta.Limit = limit
+	}
+	if v := q.Get("sort"); v != "" {
+		switch strings.TrimPrefix(v, "-") {
+		case sortCreatedAt, sortBalance:
+		default:
+			return nil, errors.New("invalid sort " + v + ", use created_at or balance")
+		}
+		meta.Sort = v
+	}
+	if v := q.Get("status"); v != "" {
+		for _, status := range strings.Split(v, ",") {
+			if !validCardStatus(status) {
+				return nil, errors.New("invalid card status " + status)
+			}
+			meta.Filters.Status = append(meta.Filters.Status, status)
+		}
+	}
+	for name, dst := range map[string]**time.Time{
+		"created_gte": &meta.Filters.CreatedGTE,
+		"created_lte": &meta.Filters.CreatedLTE,
+	} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, errors.New(name + " must be an RFC 3339 time")
+		}
+		*dst = &t
+	}
+	return meta, nil
+}
+
+// sortCards sorts cards in the given order. Cards with equal keys keep the order
+// they were created in, so the cursors are stable.
+func sortCards(cards []*card, order string) {
+	desc := strings.HasPrefix(order, "-")
+	less := func(a, b *card) bool { return a.CreatedAt.Before(b.CreatedAt) }
+	if strings.TrimPrefix(order, "-") == sortBalance {
+		less = func(a, b *card) bool { return a.Balance < b.Balance }
+	}
+	sort.SliceStable(cards, func(i, j int) bool {
+		if desc {
+			return less(cards[j], cards[i])
+		}
+		return less(cards[i], cards[j])
+	})
+}
+
+// getCardByIDHandler returns a card, deleted ones included.
+func getCardByIDHandler(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	id, ok := r.Context().Value("id").(string)
+	if !ok {
+		return nil, errors.New("missing id")
+	}
+
+	c := ctx.store.find(r.Context(), byIDWithDeleted(id))
+	if c == nil {
+		return &response{Status: http.StatusNotFound}, nil
+	}
+	w.Header().Set("Last-Modified", c.UpdatedAt.UTC().Format(http.TimeFormat))
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   c,
+	}, nil
+}
+
+// getAllCardsHandler lists the cards a page at a time. The next page starts
+// after the last card of the previous one, given in starting_after.
+func getAllCardsHandler(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	meta, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+
+	cards := ctx.store.list(r.Context())
+	matching := make([]*card, 0, len(cards))
+	for _, c := range cards {
+		if meta.Filters.match(c) {
+			matching = append(matching, c)
+		}
+	}
+	sortCards(matching, meta.Sort)
+	meta.Total = len(matching)
+
+	page := matching
+	if meta.StartingAfter != "" {
+		start := -1
+		for i, c := range matching {
+			if c.ID == meta.StartingAfter {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return &response{Status: http.StatusBadRequest, Data: "unknown starting_after card " + meta.StartingAfter}, nil
+		}
+		page = matching[start:]
+	}
+	if len(page) > meta.Limit {
+		page = page[:meta.Limit]
+		meta.HasMore = true
+	}
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   page,
+		Meta:   meta,
+	}, nil
+}
@@ -31,7 +31,8 @@
 //
 // As you can see just changes the signature of the method provided by httprouter, and
 // injects URI parameters in the request.Context.
-package main
+
+package fakeprovider
 
 import (
 	"net/http"
@@ -39,6 +40,8 @@ import (
 	"context"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/rodrwan/fakeproviders/logger"
+	"github.com/rodrwan/fakeproviders/tracing"
 )
 
 // Router is a http.Handler which can be used to dispatch requests to different
@@ -104,12 +107,13 @@ func (r *Router) DELETE(path string, handler http.Handler) {
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
 func (r *Router) Handle(method, path string, handler http.Handler) {
-	r.Router.Handle(method, path, r.wrapHandler(handler))
+	r.Router.Handle(method, path, r.wrapHandler(path, handler))
 }
 
-func (r *Router) wrapHandler(h http.Handler) httprouter.Handle {
+func (r *Router) wrapHandler(path string, h http.Handler) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
-		ctx := r.Context()
+		ctx := logger.WithRoute(r.Context(), path)
+		tracing.SetRoute(ctx, r.Method, path)
 		for _, p := range params {
 			ctx = context.WithValue(ctx, p.Key, p.Value)
 		}
@@ -0,0 +1,413 @@
+package fakeprovider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rodrwan/fakeproviders/iso8583"
+	"github.com/rodrwan/fakeproviders/logger"
+	"github.com/rodrwan/fakeproviders/requestid"
+	"github.com/rodrwan/fakeproviders/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DefaultISO8583CVVField is the field carrying the CVV when
+// ISO8583.CVVField is zero.
+const DefaultISO8583CVVField = 48
+
+// Response codes of the ISO 8583 responses.
+const (
+	isoApproved           = "00"
+	isoDoNotHonor         = "05"
+	isoInvalidTransaction = "12"
+	isoInvalidAmount      = "13"
+	isoInvalidCard        = "14"
+	isoNoOriginal         = "25"
+	isoFormatError        = "30"
+	isoInsufficientFunds  = "51"
+	isoExpiredCard        = "54"
+	isoRestrictedCard     = "62"
+	isoBadCVV             = "82"
+	isoIssuerUnavailable  = "91"
+	isoSystemError        = "96"
+)
+
+// MTIs of the handled requests.
+const (
+	isoAuthorization     = "0100"
+	isoFinancial         = "0200"
+	isoReversal          = "0400"
+	isoNetworkManagement = "0800"
+)
+
+// iso8583Channel is the channel of the authorizations received over ISO
+// 8583.
+const iso8583Channel = "iso8583"
+
+// Metadata keys of the authorizations received over ISO 8583, their
+// reversals find them by the original data elements or the retrieval
+// reference number.
+const (
+	isoMetaMTI           = "iso8583_mti"
+	isoMetaSTAN          = "iso8583_stan"
+	isoMetaTransmittedAt = "iso8583_transmitted_at"
+	isoMetaRRN           = "iso8583_rrn"
+	isoMetaTerminalID    = "iso8583_terminal_id"
+)
+
+// isoEchoedFields are copied from the requests to their responses.
+var isoEchoedFields = []int{2, 3, 4, 7, 11, 12, 13, 32, 37, 41, 42, 49, 70, 90}
+
+// isoCurrencies maps ISO 4217 numeric codes to the currencies of the
+// authorizations, unknown codes are kept as they are.
+var isoCurrencies = map[string]string{
+	"152": "clp",
+	"840": "usd",
+	"978": "eur",
+}
+
+// ISO8583 configures an ISO 8583 listener, see Server.ServeISO8583.
+type ISO8583 struct {
+	// Spec describes the messages, iso8583.DefaultSpec when nil.
+	Spec *iso8583.Spec
+	// Tenant owns the cards the messages are about, DefaultTenant when
+	// empty.
+	Tenant string
+	// CVVField carries the CVV, DefaultISO8583CVVField when zero. The CVV
+	// is only checked when present, card present requests go without.
+	CVVField int
+}
+
+func (cfg ISO8583) withDefaults() ISO8583 {
+	if cfg.Spec == nil {
+		cfg.Spec = iso8583.DefaultSpec()
+	}
+	if cfg.Tenant == "" {
+		cfg.Tenant = DefaultTenant
+	}
+	if cfg.CVVField == 0 {
+		cfg.CVVField = DefaultISO8583CVVField
+	}
+	return cfg
+}
+
+func (cfg ISO8583) validate() error {
+	if err := cfg.Spec.Validate(); err != nil {
+		return err
+	}
+	if !validTenantID.MatchString(cfg.Tenant) {
+		return errInvalidTenant
+	}
+	for _, n := range []int{38, 39, cfg.CVVField} {
+		if _, ok := cfg.Spec.Fields[n]; !ok {
+			return fmt.Errorf("field %d is missing from the ISO 8583 spec", n)
+		}
+	}
+	return nil
+}
+
+// ServeISO8583 accepts ISO 8583 connections on l and answers their
+// authorization (0100), financial (0200), reversal (0400) and network
+// management (0800) requests with the cards of the tenant, until l is
+// closed. The requests of a connection are handled concurrently.
+func (s *Server) ServeISO8583(l net.Listener, cfg ISO8583) error {
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveISO8583Conn(conn, cfg)
+	}
+}
+
+func (s *Server) serveISO8583Conn(conn net.Conn, cfg ISO8583) {
+	defer conn.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	l := logger.FromContext(context.Background()).WithField("remote_addr", conn.RemoteAddr().String())
+	var mu sync.Mutex
+	for {
+		b, err := cfg.Spec.ReadFrame(conn)
+		if err != nil {
+			if err != io.EOF {
+				l.WithError(err).Warn("ISO 8583 connection dropped")
+			}
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := s.handleISO8583(cfg, b)
+			if resp == nil {
+				return
+			}
+			out, err := cfg.Spec.Pack(resp)
+			if err != nil {
+				l.WithError(err).Error("could not pack ISO 8583 response")
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err := cfg.Spec.WriteFrame(conn, out); err != nil {
+				l.WithError(err).Warn("could not write ISO 8583 response")
+			}
+		}()
+	}
+}
+
+// handleISO8583 answers a request, it returns nil when there's nothing to
+// answer.
+func (s *Server) handleISO8583(cfg ISO8583, b []byte) *iso8583.Message {
+	c := requestid.NewContext(context.Background(), newID())
+	c, span := tracing.Start(c, "iso8583.message")
+	defer span.End()
+	l := logger.FromContext(c)
+
+	req, err := cfg.Spec.Unpack(b)
+	if err != nil {
+		l.WithError(err).Warn("invalid ISO 8583 message")
+		if len(b) < 4 || iso8583.ResponseMTI(string(b[:4])) == string(b[:4]) {
+			return nil
+		}
+		resp := iso8583.NewMessage(iso8583.ResponseMTI(string(b[:4])))
+		resp.Set(39, isoFormatError)
+		return resp
+	}
+	resp := iso8583.NewMessage(iso8583.ResponseMTI(req.MTI))
+	if resp.MTI == req.MTI {
+		l.WithField("mti", req.MTI).Warn("unexpected ISO 8583 message")
+		return nil
+	}
+	for _, n := range isoEchoedFields {
+		if req.Has(n) {
+			resp.Set(n, req.Get(n))
+		}
+	}
+	span.SetAttributes(attribute.String("iso8583.mti", req.MTI))
+
+	t, err := s.ctx.tenants.get(cfg.Tenant)
+	if err != nil {
+		l.WithError(err).Error("could not load the ISO 8583 tenant")
+		resp.Set(39, isoSystemError)
+		return resp
+	}
+	ctx := s.ctx.forTenant(t)
+
+	code := isoInvalidTransaction
+	switch req.MTI {
+	case isoAuthorization, isoFinancial:
+		code = ctx.iso8583Authorize(c, cfg, req, resp)
+	case isoReversal:
+		code = ctx.iso8583Reverse(c, req)
+	case isoNetworkManagement:
+		code = isoApproved
+	}
+	resp.Set(39, code)
+	ctx.metrics.iso8583Handled(req.MTI, code)
+	l.WithField("tenant", ctx.tenant).
+		WithField("mti", req.MTI).
+		WithField("stan", req.Get(11)).
+		WithField("response_code", code).
+		Info("ISO 8583 message")
+	return resp
+}
+
+// iso8583Authorize decides on an authorization or financial request, the
+// financial ones are captured right away. It sets the approval code of resp
+// and returns the response code.
+func (ctx *Context) iso8583Authorize(c context.Context, cfg ISO8583, req, resp *iso8583.Message) string {
+	pan, expiry := req.Get(2), req.Get(14)
+	if track := req.Get(35); track != "" {
+		if i := strings.IndexAny(track, "=D"); i > 0 {
+			if pan == "" {
+				pan = track[:i]
+			}
+			if expiry == "" && len(track) >= i+5 {
+				expiry = track[i+1 : i+5]
+			}
+		}
+	}
+	if pan == "" {
+		return isoFormatError
+	}
+	amount, err := strconv.ParseInt(req.Get(4), 10, 64)
+	if err != nil || amount <= 0 {
+		return isoInvalidAmount
+	}
+	// only purchases and cash withdrawals take money from the card.
+	if code := req.Get(3); code != "" && !strings.HasPrefix(code, "00") && !strings.HasPrefix(code, "01") {
+		return isoInvalidTransaction
+	}
+
+	card, secrets, err := ctx.cardByPAN(c, pan)
+	switch {
+	case err != nil:
+		logger.FromContext(c).WithError(err).Error("could not reveal the cards")
+		return isoSystemError
+	case card == nil:
+		return isoInvalidCard
+	case expiry != "" && expiry != isoExpiry(secrets.ExpDate):
+		return isoExpiredCard
+	case req.Has(cfg.CVVField) && req.Get(cfg.CVVField) != secrets.CVV:
+		return isoBadCVV
+	}
+
+	currency := req.Get(49)
+	if code, ok := isoCurrencies[currency]; ok {
+		currency = code
+	}
+	a, err := ctx.authorize(c, authorizationRequest{
+		CardID:   card.ID,
+		Amount:   amount,
+		Currency: currency,
+		Merchant: isoMerchant(req),
+		Channel:  iso8583Channel,
+		Metadata: isoMetadata(req),
+		// the request id ties the ledger entries to the log lines.
+		RequestID: requestid.FromContext(c),
+	})
+	switch {
+	case err == errAuthorizationCardAbsent:
+		return isoInvalidCard
+	case err != nil:
+		return isoSystemError
+	case !a.Approved:
+		return isoDeclineCode(a.DeclineReason)
+	}
+	if req.MTI == isoFinancial {
+		if _, err := ctx.captureAuthorization(c, a.ID); err != nil {
+			return isoSystemError
+		}
+	}
+	resp.Set(38, randomStringNumber(6))
+	return isoApproved
+}
+
+// iso8583Reverse reverses the authorization or financial transaction a
+// reversal request is about. Reversing it again, or reversing a declined
+// one, is approved and changes nothing.
+func (ctx *Context) iso8583Reverse(c context.Context, req *iso8583.Message) string {
+	a := ctx.iso8583Original(c, req)
+	if a == nil {
+		return isoNoOriginal
+	}
+	if !a.Approved || a.Status == authorizationReversed {
+		return isoApproved
+	}
+	_, err := ctx.reverseAuthorization(c, a.ID, requestid.FromContext(c), true)
+	if err != nil && err != errAuthorizationNotPending {
+		return isoSystemError
+	}
+	return isoApproved
+}
+
+// iso8583Original returns the authorization a reversal request is about,
+// found by the MTI, STAN and transmission time of its original data
+// elements, or by its retrieval reference number. The latest one wins.
+func (ctx *Context) iso8583Original(c context.Context, req *iso8583.Message) *authorization {
+	var match func(map[string]string) bool
+	original, rrn := req.Get(90), req.Get(37)
+	switch {
+	case len(original) >= 20:
+		match = func(m map[string]string) bool {
+			return m[isoMetaMTI] == original[:4] &&
+				m[isoMetaSTAN] == original[4:10] &&
+				m[isoMetaTransmittedAt] == original[10:20]
+		}
+	case rrn != "":
+		match = func(m map[string]string) bool { return m[isoMetaRRN] == rrn }
+	default:
+		return nil
+	}
+
+	authorizations := ctx.store.authorizationList(c)
+	for i := len(authorizations) - 1; i >= 0; i-- {
+		a := authorizations[i]
+		if a.Channel == iso8583Channel && match(a.Metadata) {
+			return a
+		}
+	}
+	return nil
+}
+
+// cardByPAN returns the card with the given PAN and its secrets, the
+// deleted cards included, or nil.
+func (ctx *Context) cardByPAN(c context.Context, pan string) (*card, *revealedCard, error) {
+	for _, card := range ctx.store.list(c) {
+		secrets, err := card.Reveal(ctx.keyring)
+		if err != nil {
+			return nil, nil, err
+		}
+		if secrets.PAN == pan {
+			return card, secrets, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// isoExpiry turns the MM/YY expiry date of a card to the YYMM of ISO 8583.
+func isoExpiry(expDate string) string {
+	parts := strings.SplitN(expDate, "/", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1] + parts[0]
+}
+
+// isoMerchant reads the card acceptor name and location of field 43: the
+// name, the city, the state and the country.
+func isoMerchant(req *iso8583.Message) merchant {
+	m := merchant{Category: req.Get(18)}
+	location := req.Get(43)
+	if len(location) < 40 {
+		m.Name = strings.TrimSpace(location)
+		return m
+	}
+	m.Name = strings.TrimSpace(location[:23])
+	m.City = strings.TrimSpace(location[23:36])
+	m.Country = strings.TrimSpace(location[38:40])
+	return m
+}
+
+func isoMetadata(req *iso8583.Message) map[string]string {
+	metadata := map[string]string{isoMetaMTI: req.MTI}
+	for key, n := range map[string]int{
+		isoMetaSTAN:          11,
+		isoMetaTransmittedAt: 7,
+		isoMetaRRN:           37,
+		isoMetaTerminalID:    41,
+	} {
+		if req.Has(n) {
+			metadata[key] = req.Get(n)
+		}
+	}
+	return metadata
+}
+
+// isoDeclineCode returns the response code of a decline reason.
+func isoDeclineCode(reason string) string {
+	switch reason {
+	case declineInsufficientFunds:
+		return isoInsufficientFunds
+	case declineCardExpired:
+		return isoExpiredCard
+	case declineCardInactive:
+		return isoRestrictedCard
+	case jitTimeout:
+		return isoIssuerUnavailable
+	case jitError:
+		return isoSystemError
+	}
+	return isoDoNotHonor
+}
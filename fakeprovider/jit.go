@@ -0,0 +1,330 @@
+package fakeprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/logger"
+	"github.com/rodrwan/fakeproviders/requestid"
+	"github.com/rodrwan/fakeproviders/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Decisions applied when the JIT endpoint doesn't decide in time.
+const (
+	JITApprove = "approve"
+	JITDecline = "decline"
+)
+
+// DefaultJITTimeout is how long an authorization waits for the JIT endpoint
+// when JIT.Timeout is zero.
+const DefaultJITTimeout = 2 * time.Second
+
+// JITSignatureHeader signs the requests to the JIT endpoint when JIT.Secret
+// is set, as t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">.
+const JITSignatureHeader = "X-Fakeprovider-Signature"
+
+// Reasons of the decisions taken in JIT mode.
+const (
+	jitApproved = "webhook_approved"
+	jitDeclined = "webhook_declined"
+	jitTimeout  = "webhook_timeout"
+	jitError    = "webhook_error"
+)
+
+// JIT configures the just-in-time funding mode: every authorization of an
+// active card is decided by an endpoint of the program manager, called
+// synchronously. The approved authorizations are funded when the balance of
+// the card falls short. The zero value disables it.
+type JIT struct {
+	// URL receives the authorizations as JSON POST requests, empty disables
+	// the JIT mode.
+	URL string `json:"url"`
+	// Timeout bounds the wait for a decision, DefaultJITTimeout when zero.
+	Timeout Duration `json:"timeout,omitempty"`
+	// Default is the decision when the endpoint times out or fails, approve
+	// or decline, the default.
+	Default string `json:"default,omitempty"`
+	// Secret signs the requests in JITSignatureHeader when set.
+	Secret string `json:"secret,omitempty"`
+}
+
+func (j JIT) validate() error {
+	if j.URL != "" {
+		u, err := url.Parse(j.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid JIT url %q", j.URL)
+		}
+	}
+	if j.Timeout < 0 {
+		return errors.New("the JIT timeout can't be negative")
+	}
+	switch j.Default {
+	case "", JITApprove, JITDecline:
+	default:
+		return fmt.Errorf("invalid JIT default %q, use approve or decline", j.Default)
+	}
+	return nil
+}
+
+func (j JIT) timeout() time.Duration {
+	if j.Timeout == 0 {
+		return DefaultJITTimeout
+	}
+	return time.Duration(j.Timeout)
+}
+
+// jitSettings holds the JIT settings in use, which the admin API changes at
+// runtime.
+type jitSettings struct {
+	mu  sync.RWMutex
+	jit JIT
+}
+
+func (s *jitSettings) get() JIT {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.jit
+}
+
+func (s *jitSettings) set(j JIT) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jit = j
+}
+
+// jitRequest is the body of the requests to the JIT endpoint, which answers
+// with a jitResponse.
+type jitRequest struct {
+	AuthorizationID string    `json:"authorization_id"`
+	Tenant          string    `json:"tenant"`
+	CardID          string    `json:"card_id"`
+	ReferenceID     string    `json:"reference_id"`
+	Amount          int64     `json:"amount"`
+	Currency        string    `json:"currency"`
+	Balance         int64     `json:"balance"`
+	Merchant        merchant  `json:"merchant"`
+	Channel         string    `json:"channel,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type jitResponse struct {
+	Approved *bool `json:"approved"`
+}
+
+// jitOutcome tells how an authorization was decided in JIT mode.
+type jitOutcome struct {
+	// Reason is webhook_approved, webhook_declined, webhook_timeout or
+	// webhook_error, the last two applying the default decision.
+	Reason string `json:"reason"`
+	// Status is the status of the response of the endpoint, if any.
+	Status  int      `json:"status,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Latency Duration `json:"latency"`
+	// Funded is the amount added to the balance of the card to cover the
+	// authorization.
+	Funded int64 `json:"funded,omitempty"`
+}
+
+// jitClient calls the JIT endpoints, the requests are bounded by the JIT
+// timeout.
+var jitClient = &http.Client{}
+
+// askJIT asks the JIT endpoint to decide on a, it waits up to the JIT
+// timeout.
+func (ctx *Context) askJIT(c context.Context, j JIT, a *authorization, card *card) *jitOutcome {
+	c, span := tracing.Start(c, "jit.decision", attribute.String("jit.url", j.URL))
+	defer span.End()
+
+	body, err := json.Marshal(jitRequest{
+		AuthorizationID: a.ID,
+		Tenant:          ctx.tenant,
+		CardID:          card.ID,
+		ReferenceID:     card.ReferenceID,
+		Amount:          a.Amount,
+		Currency:        a.Currency,
+		Balance:         card.Balance,
+		Merchant:        a.Merchant,
+		Channel:         a.Channel,
+		CreatedAt:       a.CreatedAt,
+	})
+	if err != nil {
+		return &jitOutcome{Reason: jitError, Error: err.Error()}
+	}
+
+	rc, cancel := context.WithTimeout(c, j.timeout())
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, j.URL, bytes.NewReader(body))
+	if err != nil {
+		return &jitOutcome{Reason: jitError, Error: err.Error()}
+	}
+	req = req.WithContext(rc)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(requestid.HeaderKey, requestid.FromContext(c))
+	req.Header.Set(TenantHeader, ctx.tenant)
+	if j.Secret != "" {
+		req.Header.Set(JITSignatureHeader, webhookSignature(j.Secret, time.Now(), body))
+	}
+
+	start := time.Now()
+	out := &jitOutcome{}
+	defer func() {
+		out.Latency = Duration(time.Since(start))
+		span.SetAttributes(attribute.String("jit.reason", out.Reason))
+	}()
+	resp, err := jitClient.Do(req)
+	if err != nil {
+		out.Reason = jitError
+		if rc.Err() == context.DeadlineExceeded {
+			out.Reason = jitTimeout
+		}
+		out.Error = err.Error()
+		return out
+	}
+	defer resp.Body.Close()
+
+	out.Status = resp.StatusCode
+	var decision jitResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&decision); err != nil && rc.Err() == context.DeadlineExceeded {
+		out.Reason = jitTimeout
+		out.Error = err.Error()
+		return out
+	}
+	switch {
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		out.Reason = jitError
+		out.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	case decision.Approved == nil:
+		out.Reason = jitError
+		out.Error = `the response has no "approved" boolean`
+	case *decision.Approved:
+		out.Reason = jitApproved
+	default:
+		out.Reason = jitDeclined
+	}
+	return out
+}
+
+// authorizeJIT decides on a in JIT mode and records it. The endpoint is only
+// called for the cards able to pay, the approved authorizations are funded
+// and every decision of the endpoint is recorded in the ledger.
+func (ctx *Context) authorizeJIT(c context.Context, j JIT, req authorizationRequest, a *authorization) (*authorization, error) {
+	current := ctx.store.find(c, byIDWithDeleted(req.CardID))
+	if current == nil {
+		return nil, errAuthorizationCardAbsent
+	}
+	if a.DeclineReason = cardDeclineReason(current); a.DeclineReason != "" {
+		a.Status = authorizationClosed
+		ctx.store.addAuthorization(c, a)
+		return a.clone(), nil
+	}
+
+	out := ctx.askJIT(c, j, a, current)
+	a.JIT = out
+	ctx.metrics.jitDecided(out.Reason)
+	l := logger.FromContext(c).WithField("jit", out.Reason).WithField("latency", time.Duration(out.Latency).String())
+	if out.Error != "" {
+		l = l.WithField("error", out.Error)
+	}
+	l.Info("JIT decision")
+
+	approved := out.Reason == jitApproved ||
+		(out.Reason != jitDeclined && j.Default == JITApprove)
+	now := ctx.now()
+	entry := ledgerEntry{
+		Type:            ledgerAuthorization,
+		AuthorizationID: a.ID,
+		Description:     req.Merchant.Name,
+		Decision:        out.Reason,
+		RequestID:       req.RequestID,
+		CreatedAt:       now,
+	}
+	if !approved {
+		a.DeclineReason = out.Reason
+		a.Status = authorizationClosed
+		ctx.store.recordDecision(c, req.CardID, entry)
+		ctx.store.addAuthorization(c, a)
+		return a.clone(), nil
+	}
+
+	funding := entry
+	funding.Type = ledgerJITFunding
+	ctx.store.adjustBalance(c, byIDWithDeleted(req.CardID), entry, func(card *card) {
+		// the card may have changed while the endpoint was deciding, it is
+		// only funded when it can still pay.
+		if a.DeclineReason = cardDeclineReason(card); a.DeclineReason != "" {
+			return
+		}
+		if card.Balance < req.Amount {
+			out.Funded = req.Amount - card.Balance
+			card.Balance = req.Amount
+			ctx.store.appendEntry(card, funding, out.Funded)
+		}
+		card.Balance -= req.Amount
+		card.UpdatedAt = now
+	})
+	a.Approved = a.DeclineReason == ""
+	a.Status = authorizationPending
+	if !a.Approved {
+		a.Status = authorizationClosed
+	}
+	ctx.store.addAuthorization(c, a)
+	return a.clone(), nil
+}
+
+// recordDecision records a decision that leaves the balance of a card as is.
+func (s *store) recordDecision(ctx context.Context, cardID string, entry ledgerEntry) {
+	_, span := tracing.Start(ctx, "store.record_decision")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.cards {
+		if c.ID != cardID {
+			continue
+		}
+		s.appendEntry(c, entry, 0)
+		return
+	}
+}
+
+// getJIT returns the JIT settings.
+func getJIT(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	return &response{
+		Status: http.StatusOK,
+		Data:   ctx.jit.get(),
+	}, nil
+}
+
+// setJIT replaces the JIT settings, an empty url disables the JIT mode.
+func setJIT(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	var j JIT
+	if err := json.Unmarshal(body, &j); err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+	if err := j.validate(); err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+
+	ctx.jit.set(j)
+	logger.FromContext(r.Context()).WithField("jit_url", j.URL).Info("JIT settings changed")
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   j,
+	}, nil
+}
@@ -0,0 +1,165 @@
+package fakeprovider
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/rodrwan/fakeproviders/logger"
+	"github.com/rodrwan/fakeproviders/vault"
+)
+
+// newKeyring builds the keyring used to encrypt card data at rest. When no
+// keys are configured a random one is generated, which means cards can't be
+// decrypted once the process exits.
+func newKeyring(spec string) (*vault.Keyring, error) {
+	if spec != "" {
+		return vault.ParseKeyring(spec)
+	}
+
+	log.Println("no key-encryption key configured, generating a temporary one")
+	key, err := vault.NewKey()
+	if err != nil {
+		return nil, err
+	}
+
+	kr := vault.NewKeyring()
+	if err := kr.Add("local", key, true); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+type rotateKeysRequestData struct {
+	KeyID string `json:"key_id"`
+	// Key is the base64 encoded new key-encryption key, a random one is
+	// generated when empty.
+	Key string `json:"key"`
+}
+
+// rotateKeys makes a new key-encryption key the primary one and re-wraps the
+// data key of every card with it, in every tenant since they share the
+// keyring, and of the envelopes of the startup snapshot.
+func rotateKeys(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	var rotate rotateKeysRequestData
+
+	defer r.Body.Close()
+	if r.ContentLength != 0 {
+		if err := unmarshalJSON(r.Body, &rotate); err != nil {
+			return nil, err
+		}
+	}
+
+	if rotate.KeyID == "" {
+		rotate.KeyID = "kek-" + newID()
+	}
+
+	var key []byte
+	if rotate.Key == "" {
+		k, err := vault.NewKey()
+		if err != nil {
+			return nil, err
+		}
+		key = k
+	} else {
+		k, err := base64.StdEncoding.DecodeString(rotate.Key)
+		if err != nil {
+			return &response{
+				Status: http.StatusBadRequest,
+				Data:   "key must be base64 encoded",
+			}, nil
+		}
+		key = k
+	}
+
+	if err := ctx.keyring.Add(rotate.KeyID, key, true); err != nil {
+		return &response{
+			Status: http.StatusBadRequest,
+			Data:   err.Error(),
+		}, nil
+	}
+
+	rewrapped := 0
+	for _, t := range ctx.tenants.list() {
+		n, err := t.store.updateAll(r.Context(), func(c *card) error {
+			env, err := ctx.keyring.Rewrap(c.secrets)
+			if err != nil {
+				return err
+			}
+			c.secrets = env
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		rewrapped += n
+	}
+	// so does the startup snapshot, which resets restore.
+	n, err := ctx.seedState.rewrap(ctx.keyring)
+	if err != nil {
+		return nil, err
+	}
+	rewrapped += n
+
+	return &response{
+		Status: http.StatusOK,
+		Data: struct {
+			KeyID     string `json:"key_id"`
+			Rewrapped int    `json:"rewrapped"`
+		}{
+			KeyID:     rotate.KeyID,
+			Rewrapped: rewrapped,
+		},
+	}, nil
+}
+
+// removeKey drops a key-encryption key once no card of any tenant nor the
+// startup snapshot is sealed with it, rotateKeys re-wraps them.
+func removeKey(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	id, ok := r.Context().Value("id").(string)
+	if !ok {
+		return nil, errors.New("missing id")
+	}
+
+	if id == ctx.keyring.Primary() {
+		return &response{Status: http.StatusBadRequest, Data: vault.ErrPrimaryKey.Error()}, nil
+	}
+	if n := ctx.sealedWith(r.Context(), id); n > 0 {
+		return &response{
+			Status: http.StatusConflict,
+			Data:   fmt.Sprintf("key %s still seals %d records, rotate the keys first", id, n),
+		}, nil
+	}
+	switch err := ctx.keyring.Remove(id); err {
+	case nil:
+	case vault.ErrUnknownKey:
+		return &response{Status: http.StatusNotFound}, nil
+	case vault.ErrPrimaryKey:
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	default:
+		return nil, err
+	}
+	logger.FromContext(r.Context()).WithField("key_id", id).Info("key-encryption key removed")
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   "key removed",
+	}, nil
+}
+
+// sealedWith counts the card secrets of every tenant and the envelopes of the
+// startup snapshot sealed with the key-encryption key id.
+func (ctx *Context) sealedWith(c context.Context, id string) int {
+	n := 0
+	for _, t := range ctx.tenants.list() {
+		for _, card := range t.store.dump(c).cards {
+			if card.secrets != nil && card.secrets.KeyID == id {
+				n++
+			}
+		}
+	}
+	return n + ctx.seedState.sealedWith(id)
+}
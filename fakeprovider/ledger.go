@@ -0,0 +1,94 @@
+package fakeprovider
+
+import (
+	"context"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/tracing"
+)
+
+// Types of the ledger entries.
+const (
+	ledgerLoad       = "load"
+	ledgerPurchase   = "purchase"
+	ledgerAdjustment = "adjustment"
+	// ledgerAuthorization holds the amount of an approved authorization and
+	// ledgerReversal releases it.
+	ledgerAuthorization = "authorization"
+	ledgerReversal      = "reversal"
+	// ledgerJITFunding adds to the balance what an authorization approved by
+	// the JIT endpoint lacks.
+	ledgerJITFunding = "jit_funding"
+)
+
+// ledgerEntry records a change of the balance of a card.
+type ledgerEntry struct {
+	ID     string `json:"id"`
+	CardID string `json:"card_id"`
+	Type   string `json:"type"`
+	Amount int64  `json:"amount"`
+	// Balance is the balance of the card after the entry.
+	Balance     int64  `json:"balance"`
+	Description string `json:"description,omitempty"`
+	// AuthorizationID is the authorization of the authorization and reversal
+	// entries.
+	AuthorizationID string `json:"authorization_id,omitempty"`
+	// Decision is the reason of the decision of the JIT endpoint on the
+	// authorization, a declined authorization records an entry of amount 0.
+	Decision  string    `json:"decision,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// adjustBalance applies fn to the first card matching and records the
+// change of its balance in the ledger. It returns the updated card, or nil
+// when no card matches.
+func (s *store) adjustBalance(ctx context.Context, match cardMatcher, entry ledgerEntry, fn func(*card)) *card {
+	_, span := tracing.Start(ctx, "store.adjust_balance")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.cards {
+		if !match(c) {
+			continue
+		}
+
+		before, recorded := c.Balance, len(s.ledger)
+		fn(c)
+		// fn may record changes of its own through appendEntry, entry only
+		// covers the change made after them.
+		if len(s.ledger) > recorded {
+			before = s.ledger[len(s.ledger)-1].Balance
+		}
+		if c.Balance != before {
+			s.appendEntry(c, entry, c.Balance-before)
+		}
+		return c.clone()
+	}
+	return nil
+}
+
+// appendEntry records a change of the balance of c by amount, s.mu must be
+// held.
+func (s *store) appendEntry(c *card, entry ledgerEntry, amount int64) {
+	entry.ID = newID()
+	entry.CardID = c.ID
+	entry.Amount = amount
+	entry.Balance = c.Balance
+	s.ledger = append(s.ledger, &entry)
+}
+
+// ledgerEntries returns the ledger, oldest entry first.
+func (s *store) ledgerEntries(ctx context.Context) []ledgerEntry {
+	_, span := tracing.Start(ctx, "store.list_ledger")
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]ledgerEntry, len(s.ledger))
+	for i, e := range s.ledger {
+		entries[i] = *e
+	}
+	return entries
+}
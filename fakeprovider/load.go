@@ -1,9 +1,9 @@
-package main
+package fakeprovider
 
 import (
-	"log"
 	"net/http"
-	"time"
+
+	"github.com/rodrwan/fakeproviders/requestid"
 )
 
 type loadRequestData struct {
@@ -18,18 +18,16 @@ func loadHandler(ctx *Context, w http.ResponseWriter, r *http.Request) (*respons
 		return nil, err
 	}
 
-	processTime := randomProcessTime(minLoadProcessTime, maxLoadProcessTime) * time.Second
-	log.Printf("Waiting for %.2fs", processTime.Seconds())
-	time.Sleep(processTime)
-
-	var selectedCard *card
-	for _, card := range ctx.cards {
-		if card.ReferenceID == load.ReferenceID {
-			card.Balance += load.Amount
-			selectedCard = card
-			break
-		}
+	ctx.simulateProcessing(r, ctx.chaos.get().LoadDelay)
+
+	entry := ledgerEntry{
+		Type:      ledgerLoad,
+		RequestID: requestid.FromContext(r.Context()),
+		CreatedAt: ctx.now(),
 	}
+	selectedCard := ctx.store.adjustBalance(r.Context(), byReferenceID(load.ReferenceID), entry, func(c *card) {
+		c.Balance += load.Amount
+	})
 
 	if selectedCard == nil {
 		return &response{
@@ -1,4 +1,4 @@
-package main
+package fakeprovider
 
 import (
 	"encoding/json"
@@ -13,6 +13,7 @@ func createSession(ctx *Context, w http.ResponseWriter, r *http.Request) (*respo
 	var payload struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		TOTPCode string `json:"totp_code"`
 	}
 
 	defer r.Body.Close()
@@ -32,8 +33,24 @@ func createSession(ctx *Context, w http.ResponseWriter, r *http.Request) (*respo
 		}, nil
 	}
 
+	if ctx.totp.enabled(ctx.userUUID) {
+		if payload.TOTPCode == "" {
+			return &response{
+				Status: http.StatusBadRequest,
+				Data:   "totp code required",
+			}, nil
+		}
+
+		if err := ctx.totp.verify(ctx.userUUID, payload.TOTPCode, false, ctx.now()); err != nil {
+			return &response{
+				Status: http.StatusBadRequest,
+				Data:   err.Error(),
+			}, nil
+		}
+	}
+
 	// create jwt
-	sess, err := jwt.NewSession(payload.Username, ctx.userUUID, r.Header.Get("Origin"))
+	sess, err := jwt.NewSessionAt(payload.Username, ctx.userUUID, r.Header.Get("Origin"), ctx.now())
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +58,7 @@ func createSession(ctx *Context, w http.ResponseWriter, r *http.Request) (*respo
 	sessSvc := jwt.SessionService{
 		SecretKey: ctx.sessionSecretKey,
 		MaxAge:    time.Duration(ctx.sessionMaxAge) * time.Second,
+		Now:       ctx.now,
 	}
 
 	creds, err := sessSvc.CreateSession(r.Context(), sess)
@@ -48,6 +66,20 @@ func createSession(ctx *Context, w http.ResponseWriter, r *http.Request) (*respo
 		return nil, err
 	}
 
+	// the token carries its own id, read it back to record the session.
+	issued, err := sessSvc.Session(r.Context(), creds)
+	if err != nil {
+		return nil, err
+	}
+	ctx.store.addSession(r.Context(), &sessionRecord{
+		ID:        issued.ID,
+		UserID:    issued.UserID,
+		Email:     issued.Email,
+		Origin:    issued.Origin,
+		CreatedAt: ctx.now(),
+		ExpiresAt: ctx.now().Add(sessSvc.MaxAge),
+	})
+
 	return &response{
 		Status: http.StatusCreated,
 		Data:   creds.AuthToken,
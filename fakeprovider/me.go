@@ -0,0 +1,193 @@
+package fakeprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/logger"
+	"github.com/rodrwan/fakeproviders/repository/jwt"
+)
+
+// authKeyTTL is how long a verification key can be used, in clock time.
+const authKeyTTL = 30 * time.Second
+
+const charset = "abcdefghijklmnopqrstuvwxyz" +
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+var seededRand *rand.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+func checkSession(ctx *Context, r *http.Request) (*jwt.Session, error) {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		return nil, errors.New("invalid token")
+	}
+
+	return ctx.session(r.Context(), strings.Replace(token, "Bearer ", "", -1))
+}
+
+// session returns the session of an auth token, which must be valid and
+// recorded by the store of the tenant.
+func (ctx *Context) session(c context.Context, token string) (*jwt.Session, error) {
+	sessSvc := jwt.SessionService{
+		SecretKey: ctx.sessionSecretKey,
+		MaxAge:    time.Duration(ctx.sessionMaxAge) * time.Second,
+		Now:       ctx.now,
+	}
+
+	sess, err := sessSvc.Session(c, &jwt.SessionCredentials{AuthToken: token})
+	if err != nil {
+		return nil, err
+	}
+	if !ctx.store.hasSession(c, sess.ID) {
+		return nil, errors.New("unknown session")
+	}
+
+	return sess, nil
+}
+
+func me(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	sess, err := checkSession(ctx, r)
+	if err != nil {
+		return &response{
+			Data:   err.Error(),
+			Status: http.StatusUnauthorized,
+		}, nil
+	}
+
+	userCard := ctx.store.find(r.Context(), byID(sess.UserID))
+
+	return &response{
+		Data:   userCard,
+		Status: http.StatusOK,
+	}, nil
+}
+
+func verify(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	sess, err := checkSession(ctx, r)
+	if err != nil {
+		return &response{
+			Data:   err.Error(),
+			Status: http.StatusUnauthorized,
+		}, nil
+	}
+
+	authKey := StringWithCharset(12, charset)
+	ctx.store.setAuthKey(r.Context(), sess.UserID, authKey, ctx.now().Add(authKeyTTL))
+
+	userID := sess.UserID
+	ctx.clock.AfterFunc(authKeyTTL, func() {
+		ctx.store.deleteAuthKey(userID, authKey)
+		logger.FromContext(context.Background()).
+			WithField("tenant", ctx.tenant).
+			WithField("user_id", userID).
+			Debug("verification key expired")
+	})
+
+	return &response{
+		Data:   authKey,
+		Status: http.StatusCreated,
+	}, nil
+}
+
+func getCard(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	sess, err := checkSession(ctx, r)
+	if err != nil {
+		return &response{
+			Data:   err.Error(),
+			Status: http.StatusUnauthorized,
+		}, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	var payload struct {
+		VerificationToken string `json:"verification_token"`
+		TOTPCode          string `json:"totp_code"`
+		// PublicKey is an optional ephemeral public JWK, when present the
+		// card details are returned encrypted to it.
+		PublicKey json.RawMessage `json:"public_key"`
+	}
+
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	if payload.TOTPCode != "" {
+		if err := ctx.totp.verify(sess.UserID, payload.TOTPCode, false, ctx.now()); err != nil {
+			return &response{
+				Data:   err.Error(),
+				Status: http.StatusBadRequest,
+			}, nil
+		}
+	} else {
+		verificationToken := payload.VerificationToken
+		keyValue := ctx.store.authKey(r.Context(), sess.UserID)
+		if keyValue == "" {
+			return &response{
+				Data:   "a valid verification key must be provided",
+				Status: http.StatusBadRequest,
+			}, nil
+		}
+
+		if keyValue != verificationToken {
+			return &response{
+				Data:   "invalid verification token",
+				Status: http.StatusBadRequest,
+			}, nil
+		}
+	}
+
+	userCard := ctx.store.find(r.Context(), byID(sess.UserID))
+	if userCard == nil {
+		return &response{
+			Status: http.StatusNotFound,
+		}, nil
+	}
+
+	details, err := userCard.Reveal(ctx.keyring)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload.PublicKey) == 0 {
+		return &response{
+			Data:   details,
+			Status: http.StatusOK,
+		}, nil
+	}
+
+	jwe, err := encryptForClient(payload.PublicKey, details)
+	if err != nil {
+		return &response{
+			Data:   err.Error(),
+			Status: http.StatusBadRequest,
+		}, nil
+	}
+
+	return &response{
+		Data:   &encryptedCard{JWE: jwe},
+		Status: http.StatusOK,
+	}, nil
+}
+
+func StringWithCharset(length int, charset string) string {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = charset[seededRand.Intn(len(charset))]
+	}
+	return string(b)
+}
+
+func String(length int) string {
+	return StringWithCharset(length, charset)
+}
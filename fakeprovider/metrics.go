@@ -0,0 +1,169 @@
+package fakeprovider
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rodrwan/fakeproviders/logger"
+)
+
+const metricsNamespace = "fakeprovider"
+
+// metrics holds the Prometheus collectors of the service. They are
+// registered in their own registry instead of the global one.
+type metrics struct {
+	registry *prometheus.Registry
+
+	requests            *prometheus.CounterVec
+	requestDuration     *prometheus.HistogramVec
+	faultsInjected      *prometheus.CounterVec
+	simulatedDelay      *prometheus.HistogramVec
+	rateLimitRejections *prometheus.CounterVec
+	jitDecisions        *prometheus.CounterVec
+	iso8583Messages     *prometheus.CounterVec
+}
+
+func newMetrics(ctx *Context) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Number of handled HTTP requests.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of handled HTTP requests, including simulated delays.",
+			Buckets:   []float64{.005, .01, .05, .1, .5, 1, 2, 5, 10, 20},
+		}, []string{"route", "method"}),
+		faultsInjected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "faults_injected_total",
+			Help:      "Number of random errors injected.",
+		}, []string{"route"}),
+		simulatedDelay: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "simulated_delay_seconds",
+			Help:      "Simulated processing time applied to requests.",
+			Buckets:   prometheus.LinearBuckets(1, 1, 10),
+		}, []string{"route"}),
+		rateLimitRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rate_limit_rejections_total",
+			Help:      "Number of requests rejected by the rate limiter.",
+		}, []string{"route"}),
+		jitDecisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "jit_decisions_total",
+			Help:      "Number of authorizations decided by the JIT endpoint, by reason.",
+		}, []string{"reason"}),
+		iso8583Messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "iso8583_messages_total",
+			Help:      "Number of answered ISO 8583 requests, by MTI and response code.",
+		}, []string{"mti", "response_code"}),
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.faultsInjected,
+		m.simulatedDelay,
+		m.rateLimitRejections,
+		m.jitDecisions,
+		m.iso8583Messages,
+		&cardsCollector{ctx: ctx},
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// observeRequest is a logger.Observer recording every logged request.
+func (m *metrics) observeRequest(r *http.Request, status int, written int64, took time.Duration) {
+	route := routeLabel(r)
+	m.requests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(route, r.Method).Observe(took.Seconds())
+}
+
+func (m *metrics) faultInjected(r *http.Request) {
+	m.faultsInjected.WithLabelValues(routeLabel(r)).Inc()
+}
+
+func (m *metrics) delaySimulated(r *http.Request, d time.Duration) {
+	m.simulatedDelay.WithLabelValues(routeLabel(r)).Observe(d.Seconds())
+}
+
+func (m *metrics) rateLimited(r *http.Request) {
+	m.rateLimitRejections.WithLabelValues(routeLabel(r)).Inc()
+}
+
+func (m *metrics) jitDecided(reason string) {
+	m.jitDecisions.WithLabelValues(reason).Inc()
+}
+
+func (m *metrics) iso8583Handled(mti, code string) {
+	m.iso8583Messages.WithLabelValues(mti, code).Inc()
+}
+
+// routeLabel uses the route template so labels don't grow with card ids.
+func routeLabel(r *http.Request) string {
+	if route := logger.RouteFromContext(r.Context()); route != "" {
+		return route
+	}
+	return "unmatched"
+}
+
+var (
+	cardsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "cards"),
+		"Number of cards by tenant and status, deleted cards excluded.",
+		[]string{"tenant", "status"}, nil,
+	)
+	balanceDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "cards_balance_total"),
+		"Sum of the balance of every card by tenant, deleted cards excluded.",
+		[]string{"tenant"}, nil,
+	)
+)
+
+// cardsCollector exposes domain gauges computed from the cards at scrape
+// time.
+type cardsCollector struct {
+	ctx *Context
+}
+
+func (c *cardsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cardsDesc
+	ch <- balanceDesc
+}
+
+func (c *cardsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, t := range c.ctx.tenants.list() {
+		byStatus := make(map[string]int)
+		var balance int64
+		t.store.mu.RLock()
+		for _, card := range t.store.cards {
+			if card.deleted() {
+				continue
+			}
+			byStatus[card.Status]++
+			balance += card.Balance
+		}
+		t.store.mu.RUnlock()
+
+		for status, n := range byStatus {
+			ch <- prometheus.MustNewConstMetric(cardsDesc, prometheus.GaugeValue, float64(n), t.id, status)
+		}
+		ch <- prometheus.MustNewConstMetric(balanceDesc, prometheus.GaugeValue, float64(balance), t.id)
+	}
+}
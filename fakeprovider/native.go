@@ -0,0 +1,52 @@
+package fakeprovider
+
+import "net/http"
+
+func init() {
+	registerPersonality(nativePersonality{})
+}
+
+// nativePersonality is the API the fake provider was born with, documented
+// by openAPISpec.
+type nativePersonality struct{}
+
+func (nativePersonality) name() string {
+	return DefaultPersonality
+}
+
+func (nativePersonality) routes(r *Router, rc *routeChains) {
+	rc = rc.withFormat(nativeFormat{})
+
+	// limited wraps the public routes and authenticated the routes requiring
+	// the API token, both are subject to the rate limits. public wraps the
+	// public card routes, which serve the tenants selected by the tenant
+	// header only to the requests bearing a token.
+	limited := func(h handlerFunc) http.Handler {
+		return rc.validate(rc.chain(nil, h))
+	}
+	public := func(h handlerFunc) http.Handler {
+		return rc.validate(rc.chain(rc.ctx.tenants.requireToken, h))
+	}
+	authenticated := func(h handlerFunc) http.Handler {
+		return rc.validate(rc.chain(rc.apiAuth.Handle, h))
+	}
+
+	r.GET("/openapi.json", http.HandlerFunc(openAPIHandler))
+	r.GET("/", public(getAllCardsHandler))
+	r.HEAD("/", public(getAllCardsHandler))
+	r.GET("/cards", public(getAllCardsHandler))
+	r.HEAD("/cards", public(getAllCardsHandler))
+	r.POST("/cards", public(create))
+	r.GET("/cards/:id", public(getCardByIDHandler))
+	r.HEAD("/cards/:id", public(getCardByIDHandler))
+	r.DELETE("/cards/:id", authenticated(deleteCardHandler))
+	r.POST("/load", public(loadHandler))
+	r.PATCH("/cards/:id/info", authenticated(patch))
+
+	r.POST("/login", limited(createSession))
+	r.GET("/api/me", limited(me))
+	r.POST("/api/me/verify", limited(verify))
+	r.POST("/api/me/card", limited(getCard))
+	r.POST("/api/me/totp", limited(enrollTOTP))
+	r.POST("/api/me/totp/confirm", limited(confirmTOTP))
+}
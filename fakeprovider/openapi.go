@@ -0,0 +1,156 @@
+package fakeprovider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	apierror "github.com/rodrwan/fakeproviders/api-error"
+	"github.com/rodrwan/fakeproviders/logger"
+)
+
+// openAPIHandler serves the OpenAPI document.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(openAPISpec))
+}
+
+// OpenAPIValidator provides a middleware validating requests and responses
+// against the OpenAPI document, so drift between the document and the
+// handlers fails loudly.
+type OpenAPIValidator struct {
+	router    routers.Router
+	requests  bool
+	responses bool
+}
+
+// NewOpenAPIValidator creates a new OpenAPIValidator for the served document.
+func NewOpenAPIValidator(requests, responses bool) (*OpenAPIValidator, error) {
+	doc, err := openapi3.NewLoader().LoadFromData([]byte(openAPISpec))
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OpenAPIValidator{
+		router:    router,
+		requests:  requests,
+		responses: responses,
+	}, nil
+}
+
+// Handle validates the incoming request, answering a 400 when it does not
+// match the document. Responses that do not match are replaced by a 500.
+func (v *OpenAPIValidator) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route, pathParams, err := v.router.FindRoute(r)
+		if err != nil {
+			if v.requests {
+				apierror.NewError(fmt.Sprintf("route is not documented: %v", err), http.StatusNotFound).Write(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+
+		if v.requests {
+			if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+				apierror.NewError(err.Error(), http.StatusBadRequest).Write(w)
+				return
+			}
+		}
+
+		if !v.responses {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := newResponseRecorder(w.Header())
+		next.ServeHTTP(rec, r)
+
+		err = openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 rec.status,
+			Header:                 rec.header,
+			Body:                   ioutil.NopCloser(bytes.NewReader(rec.body.Bytes())),
+			Options: &openapi3filter.Options{
+				IncludeResponseStatus: true,
+			},
+		})
+		if err != nil {
+			logger.FromContext(r.Context()).WithError(err).Error("response does not match the OpenAPI document")
+			apierror.NewError(fmt.Sprintf("response does not match the OpenAPI document: %v", err), http.StatusInternalServerError).Write(w)
+			return
+		}
+
+		rec.writeTo(w)
+	})
+}
+
+// responseRecorder buffers a response so it can be validated before being
+// sent.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// newResponseRecorder returns a recorder starting with a copy of header, so
+// the handlers see the headers set by the outer middlewares, such as the
+// request id.
+func newResponseRecorder(header http.Header) *responseRecorder {
+	return &responseRecorder{header: header.Clone(), status: http.StatusOK}
+}
+
+func (rec *responseRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	return rec.body.Write(b)
+}
+
+func (rec *responseRecorder) writeTo(w http.ResponseWriter) {
+	// the handlers may have removed some of the copied headers.
+	for k := range w.Header() {
+		if _, ok := rec.header[k]; !ok {
+			w.Header().Del(k)
+		}
+	}
+	for k, v := range rec.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.status)
+	w.Write(rec.body.Bytes())
+}
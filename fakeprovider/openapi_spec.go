@@ -0,0 +1,1413 @@
+package fakeprovider
+
+// openAPISpec is the OpenAPI 3 document of every route served by main, keep
+// it in sync when adding or changing routes.
+const openAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Fake Provider API",
+    "description": "Fake card issuer used to test provider integrations. Errors are returned as {\"error\": {\"message\", \"request_id\"}} unless stated otherwise. The state is partitioned by tenant, selected by the tenant of the API token or the X-Tenant-ID header, the default tenant otherwise. Tenants are created with the startup state on their first request bearing a token. The public card routes only serve a tenant selected by the X-Tenant-ID header to requests bearing a token. Responses of rate limited routes carry the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers of the policy closest to its limit.",
+    "version": "0.0.1"
+  },
+  "paths": {
+    "/": {
+      "get": {
+        "operationId": "listCards",
+        "summary": "List the cards a page at a time",
+        "description": "The next page starts after the last card of the previous one, given in starting_after.",
+        "parameters": [
+          {"$ref": "#/components/parameters/limit"},
+          {"$ref": "#/components/parameters/starting_after"},
+          {"$ref": "#/components/parameters/sort"},
+          {"$ref": "#/components/parameters/email"},
+          {"$ref": "#/components/parameters/status"},
+          {"$ref": "#/components/parameters/reference_id"},
+          {"$ref": "#/components/parameters/created_gte"},
+          {"$ref": "#/components/parameters/created_lte"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/CardPage"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/RateLimited"}
+        }
+      },
+      "head": {
+        "operationId": "headCards",
+        "summary": "Headers of GET /",
+        "responses": {
+          "200": {"description": "The headers of the page"},
+          "400": {"description": "Invalid parameters"},
+          "401": {"description": "Tenant header without a token"},
+          "429": {"description": "Rate limited"}
+        }
+      }
+    },
+    "/cards": {
+      "get": {
+        "operationId": "listCardsResource",
+        "summary": "List the cards a page at a time, like GET /",
+        "description": "Looks cards up by reference_id, among the other filters of GET /.",
+        "parameters": [
+          {"$ref": "#/components/parameters/limit"},
+          {"$ref": "#/components/parameters/starting_after"},
+          {"$ref": "#/components/parameters/sort"},
+          {"$ref": "#/components/parameters/email"},
+          {"$ref": "#/components/parameters/status"},
+          {"$ref": "#/components/parameters/reference_id"},
+          {"$ref": "#/components/parameters/created_gte"},
+          {"$ref": "#/components/parameters/created_lte"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/CardPage"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/RateLimited"}
+        }
+      },
+      "head": {
+        "operationId": "headCardsResource",
+        "summary": "Headers of GET /cards",
+        "responses": {
+          "200": {"description": "The headers of the page"},
+          "400": {"description": "Invalid parameters"},
+          "401": {"description": "Tenant header without a token"},
+          "429": {"description": "Rate limited"}
+        }
+      },
+      "post": {
+        "operationId": "createCard",
+        "summary": "Issue a card to a new cardholder",
+        "description": "Takes between 2 and 10 seconds and randomly fails with a 500 by default, see the chaos settings.",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {"$ref": "#/components/schemas/User"}
+            }
+          }
+        },
+        "responses": {
+          "201": {"$ref": "#/components/responses/Card"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/RateLimited"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/load": {
+      "post": {
+        "operationId": "loadCard",
+        "summary": "Add funds to a card",
+        "description": "Takes between 2 and 10 seconds by default, see the chaos settings.",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "required": ["reference_id", "amount"],
+                "properties": {
+                  "reference_id": {"type": "string"},
+                  "amount": {"type": "integer", "format": "int64"}
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Card"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/NotFound"},
+          "429": {"$ref": "#/components/responses/RateLimited"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/cards/{id}": {
+      "parameters": [
+        {"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}
+      ],
+      "get": {
+        "operationId": "getCardByID",
+        "summary": "Get a card, deleted ones included",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Card"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/NotFound"},
+          "429": {"$ref": "#/components/responses/RateLimited"}
+        }
+      },
+      "head": {
+        "operationId": "headCardByID",
+        "summary": "Headers of GET /cards/{id}",
+        "responses": {
+          "200": {"description": "The headers of the card, Last-Modified included"},
+          "401": {"description": "Tenant header without a token"},
+          "404": {"description": "Not found"},
+          "429": {"description": "Rate limited"}
+        }
+      },
+      "delete": {
+        "operationId": "deleteCard",
+        "summary": "Soft delete a card",
+        "description": "The card is kept and still returned by GET /cards/{id}, with deleted_at set, but it is left out of the listings and can't be loaded, patched nor revealed.",
+        "security": [{"apiToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Card"},
+          "401": {"$ref": "#/components/responses/TokenError"},
+          "404": {"$ref": "#/components/responses/NotFound"},
+          "429": {"$ref": "#/components/responses/RateLimited"}
+        }
+      }
+    },
+    "/cards/{id}/info": {
+      "patch": {
+        "operationId": "patchCardInfo",
+        "summary": "Overwrite the public card details",
+        "description": "The given card number, expiry date and CVV are sealed with the other card secrets, the card only shows the last digits of its number.",
+        "security": [{"apiToken": []}],
+        "parameters": [
+          {"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "card_number": {"type": "string"},
+                  "exp_date": {"type": "string"},
+                  "cvv": {"type": "string"},
+                  "reference_id": {"type": "string"}
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Card"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/TokenError"},
+          "404": {"$ref": "#/components/responses/NotFound"},
+          "429": {"$ref": "#/components/responses/RateLimited"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/_admin/reset": {
+      "post": {
+        "operationId": "resetState",
+        "summary": "Restore the startup state",
+        "description": "Recreates the seed cards and restores the startup scenarios, chaos and JIT settings. Verification keys and TOTP enrollments are dropped.",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Cards"},
+          "401": {"$ref": "#/components/responses/TokenError"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/_admin/clear": {
+      "post": {
+        "operationId": "clearState",
+        "summary": "Drop every card, verification key, TOTP enrollment and scenario",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Cards"},
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      }
+    },
+    "/_admin/import": {
+      "post": {
+        "operationId": "importCards",
+        "summary": "Add cards and their users in bulk",
+        "description": "Empty fields are generated like for POST /cards, the CVV from the card number when one is given. Nothing is imported when a card is invalid, reuses the id of another card or its user already has a card.",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "required": ["cards"],
+                "properties": {
+                  "cards": {
+                    "type": "array",
+                    "items": {
+                      "type": "object",
+                      "required": ["user"],
+                      "properties": {
+                        "id": {"type": "string"},
+                        "reference_id": {"type": "string"},
+                        "card_number": {"type": "string"},
+                        "exp_date": {"type": "string"},
+                        "cvv": {"type": "string"},
+                        "balance": {"type": "integer", "format": "int64"},
+                        "status": {"type": "string", "enum": ["active", "blocked", "canceled", "expired"]},
+                        "user": {"$ref": "#/components/schemas/User"}
+                      }
+                    }
+                  }
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "201": {"$ref": "#/components/responses/Cards"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/TokenError"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/_admin/cards/{id}": {
+      "patch": {
+        "operationId": "setCard",
+        "summary": "Set the balance or the status of a card",
+        "security": [{"adminToken": []}],
+        "parameters": [
+          {"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "balance": {"type": "integer", "format": "int64"},
+                  "status": {"type": "string", "enum": ["active", "blocked", "canceled", "expired"]}
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Card"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/TokenError"},
+          "404": {"$ref": "#/components/responses/NotFound"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/_admin/keys": {
+      "get": {
+        "operationId": "listAuthKeys",
+        "summary": "List the pending verification keys",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {
+            "description": "The keys returned by POST /api/me/verify and not used yet",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "data": {
+                      "type": "array",
+                      "items": {
+                        "type": "object",
+                        "properties": {
+                          "user_id": {"type": "string"},
+                          "key": {"type": "string"},
+                          "expires_at": {"type": "string", "format": "date-time"}
+                        }
+                      }
+                    }
+                  }
+                }
+              }
+            }
+          },
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      }
+    },
+    "/_admin/kek/rotate": {
+      "post": {
+        "operationId": "rotateKeys",
+        "summary": "Rotate the key-encryption key of card data",
+        "description": "Makes a new key-encryption key the primary one and re-wraps the data key of every card, in every tenant, and of the secrets of the startup snapshot. A random key is generated when none is given.",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "key_id": {"type": "string"},
+                  "key": {"type": "string", "format": "byte", "description": "Base64 encoded 32 bytes key."}
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "The new primary key",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "data": {
+                      "type": "object",
+                      "properties": {
+                        "key_id": {"type": "string"},
+                        "rewrapped": {"type": "integer"}
+                      }
+                    }
+                  }
+                }
+              }
+            }
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/TokenError"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/_admin/kek/{id}": {
+      "delete": {
+        "operationId": "removeKey",
+        "summary": "Remove a key-encryption key",
+        "description": "Only a key sealing no card of any tenant nor the startup snapshot is removed, POST /_admin/kek/rotate re-wraps them. The primary key can't be removed.",
+        "security": [{"adminToken": []}],
+        "parameters": [
+          {"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/String"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/TokenError"},
+          "404": {"$ref": "#/components/responses/NotFound"},
+          "409": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/_admin/snapshot": {
+      "get": {
+        "operationId": "getSnapshot",
+        "summary": "Export the state of the server",
+        "description": "The state of every tenant: the cards and their users, the ledger, the sessions, the pending verification keys and the TOTP enrollments. Secrets stay sealed with the key-encryption key of the server.",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {
+            "description": "The snapshot",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "data": {"$ref": "#/components/schemas/Snapshot"}
+                  }
+                }
+              }
+            }
+          },
+          "401": {"$ref": "#/components/responses/TokenError"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "operationId": "restoreSnapshot",
+        "summary": "Replace the state of the server by a snapshot",
+        "description": "The tenants left out of the snapshot are dropped, the default one goes back to its startup state. Returns the cards of the tenant of the request. Nothing changes when the snapshot is invalid or was sealed with an unknown key-encryption key.",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {"$ref": "#/components/schemas/Snapshot"}
+            }
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Cards"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      }
+    },
+    "/_admin/clock": {
+      "get": {
+        "operationId": "getClock",
+        "summary": "Get the time of the server clock",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Clock"},
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      },
+      "put": {
+        "operationId": "setClock",
+        "summary": "Set, freeze or resume the server clock",
+        "description": "Every timestamp, session, TOTP code and timer follows the server clock. Timers due by the new time, such as verification key expiry and the card expiry sweep, fire.",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "now": {"type": "string", "format": "date-time"},
+                  "frozen": {"type": "boolean"}
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Clock"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      }
+    },
+    "/_admin/clock/advance": {
+      "post": {
+        "operationId": "advanceClock",
+        "summary": "Move the server clock forward",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "required": ["duration"],
+                "properties": {
+                  "duration": {"type": "string", "example": "1h30m"}
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Clock"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      }
+    },
+    "/_admin/chaos": {
+      "get": {
+        "operationId": "getChaos",
+        "summary": "Get the chaos settings",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Chaos"},
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      },
+      "put": {
+        "operationId": "setChaos",
+        "summary": "Replace the chaos settings",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {"schema": {"$ref": "#/components/schemas/Chaos"}}
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Chaos"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      }
+    },
+    "/_admin/jit": {
+      "get": {
+        "operationId": "getJIT",
+        "summary": "Get the JIT funding settings",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/JIT"},
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      },
+      "put": {
+        "operationId": "setJIT",
+        "summary": "Replace the JIT funding settings",
+        "description": "An empty url disables the JIT mode.",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {"schema": {"$ref": "#/components/schemas/JIT"}}
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/JIT"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      }
+    },
+    "/_admin/rate-limits": {
+      "get": {
+        "operationId": "getRateLimits",
+        "summary": "Get the rate limit policies",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/RateLimitPolicies"},
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      },
+      "put": {
+        "operationId": "setRateLimits",
+        "summary": "Replace the rate limit policies",
+        "description": "Every counter starts over.",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "policies": {"type": "array", "items": {"$ref": "#/components/schemas/RateLimitPolicy"}}
+                }
+              }
+            },
+            "application/yaml": {}
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/RateLimitPolicies"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      }
+    },
+    "/_admin/scenarios": {
+      "get": {
+        "operationId": "listScenarios",
+        "summary": "Report the progress of the loaded scenarios",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/ScenarioReports"},
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      },
+      "post": {
+        "operationId": "loadScenarios",
+        "summary": "Load scripted response scenarios",
+        "description": "Adds the scenarios of a YAML or JSON scenario file after the loaded ones. Each request matching the route and matcher of a scenario consumes its next step.",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {"schema": {"$ref": "#/components/schemas/ScenarioFile"}},
+            "application/yaml": {}
+          }
+        },
+        "responses": {
+          "201": {"$ref": "#/components/responses/ScenarioReports"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/TokenError"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "operationId": "clearScenarios",
+        "summary": "Unload every scenario",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/ScenarioReports"},
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      }
+    },
+    "/_admin/tenants": {
+      "get": {
+        "operationId": "listTenants",
+        "summary": "List the tenants created so far",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {
+            "description": "The tenants, sorted by id",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "data": {"type": "array", "items": {"$ref": "#/components/schemas/Tenant"}}
+                  }
+                }
+              }
+            }
+          },
+          "401": {"$ref": "#/components/responses/TokenError"}
+        }
+      }
+    },
+    "/_admin/tenants/{tenant}": {
+      "delete": {
+        "operationId": "removeTenant",
+        "summary": "Drop a tenant and its whole state",
+        "description": "The tenant is created again with the startup state by its next request bearing an API or admin token. The default tenant can't be removed.",
+        "security": [{"adminToken": []}],
+        "parameters": [
+          {"name": "tenant", "in": "path", "required": true, "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/String"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/TokenError"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/login": {
+      "post": {
+        "operationId": "login",
+        "summary": "Create a cardholder session",
+        "description": "A TOTP code is required once the cardholder enrolled an authenticator app.",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "required": ["username", "password"],
+                "properties": {
+                  "username": {"type": "string"},
+                  "password": {"type": "string"},
+                  "totp_code": {"type": "string"}
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "201": {"$ref": "#/components/responses/String"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/RateLimited"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/me": {
+      "get": {
+        "operationId": "me",
+        "summary": "Card of the session cardholder",
+        "security": [{"session": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Card"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/RateLimited"}
+        }
+      }
+    },
+    "/api/me/verify": {
+      "post": {
+        "operationId": "verify",
+        "summary": "Create a verification key",
+        "description": "The key is valid for 30 seconds and is required to reveal the card.",
+        "security": [{"session": []}],
+        "responses": {
+          "201": {"$ref": "#/components/responses/String"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/RateLimited"}
+        }
+      }
+    },
+    "/api/me/card": {
+      "post": {
+        "operationId": "revealCard",
+        "summary": "Reveal the card details",
+        "description": "Requires either a verification token or a TOTP code. When a public JWK is given the details are returned as a compact JWE encrypted to it.",
+        "security": [{"session": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "verification_token": {"type": "string"},
+                  "totp_code": {"type": "string"},
+                  "public_key": {"type": "object", "description": "RSA or EC public JWK."}
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "The card details",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "data": {
+                      "oneOf": [
+                        {"$ref": "#/components/schemas/RevealedCard"},
+                        {"$ref": "#/components/schemas/EncryptedCard"}
+                      ]
+                    }
+                  }
+                }
+              }
+            }
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/NotFound"},
+          "429": {"$ref": "#/components/responses/RateLimited"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/me/totp": {
+      "post": {
+        "operationId": "enrollTOTP",
+        "summary": "Enroll an authenticator app",
+        "description": "The secret must be confirmed with a first code before it is used. Replacing a confirmed enrollment needs a code of its secret, which stays in use until the new one is confirmed.",
+        "security": [{"session": []}],
+        "requestBody": {
+          "required": false,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "totp_code": {"type": "string"}
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "201": {
+            "description": "The shared secret",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object",
+                  "properties": {
+                    "data": {
+                      "type": "object",
+                      "properties": {
+                        "secret": {"type": "string"},
+                        "uri": {"type": "string"}
+                      }
+                    }
+                  }
+                }
+              }
+            }
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/RateLimited"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/me/totp/confirm": {
+      "post": {
+        "operationId": "confirmTOTP",
+        "summary": "Confirm the authenticator app enrollment",
+        "security": [{"session": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "required": ["totp_code"],
+                "properties": {
+                  "totp_code": {"type": "string"}
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/String"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/RateLimited"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/metrics": {
+      "get": {
+        "operationId": "metrics",
+        "summary": "Prometheus metrics",
+        "responses": {
+          "200": {
+            "description": "Metrics in the Prometheus text format",
+            "content": {
+              "text/plain": {"schema": {"type": "string"}}
+            }
+          }
+        }
+      }
+    },
+    "/openapi.json": {
+      "get": {
+        "operationId": "openAPI",
+        "summary": "This document",
+        "responses": {
+          "200": {
+            "description": "The OpenAPI document",
+            "content": {
+              "application/json": {"schema": {"type": "object"}}
+            }
+          }
+        }
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "limit": {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 1000, "default": 100}},
+      "starting_after": {"name": "starting_after", "in": "query", "description": "Id of the last card of the previous page.", "schema": {"type": "string"}},
+      "sort": {"name": "sort", "in": "query", "schema": {"type": "string", "enum": ["created_at", "-created_at", "balance", "-balance"], "default": "created_at"}},
+      "email": {"name": "email", "in": "query", "schema": {"type": "string"}},
+      "status": {"name": "status", "in": "query", "description": "Comma separated card statuses.", "schema": {"type": "string"}},
+      "reference_id": {"name": "reference_id", "in": "query", "schema": {"type": "string"}},
+      "created_gte": {"name": "created_gte", "in": "query", "schema": {"type": "string", "format": "date-time"}},
+      "created_lte": {"name": "created_lte", "in": "query", "schema": {"type": "string", "format": "date-time"}}
+    },
+    "securitySchemes": {
+      "apiToken": {
+        "type": "http",
+        "scheme": "bearer",
+        "description": "Token configured with the -token flag."
+      },
+      "adminToken": {
+        "type": "http",
+        "scheme": "bearer",
+        "description": "Token configured with the -admin-token flag, defaults to the API token."
+      },
+      "session": {
+        "type": "http",
+        "scheme": "bearer",
+        "bearerFormat": "JWT",
+        "description": "Token returned by POST /login."
+      }
+    },
+    "schemas": {
+      "User": {
+        "type": "object",
+        "required": ["first_name", "last_name", "email"],
+        "properties": {
+          "first_name": {"type": "string"},
+          "last_name": {"type": "string"},
+          "email": {"type": "string"}
+        }
+      },
+      "Card": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "name_on_card": {"type": "string"},
+          "pan": {"type": "string", "description": "Masked card number."},
+          "reference_id": {"type": "string"},
+          "exp_date": {"type": "string"},
+          "cvv": {"type": "string"},
+          "balance": {"type": "integer", "format": "int64"},
+          "status": {"type": "string", "enum": ["active", "blocked", "canceled", "expired"]},
+          "user": {"$ref": "#/components/schemas/User"},
+          "metadata": {"type": "object", "additionalProperties": {"type": "string"}},
+          "created_at": {"type": "string", "format": "date-time"},
+          "updated_at": {"type": "string", "format": "date-time"},
+          "deleted_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "RevealedCard": {
+        "type": "object",
+        "required": ["name_on_card", "card_number", "expiry_date", "cvv"],
+        "properties": {
+          "name_on_card": {"type": "string"},
+          "card_number": {"type": "string"},
+          "expiry_date": {"type": "string"},
+          "cvv": {"type": "string"}
+        },
+        "additionalProperties": false
+      },
+      "EncryptedCard": {
+        "type": "object",
+        "required": ["jwe"],
+        "properties": {
+          "jwe": {"type": "string", "description": "Compact JWE of a RevealedCard."}
+        },
+        "additionalProperties": false
+      },
+      "ScenarioFile": {
+        "type": "object",
+        "required": ["scenarios"],
+        "properties": {
+          "scenarios": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "required": ["route", "steps"],
+              "properties": {
+                "name": {"type": "string"},
+                "route": {"type": "string", "example": "POST /cards"},
+                "match": {
+                  "type": "object",
+                  "properties": {
+                    "body": {"type": "object", "additionalProperties": true},
+                    "query": {"type": "object", "additionalProperties": {"type": "string"}},
+                    "headers": {"type": "object", "additionalProperties": {"type": "string"}}
+                  }
+                },
+                "steps": {
+                  "type": "array",
+                  "minItems": 1,
+                  "items": {
+                    "type": "object",
+                    "properties": {
+                      "status": {"type": "integer"},
+                      "message": {"type": "string"},
+                      "body": {},
+                      "headers": {"type": "object", "additionalProperties": {"type": "string"}},
+                      "delay": {"type": "string", "example": "15s"},
+                      "timeout": {"type": "string", "example": "15s"},
+                      "times": {"type": "integer", "minimum": 0}
+                    }
+                  }
+                },
+                "repeat": {"type": "boolean"}
+              }
+            }
+          }
+        }
+      },
+      "Delay": {
+        "type": "object",
+        "properties": {
+          "min": {"type": "string", "example": "2s"},
+          "max": {"type": "string", "example": "10s"}
+        }
+      },
+      "Chaos": {
+        "type": "object",
+        "properties": {
+          "error_rate": {"type": "number", "minimum": 0, "maximum": 1},
+          "create_delay": {"$ref": "#/components/schemas/Delay"},
+          "load_delay": {"$ref": "#/components/schemas/Delay"}
+        }
+      },
+      "JIT": {
+        "type": "object",
+        "description": "Authorizations of active cards are decided by a POST to url, answering {\"approved\": true|false} within timeout, default is applied otherwise.",
+        "properties": {
+          "url": {"type": "string", "format": "uri"},
+          "timeout": {"type": "string", "example": "2s"},
+          "default": {"type": "string", "enum": ["approve", "decline"]},
+          "secret": {"type": "string"}
+        }
+      },
+      "ListMeta": {
+        "type": "object",
+        "required": ["has_more", "limit", "sort", "filters", "total"],
+        "properties": {
+          "has_more": {"type": "boolean"},
+          "limit": {"type": "integer"},
+          "starting_after": {"type": "string"},
+          "sort": {"type": "string"},
+          "filters": {
+            "type": "object",
+            "properties": {
+              "email": {"type": "string"},
+              "status": {"type": "array", "items": {"type": "string"}},
+              "reference_id": {"type": "string"},
+              "created_gte": {"type": "string", "format": "date-time"},
+              "created_lte": {"type": "string", "format": "date-time"}
+            }
+          },
+          "total": {"type": "integer", "description": "Number of cards matching the filters."}
+        }
+      },
+      "Envelope": {
+        "type": "object",
+        "description": "Fields sealed with a data key, itself wrapped by a key-encryption key.",
+        "properties": {
+          "key_id": {"type": "string"},
+          "wrapped_key": {"type": "string", "format": "byte"},
+          "fields": {"type": "object", "additionalProperties": {"type": "string", "format": "byte"}}
+        }
+      },
+      "LedgerEntry": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "card_id": {"type": "string"},
+          "type": {"type": "string", "enum": ["load", "purchase", "adjustment", "authorization", "reversal", "jit_funding"]},
+          "amount": {"type": "integer", "format": "int64"},
+          "balance": {"type": "integer", "format": "int64"},
+          "description": {"type": "string"},
+          "authorization_id": {"type": "string"},
+          "decision": {"type": "string", "enum": ["webhook_approved", "webhook_declined", "webhook_timeout", "webhook_error"]},
+          "request_id": {"type": "string"},
+          "created_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Snapshot": {
+        "type": "object",
+        "description": "Version 1 snapshots hold the state of the default tenant instead of tenants.",
+        "required": ["version"],
+        "properties": {
+          "version": {"type": "integer", "enum": [1, 2]},
+          "taken_at": {"type": "string", "format": "date-time"},
+          "tenants": {
+            "type": "object",
+            "additionalProperties": {"$ref": "#/components/schemas/TenantSnapshot"}
+          }
+        }
+      },
+      "TenantSnapshot": {
+        "type": "object",
+        "properties": {
+          "cards": {
+            "type": "array",
+            "items": {
+              "allOf": [
+                {"$ref": "#/components/schemas/Card"},
+                {"type": "object", "properties": {"secrets": {"$ref": "#/components/schemas/Envelope"}}}
+              ]
+            }
+          },
+          "ledger": {"type": "array", "items": {"$ref": "#/components/schemas/LedgerEntry"}},
+          "sessions": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "id": {"type": "string"},
+                "user_id": {"type": "string"},
+                "email": {"type": "string"},
+                "origin": {"type": "string"},
+                "created_at": {"type": "string", "format": "date-time"},
+                "expires_at": {"type": "string", "format": "date-time"}
+              }
+            }
+          },
+          "pending_keys": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "user_id": {"type": "string"},
+                "key": {"type": "string"},
+                "expires_at": {"type": "string", "format": "date-time"}
+              }
+            }
+          },
+          "totp": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "user_id": {"type": "string"},
+                "confirmed": {"type": "boolean"},
+                "last_step": {"type": "integer", "format": "int64"},
+                "secret": {"$ref": "#/components/schemas/Envelope"},
+                "pending": {"$ref": "#/components/schemas/Envelope"}
+              }
+            }
+          },
+          "authorizations": {
+            "type": "array",
+            "description": "Authorizations of the cards, made through the Stripe API or ISO 8583.",
+            "items": {
+              "type": "object",
+              "properties": {
+                "id": {"type": "string"},
+                "card_id": {"type": "string"},
+                "amount": {"type": "integer", "format": "int64"},
+                "currency": {"type": "string"},
+                "merchant": {"type": "object", "additionalProperties": {"type": "string"}},
+                "approved": {"type": "boolean"},
+                "decline_reason": {"type": "string"},
+                "status": {"type": "string", "enum": ["pending", "closed", "reversed"]},
+                "channel": {"type": "string"},
+                "metadata": {"type": "object", "additionalProperties": {"type": "string"}},
+                "jit": {
+                  "type": "object",
+                  "properties": {
+                    "reason": {"type": "string", "enum": ["webhook_approved", "webhook_declined", "webhook_timeout", "webhook_error"]},
+                    "status": {"type": "integer"},
+                    "error": {"type": "string"},
+                    "latency": {"type": "string"},
+                    "funded": {"type": "integer", "format": "int64"}
+                  }
+                },
+                "created_at": {"type": "string", "format": "date-time"},
+                "updated_at": {"type": "string", "format": "date-time"}
+              }
+            }
+          },
+          "cardholders": {
+            "type": "array",
+            "description": "Cardholders created through the Stripe API.",
+            "items": {
+              "type": "object",
+              "properties": {
+                "id": {"type": "string"},
+                "name": {"type": "string"},
+                "email": {"type": "string"},
+                "phone_number": {"type": "string"},
+                "type": {"type": "string", "enum": ["individual", "company"]},
+                "status": {"type": "string", "enum": ["active", "inactive"]},
+                "billing": {"type": "object", "additionalProperties": {"type": "string"}},
+                "metadata": {"type": "object", "additionalProperties": {"type": "string"}},
+                "created_at": {"type": "string", "format": "date-time"}
+              }
+            }
+          },
+          "webhook_endpoints": {
+            "type": "array",
+            "description": "Webhook endpoints of the Stripe API.",
+            "items": {
+              "type": "object",
+              "properties": {
+                "id": {"type": "string"},
+                "url": {"type": "string"},
+                "enabled_events": {"type": "array", "items": {"type": "string"}},
+                "description": {"type": "string"},
+                "disabled": {"type": "boolean"},
+                "metadata": {"type": "object", "additionalProperties": {"type": "string"}},
+                "created_at": {"type": "string", "format": "date-time"},
+                "secret": {"$ref": "#/components/schemas/Envelope"}
+              }
+            }
+          }
+        }
+      },
+      "RateLimitPolicy": {
+        "type": "object",
+        "required": ["name", "limit", "period"],
+        "properties": {
+          "name": {"type": "string"},
+          "routes": {"type": "array", "description": "Method and route template such as \"POST /cards\", * matching any method. Empty applies to every API route.", "items": {"type": "string"}},
+          "key": {"type": "string", "enum": ["ip", "api_key", "tenant", "session"], "default": "ip"},
+          "limit": {"type": "integer", "minimum": 1},
+          "period": {"type": "string", "description": "Duration such as \"10s\" or \"24h\", windows are aligned on the server clock.", "example": "24h"}
+        }
+      },
+      "Tenant": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "created_at": {"type": "string", "format": "date-time"},
+          "cards": {"type": "integer"}
+        }
+      },
+      "ScenarioReport": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "route": {"type": "string"},
+          "steps": {"type": "integer"},
+          "consumed": {"type": "integer"},
+          "rounds": {"type": "integer"},
+          "done": {"type": "boolean"}
+        }
+      },
+      "Error": {
+        "type": "object",
+        "required": ["error"],
+        "properties": {
+          "error": {
+            "type": "object",
+            "required": ["message"],
+            "properties": {
+              "message": {"type": "string"},
+              "request_id": {"type": "string"}
+            }
+          }
+        }
+      }
+    },
+    "responses": {
+      "CardPage": {
+        "description": "A page of cards",
+        "content": {
+          "application/json": {
+            "schema": {
+              "type": "object",
+              "properties": {
+                "data": {"type": "array", "items": {"$ref": "#/components/schemas/Card"}},
+                "meta": {"$ref": "#/components/schemas/ListMeta"}
+              }
+            }
+          }
+        }
+      },
+      "Cards": {
+        "description": "A list of cards",
+        "content": {
+          "application/json": {
+            "schema": {
+              "type": "object",
+              "properties": {
+                "data": {"type": "array", "items": {"$ref": "#/components/schemas/Card"}}
+              }
+            }
+          }
+        }
+      },
+      "Clock": {
+        "description": "The server clock",
+        "content": {
+          "application/json": {
+            "schema": {
+              "type": "object",
+              "properties": {
+                "data": {
+                  "type": "object",
+                  "properties": {
+                    "now": {"type": "string", "format": "date-time"},
+                    "frozen": {"type": "boolean"}
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "Chaos": {
+        "description": "The chaos settings",
+        "content": {
+          "application/json": {
+            "schema": {
+              "type": "object",
+              "properties": {
+                "data": {"$ref": "#/components/schemas/Chaos"}
+              }
+            }
+          }
+        }
+      },
+      "JIT": {
+        "description": "The JIT funding settings",
+        "content": {
+          "application/json": {
+            "schema": {
+              "type": "object",
+              "properties": {
+                "data": {"$ref": "#/components/schemas/JIT"}
+              }
+            }
+          }
+        }
+      },
+      "RateLimitPolicies": {
+        "description": "The rate limit policies",
+        "content": {
+          "application/json": {
+            "schema": {
+              "type": "object",
+              "properties": {
+                "data": {"type": "array", "items": {"$ref": "#/components/schemas/RateLimitPolicy"}}
+              }
+            }
+          }
+        }
+      },
+      "ScenarioReports": {
+        "description": "The loaded scenarios",
+        "content": {
+          "application/json": {
+            "schema": {
+              "type": "object",
+              "properties": {
+                "data": {"type": "array", "items": {"$ref": "#/components/schemas/ScenarioReport"}}
+              }
+            }
+          }
+        }
+      },
+      "Card": {
+        "description": "A card",
+        "content": {
+          "application/json": {
+            "schema": {
+              "type": "object",
+              "properties": {
+                "data": {"$ref": "#/components/schemas/Card"}
+              }
+            }
+          }
+        }
+      },
+      "String": {
+        "description": "A single value",
+        "content": {
+          "application/json": {
+            "schema": {
+              "type": "object",
+              "properties": {
+                "data": {"type": "string"}
+              }
+            }
+          }
+        }
+      },
+      "Error": {
+        "description": "An error",
+        "content": {
+          "application/json": {
+            "schema": {"$ref": "#/components/schemas/Error"}
+          }
+        }
+      },
+      "RateLimited": {
+        "description": "The rate limit was exceeded",
+        "headers": {
+          "Retry-After": {"description": "Seconds until the exhausted window resets.", "schema": {"type": "integer"}},
+          "RateLimit-Limit": {"schema": {"type": "integer"}},
+          "RateLimit-Remaining": {"schema": {"type": "integer"}},
+          "RateLimit-Reset": {"description": "Seconds until the window resets.", "schema": {"type": "integer"}},
+          "RateLimit-Policy": {"description": "Limit and window of the policy, such as 2;w=10.", "schema": {"type": "string"}}
+        },
+        "content": {
+          "application/json": {
+            "schema": {"$ref": "#/components/schemas/Error"}
+          }
+        }
+      },
+      "TokenError": {
+        "description": "Missing or invalid API token",
+        "content": {
+          "application/json": {
+            "schema": {
+              "type": "object",
+              "required": ["message"],
+              "properties": {
+                "message": {"type": "string"},
+                "request_id": {"type": "string"}
+              }
+            }
+          }
+        }
+      },
+      "NotFound": {
+        "description": "Not found",
+        "content": {
+          "text/plain": {"schema": {"type": "string"}}
+        }
+      }
+    }
+  }
+}
+`
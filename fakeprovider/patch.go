@@ -0,0 +1,74 @@
+package fakeprovider
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/rodrwan/fakeproviders/logger"
+)
+
+type patchRequestData struct {
+	CardNumber  string `json:"card_number"`
+	ExpDate     string `json:"exp_date"`
+	CVV         string `json:"cvv"`
+	ReferenceID string `json:"reference_id"`
+}
+
+func patch(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	id, ok := r.Context().Value("id").(string)
+	if !ok {
+		return nil, errors.New("missing id")
+	}
+	var patch patchRequestData
+
+	defer r.Body.Close()
+	if err := unmarshalJSON(r.Body, &patch); err != nil {
+		logger.FromContext(r.Context()).WithError(err).Error("invalid request body")
+		return nil, err
+	}
+
+	if patch.CardNumber != "" && len(patch.CardNumber) < 12 {
+		return &response{Status: http.StatusBadRequest, Data: "invalid card number"}, nil
+	}
+
+	// The patched secrets are sealed like the generated ones, the card only
+	// shows the last digits of its number.
+	var err error
+	selectedCard := ctx.store.update(r.Context(), byID(id), func(c *card) {
+		secrets, rerr := c.Reveal(ctx.keyring)
+		if rerr != nil {
+			err = rerr
+			return
+		}
+		if patch.CardNumber != "" {
+			secrets.PAN = patch.CardNumber
+		}
+		if patch.ExpDate != "" {
+			secrets.ExpDate = patch.ExpDate
+		}
+		if patch.CVV != "" {
+			secrets.CVV = patch.CVV
+		}
+		if err = c.SetSecrets(ctx.keyring, secrets.PAN, secrets.ExpDate, secrets.CVV); err != nil {
+			return
+		}
+		c.SetPAN(secrets.PAN)
+		c.ReferenceID = patch.ReferenceID
+		c.UpdatedAt = ctx.now()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if selectedCard == nil {
+		return &response{
+			Status: http.StatusNotFound,
+		}, nil
+	}
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   selectedCard,
+	}, nil
+
+}
@@ -0,0 +1,175 @@
+package fakeprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	apierror "github.com/rodrwan/fakeproviders/api-error"
+	"github.com/rodrwan/fakeproviders/logger"
+	"github.com/rodrwan/fakeproviders/tracing"
+)
+
+// DefaultPersonality is the API served when Options.Personalities is empty.
+const DefaultPersonality = "fakeprovider"
+
+// personality emulates the API of a card issuer on top of the shared core:
+// the tenants and their cards, ledger and sessions, the scenarios and the
+// rate limits. It brings its own routes, payloads, envelope, error format
+// and auth scheme.
+type personality interface {
+	// name selects the personality in Options.Personalities and
+	// Server.Handler.
+	name() string
+	// routes registers the routes of the personality, built with the shared
+	// middlewares of rc.
+	routes(r *Router, rc *routeChains)
+}
+
+// personalities holds the available personalities by name, each one
+// registers itself from an init function.
+var personalities = make(map[string]personality)
+
+func registerPersonality(p personality) {
+	if _, ok := personalities[p.name()]; ok {
+		panic("fakeprovider: personality " + p.name() + " registered twice")
+	}
+	personalities[p.name()] = p
+}
+
+// Personalities returns the names of the available personalities.
+func Personalities() []string {
+	names := make([]string, 0, len(personalities))
+	for name := range personalities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupPersonalities returns the named personalities, the default one when
+// names is empty.
+func lookupPersonalities(names []string) ([]personality, error) {
+	if len(names) == 0 {
+		names = []string{DefaultPersonality}
+	}
+	seen := make(map[string]bool, len(names))
+	ps := make([]personality, 0, len(names))
+	for _, name := range names {
+		p, ok := personalities[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown personality %q, use one of %s", name, strings.Join(Personalities(), ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("personality %q selected twice", name)
+		}
+		seen[name] = true
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+// apiFormat is the wire format of a personality: the envelope of its
+// responses and the shape of its errors.
+type apiFormat interface {
+	writeResponse(w http.ResponseWriter, r *http.Request, resp *response)
+	writeError(w http.ResponseWriter, r *http.Request, status int, message string)
+}
+
+// nativeFormat wraps the responses in {"data", "meta"} and the errors in
+// {"error": {"message", "request_id"}}, except for the plain text 404s. The
+// handlers 401s don't tell why.
+type nativeFormat struct{}
+
+func (nativeFormat) writeResponse(w http.ResponseWriter, r *http.Request, resp *response) {
+	resp.Write(w)
+}
+
+func (nativeFormat) writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	switch status {
+	case http.StatusNotFound:
+		http.NotFound(w, r)
+		return
+	case http.StatusUnauthorized:
+		message = ""
+	}
+	apierror.NewError(message, status).Write(w)
+}
+
+type apiFormatContextKey struct{}
+
+// formatFromContext returns the format of the personality serving the
+// request, so the shared middlewares answer in it.
+func formatFromContext(ctx context.Context) apiFormat {
+	if f, ok := ctx.Value(apiFormatContextKey{}).(apiFormat); ok {
+		return f
+	}
+	return nativeFormat{}
+}
+
+// routeChains builds the handlers of the routes of a personality with the
+// shared middlewares. Each middleware and the handler get a span.
+type routeChains struct {
+	ctx    *Context
+	logger *logger.Logger
+	// apiAuth accepts the API token and the tenant API tokens.
+	apiAuth *AuthMiddleware
+	// validator checks the routes of the OpenAPI document, nil when
+	// disabled.
+	validator *OpenAPIValidator
+	format    apiFormat
+}
+
+// withFormat returns a copy of rc whose handlers answer in f.
+func (rc *routeChains) withFormat(f apiFormat) *routeChains {
+	c := *rc
+	c.format = f
+	return &c
+}
+
+// chain returns h behind the logger, auth when not nil, the rate limits and
+// the scenarios.
+func (rc *routeChains) chain(auth func(http.Handler) http.Handler, h handlerFunc) http.Handler {
+	var next http.Handler = tracing.Middleware("rate_limiter", rc.ctx.rateLimits.Handle(
+		tracing.Middleware("scenarios", rc.ctx.tenants.scenarioMiddleware(
+			tracing.Middleware("handler", ContextHandler{ctx: rc.ctx, H: h, format: rc.format}),
+		)),
+	))
+	if auth != nil {
+		next = tracing.Middleware("auth", auth(next))
+	}
+
+	format := rc.format
+	return tracing.Middleware("logger", rc.logger.Handle(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiFormatContextKey{}, format)))
+		}),
+	))
+}
+
+// validate checks the traffic of h against the OpenAPI document, when
+// enabled.
+func (rc *routeChains) validate(h http.Handler) http.Handler {
+	if rc.validator == nil {
+		return h
+	}
+	return rc.validator.Handle(h)
+}
+
+// registerRoutes registers the routes of ps on r, reporting the routes
+// conflicting with each other instead of panicking.
+func registerRoutes(r *Router, rc *routeChains, ps []personality) (err error) {
+	var current string
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("personality %s: %v", current, v)
+		}
+	}()
+	for _, p := range ps {
+		current = p.name()
+		p.routes(r, rc)
+	}
+	return nil
+}
@@ -1,4 +1,4 @@
-package main
+package fakeprovider
 
 import "net/http"
 
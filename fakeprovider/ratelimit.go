@@ -0,0 +1,341 @@
+package fakeprovider
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/rodrwan/fakeproviders/logger"
+)
+
+// Rate limit keys, telling which requests share a counter.
+const (
+	RateLimitByIP      = "ip"
+	RateLimitByAPIKey  = "api_key"
+	RateLimitByTenant  = "tenant"
+	RateLimitBySession = "session"
+)
+
+// RateLimitFile is the format of the rate limit files, either YAML or JSON.
+type RateLimitFile struct {
+	Policies []RateLimitPolicy `json:"policies"`
+}
+
+// RateLimitPolicy allows Limit requests per Period to some routes, counted
+// per client. Periods are fixed windows of the server clock, a 24h period is
+// a daily quota reset at midnight UTC.
+type RateLimitPolicy struct {
+	Name string `json:"name"`
+	// Routes are the method and the route template, such as "POST /cards",
+	// "*" matching any method. Empty applies the policy to every API route.
+	Routes []string `json:"routes,omitempty"`
+	// Key tells whose requests are counted together, one of ip, the default,
+	// api_key, tenant or session. Requests without an API key accepted by
+	// the server or without the token of an open session are counted by IP.
+	Key    string   `json:"key,omitempty"`
+	Limit  int64    `json:"limit"`
+	Period Duration `json:"period"`
+}
+
+// ParseRateLimits parses a YAML or JSON rate limit file.
+func ParseRateLimits(data []byte) ([]RateLimitPolicy, error) {
+	var f RateLimitFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if err := validateRateLimits(f.Policies); err != nil {
+		return nil, err
+	}
+	return f.Policies, nil
+}
+
+// LoadRateLimits reads a YAML or JSON rate limit file.
+func LoadRateLimits(path string) ([]RateLimitPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRateLimits(data)
+}
+
+func validateRateLimits(policies []RateLimitPolicy) error {
+	names := make(map[string]bool, len(policies))
+	for _, p := range policies {
+		if p.Name == "" || names[p.Name] {
+			return fmt.Errorf("rate limit %q: missing or duplicated name", p.Name)
+		}
+		names[p.Name] = true
+		switch p.Key {
+		case "", RateLimitByIP, RateLimitByAPIKey, RateLimitByTenant, RateLimitBySession:
+		default:
+			return fmt.Errorf("rate limit %q: invalid key %q, use ip, api_key, tenant or session", p.Name, p.Key)
+		}
+		if p.Limit <= 0 || p.Period <= 0 {
+			return fmt.Errorf("rate limit %q: limit and period must be positive", p.Name)
+		}
+		for _, route := range p.Routes {
+			if _, _, err := splitRoute(route); err != nil {
+				return fmt.Errorf("rate limit %q: %v", p.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// rateWindow counts the requests of a client within the current window.
+type rateWindow struct {
+	start time.Time
+	count int64
+}
+
+type ratePolicy struct {
+	RateLimitPolicy
+	routes  [][2]string
+	windows map[string]*rateWindow
+	// sweepAt is when windows over are dropped next.
+	sweepAt time.Time
+}
+
+func newRatePolicy(p RateLimitPolicy) *ratePolicy {
+	rp := &ratePolicy{RateLimitPolicy: p, windows: make(map[string]*rateWindow)}
+	for _, route := range p.Routes {
+		method, template, _ := splitRoute(route)
+		rp.routes = append(rp.routes, [2]string{method, template})
+	}
+	return rp
+}
+
+func (p *ratePolicy) matches(method, route string) bool {
+	if len(p.routes) == 0 {
+		return true
+	}
+	for _, r := range p.routes {
+		if (r[0] == "*" || r[0] == method) && r[1] == route {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns the client a request of p is counted for.
+func (l *rateLimiter) key(p *ratePolicy, r *http.Request) string {
+	switch p.Key {
+	case RateLimitByAPIKey:
+		// any other value would get a counter of its own.
+		if token := apiKey(r); token != "" && l.apiAuth.accepts(token) {
+			return token
+		}
+	case RateLimitBySession:
+		// like api keys, only the sessions of the tenant get a counter.
+		ctx := l.ctx
+		if t, ok := tenantFromContext(r.Context()); ok {
+			ctx = ctx.forTenant(t)
+		}
+		var tokens []string
+		if token, err := parseAuthToken(r); err == nil {
+			tokens = append(tokens, token)
+		}
+		if c, err := r.Cookie(authTokenCookieName); err == nil && c.Value != "" {
+			tokens = append(tokens, c.Value)
+		}
+		for _, token := range tokens {
+			if sess, err := ctx.session(r.Context(), token); err == nil {
+				return "session:" + sess.ID
+			}
+		}
+	case RateLimitByTenant:
+		if t, ok := tenantFromContext(r.Context()); ok {
+			return t.id
+		}
+		return DefaultTenant
+	}
+	return "ip:" + logger.ClientIP(r, l.trustedProxies)
+}
+
+// window returns the current window of key, dropping the windows over once
+// per period.
+func (p *ratePolicy) window(key string, now time.Time) *rateWindow {
+	period := time.Duration(p.Period)
+	start := now.Truncate(period)
+	if !now.Before(p.sweepAt) {
+		for k, w := range p.windows {
+			if w.start.Before(start) {
+				delete(p.windows, k)
+			}
+		}
+		p.sweepAt = start.Add(period)
+	}
+
+	w, ok := p.windows[key]
+	if !ok || !w.start.Equal(start) {
+		w = &rateWindow{start: start}
+		p.windows[key] = w
+	}
+	return w
+}
+
+// rateStatus is the state of a policy for a client, sent in the RateLimit
+// headers.
+type rateStatus struct {
+	policy    *ratePolicy
+	remaining int64
+	reset     time.Duration
+}
+
+func (s rateStatus) write(h http.Header, limited bool) {
+	seconds := func(d time.Duration) string {
+		return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+	}
+	h.Set("RateLimit-Limit", strconv.FormatInt(s.policy.Limit, 10))
+	h.Set("RateLimit-Remaining", strconv.FormatInt(s.remaining, 10))
+	h.Set("RateLimit-Reset", seconds(s.reset))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", s.policy.Limit, seconds(time.Duration(s.policy.Period))))
+	if limited {
+		h.Set("Retry-After", seconds(s.reset))
+	}
+}
+
+// rateLimiter applies the rate limit policies, which the admin API changes
+// at runtime.
+type rateLimiter struct {
+	ctx *Context
+	// apiAuth accepts the API keys counted by the api_key policies.
+	apiAuth *AuthMiddleware
+	// trustedProxies are the proxies whose forwarding headers tell the IP
+	// of the client, none by default.
+	trustedProxies []*net.IPNet
+
+	mu       sync.Mutex
+	policies []*ratePolicy
+}
+
+func newRateLimiter(ctx *Context, policies []RateLimitPolicy, apiAuth *AuthMiddleware, trustedProxies []*net.IPNet) *rateLimiter {
+	l := &rateLimiter{ctx: ctx, apiAuth: apiAuth, trustedProxies: trustedProxies}
+	l.set(policies)
+	return l
+}
+
+// get returns the policies in use.
+func (l *rateLimiter) get() []RateLimitPolicy {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	policies := make([]RateLimitPolicy, len(l.policies))
+	for i, p := range l.policies {
+		policies[i] = p.RateLimitPolicy
+	}
+	return policies
+}
+
+// set replaces the policies, every counter starts over.
+func (l *rateLimiter) set(policies []RateLimitPolicy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.policies = make([]*ratePolicy, len(policies))
+	for i, p := range policies {
+		l.policies[i] = newRatePolicy(p)
+	}
+}
+
+// take counts a request against every policy of its route, unless one of
+// them is exhausted. It returns the status to report: the exhausted policy
+// resetting last, or the policy with the fewest remaining requests.
+func (l *rateLimiter) take(r *http.Request) (rateStatus, bool, bool) {
+	now := l.ctx.now()
+	route := logger.RouteFromContext(r.Context())
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var windows []*rateWindow
+	var statuses []rateStatus
+	for _, p := range l.policies {
+		if !p.matches(r.Method, route) {
+			continue
+		}
+		w := p.window(l.key(p, r), now)
+		windows = append(windows, w)
+		statuses = append(statuses, rateStatus{
+			policy:    p,
+			remaining: p.Limit - w.count,
+			reset:     w.start.Add(time.Duration(p.Period)).Sub(now),
+		})
+	}
+	if len(statuses) == 0 {
+		return rateStatus{}, false, true
+	}
+
+	var limited *rateStatus
+	for i := range statuses {
+		s := &statuses[i]
+		if s.remaining <= 0 && (limited == nil || s.reset > limited.reset) {
+			limited = s
+		}
+	}
+	if limited != nil {
+		return *limited, true, false
+	}
+
+	report := 0
+	for i, w := range windows {
+		w.count++
+		statuses[i].remaining--
+		if statuses[i].remaining < statuses[report].remaining {
+			report = i
+		}
+	}
+	return statuses[report], true, true
+}
+
+// Handle rejects the requests over the limit of a policy with a 429, every
+// response of a limited route gets the RateLimit headers.
+func (l *rateLimiter) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, found, ok := l.take(r)
+		if found {
+			status.write(w.Header(), !ok)
+		}
+		if !ok {
+			l.ctx.metrics.rateLimited(r)
+			logger.FromContext(r.Context()).WithField("rate_limit", status.policy.Name).Warn("rate limit exceeded")
+			formatFromContext(r.Context()).writeError(w, r, http.StatusTooManyRequests, "Limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getRateLimits returns the rate limit policies in use.
+func getRateLimits(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	return &response{
+		Status: http.StatusOK,
+		Data:   ctx.rateLimits.get(),
+	}, nil
+}
+
+// setRateLimits replaces the rate limit policies and resets the counters.
+func setRateLimits(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := ParseRateLimits(body)
+	if err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+	if policies == nil {
+		policies = []RateLimitPolicy{}
+	}
+	ctx.rateLimits.set(policies)
+	logger.FromContext(r.Context()).WithField("rate_limits", len(policies)).Info("rate limits changed")
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   policies,
+	}, nil
+}
@@ -0,0 +1,101 @@
+package fakeprovider
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/clock"
+)
+
+func TestRateLimitHeaders(t *testing.T) {
+	clk := clock.NewVirtual(time.Date(2026, 1, 1, 0, 0, 10, 0, time.UTC))
+	clk.Freeze()
+	ts := newTestServer(t, Options{
+		Clock: clk,
+		RateLimits: []RateLimitPolicy{
+			{Name: "list", Routes: []string{"GET /cards"}, Limit: 2, Period: Duration(time.Minute)},
+		},
+	})
+	defer ts.close()
+
+	for _, remaining := range []string{"1", "0"} {
+		resp := ts.do(t, http.MethodGet, "/cards", nil, nil, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %s, want 200", resp.Status)
+		}
+		want := map[string]string{
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": remaining,
+			"RateLimit-Reset":     "50",
+			"RateLimit-Policy":    "2;w=60",
+			"Retry-After":         "",
+		}
+		for name, value := range want {
+			if got := resp.Header.Get(name); got != value {
+				t.Errorf("%s = %q, want %q", name, got, value)
+			}
+		}
+	}
+
+	resp := ts.do(t, http.MethodGet, "/cards", nil, nil, nil)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status = %s, want 429", resp.Status)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "50" {
+		t.Errorf("Retry-After = %q, want 50", got)
+	}
+	if got := resp.Header.Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want 0", got)
+	}
+
+	// the routes of no policy aren't limited nor get the headers.
+	resp = ts.do(t, http.MethodGet, "/", nil, nil, nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("RateLimit-Limit") != "" {
+		t.Errorf("GET / = %s with RateLimit-Limit %q", resp.Status, resp.Header.Get("RateLimit-Limit"))
+	}
+
+	clk.Advance(50 * time.Second)
+	resp = ts.do(t, http.MethodGet, "/cards", nil, nil, nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("RateLimit-Remaining") != "1" {
+		t.Errorf("next window: %s with RateLimit-Remaining %q", resp.Status, resp.Header.Get("RateLimit-Remaining"))
+	}
+}
+
+func TestRateLimitBySession(t *testing.T) {
+	ts := newTestServer(t, Options{
+		RateLimits: []RateLimitPolicy{
+			{Name: "me", Routes: []string{"GET /api/me"}, Key: RateLimitBySession, Limit: 1, Period: Duration(time.Hour)},
+		},
+	})
+	defer ts.close()
+
+	bearer := func(token string) http.Header {
+		return http.Header{"Authorization": {"Bearer " + token}}
+	}
+	var sessions [2]string
+	for i := range sessions {
+		resp := ts.do(t, http.MethodPost, "/login", nil, map[string]string{"username": DefaultUsername, "password": DefaultPassword}, &sessions[i])
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST /login = %s", resp.Status)
+		}
+	}
+
+	// each session has its own counter.
+	for _, token := range sessions {
+		if resp := ts.do(t, http.MethodGet, "/api/me", bearer(token), nil, nil); resp.StatusCode != http.StatusOK {
+			t.Errorf("first request of a session = %s, want 200", resp.Status)
+		}
+	}
+	if resp := ts.do(t, http.MethodGet, "/api/me", bearer(sessions[0]), nil, nil); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("second request of a session = %s, want 429", resp.Status)
+	}
+
+	// tokens of no session share the counter of their IP.
+	if resp := ts.do(t, http.MethodGet, "/api/me", bearer("made-up-1"), nil, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("first made-up token = %s, want 401", resp.Status)
+	}
+	if resp := ts.do(t, http.MethodGet, "/api/me", bearer("made-up-2"), nil, nil); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("second made-up token = %s, want 429", resp.Status)
+	}
+}
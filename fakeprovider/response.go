@@ -0,0 +1,66 @@
+package fakeprovider
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+func unmarshalJSON(r io.ReadCloser, v interface{}) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+type response struct {
+	Status int         `json:"-"`
+	Data   interface{} `json:"data,omitempty"`
+	Meta   interface{} `json:"meta,omitempty"`
+}
+
+// Write writes a ApplicationResposne to the given response writer encoded as JSON.
+func (r *response) Write(w http.ResponseWriter) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(r.Status)
+	_, err = w.Write(b)
+	return err
+}
+
+type errorResponse struct {
+	Status int           `json:"-"`
+	Error  *errorMessage `json:"error,omitempty"`
+}
+
+type errorMessage struct {
+	Message string `json:"message"`
+}
+
+// Write writes a ApplicationResposne to the given response writer encoded as JSON.
+func (er *errorResponse) Write(w http.ResponseWriter) error {
+	b, err := json.Marshal(er)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(er.Status)
+	_, err = w.Write(b)
+	return err
+}
+
+// NewError ...NewError
+func NewError(msg string, status int) *errorResponse {
+	return &errorResponse{
+		Status: status,
+		Error: &errorMessage{
+			Message: msg,
+		},
+	}
+}
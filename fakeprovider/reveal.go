@@ -0,0 +1,75 @@
+package fakeprovider
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// revealedCard holds the sensitive card details returned by the reveal flow.
+type revealedCard struct {
+	NameOnCard string `json:"name_on_card"`
+	PAN        string `json:"card_number"`
+	ExpDate    string `json:"expiry_date"`
+	CVV        string `json:"cvv"`
+}
+
+// encryptedCard is returned instead of revealedCard when the client provides
+// a public key, only the holder of the private key can read the details.
+type encryptedCard struct {
+	JWE string `json:"jwe"`
+}
+
+var errInvalidPublicKey = errors.New("public_key must be a RSA or EC public JWK")
+
+// encryptForClient encrypts v as a compact JWE addressed to the given public
+// JWK. RSA keys use RSA-OAEP-256 (or RSA-OAEP when the key asks for it) and EC
+// keys use ECDH-ES, the content is always encrypted with A256GCM.
+func encryptForClient(rawKey json.RawMessage, v interface{}) (string, error) {
+	var jwk jose.JSONWebKey
+	if err := jwk.UnmarshalJSON(rawKey); err != nil {
+		return "", errInvalidPublicKey
+	}
+
+	var alg jose.KeyAlgorithm
+	switch jwk.Key.(type) {
+	case *rsa.PublicKey:
+		alg = jose.RSA_OAEP_256
+		if jwk.Algorithm == string(jose.RSA_OAEP) {
+			alg = jose.RSA_OAEP
+		}
+	case *ecdsa.PublicKey:
+		alg = jose.ECDH_ES
+	default:
+		return "", errInvalidPublicKey
+	}
+
+	if jwk.Algorithm != "" && jwk.Algorithm != string(alg) {
+		return "", fmt.Errorf("unsupported key algorithm %q", jwk.Algorithm)
+	}
+
+	enc, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{
+		Algorithm: alg,
+		Key:       jwk.Key,
+		KeyID:     jwk.KeyID,
+	}, (&jose.EncrypterOptions{}).WithContentType("application/json"))
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	obj, err := enc.Encrypt(plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	return obj.CompactSerialize()
+}
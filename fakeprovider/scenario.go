@@ -0,0 +1,478 @@
+package fakeprovider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	apierror "github.com/rodrwan/fakeproviders/api-error"
+	"github.com/rodrwan/fakeproviders/clock"
+	"github.com/rodrwan/fakeproviders/logger"
+	"github.com/rodrwan/fakeproviders/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Duration is a time.Duration written as a string such as "15s" in
+// scenario files.
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("invalid duration %s, use a string such as \"15s\"", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// ScenarioFile is the format of the scenario files, either YAML or JSON.
+type ScenarioFile struct {
+	Scenarios []Scenario `json:"scenarios"`
+}
+
+// Scenario scripts the responses of a route. Each request matching Route
+// and Match consumes the next step.
+type Scenario struct {
+	Name string `json:"name"`
+	// Route is the method and the route template, such as "POST /cards" or
+	// "PATCH /cards/:id/info".
+	Route string  `json:"route"`
+	Match Matcher `json:"match,omitempty"`
+	Steps []Step  `json:"steps"`
+	// Repeat starts over once every step was consumed, otherwise the route
+	// behaves normally again.
+	Repeat bool `json:"repeat,omitempty"`
+}
+
+// Matcher narrows the requests a scenario applies to. Every field must be
+// equal, values are compared as strings.
+type Matcher struct {
+	// Body are top level fields of a JSON or form encoded body.
+	Body    map[string]interface{} `json:"body,omitempty"`
+	Query   map[string]string      `json:"query,omitempty"`
+	Headers map[string]string      `json:"headers,omitempty"`
+}
+
+// Step is a scripted behaviour. A step without Status nor Timeout lets the
+// request through to the handler, after Delay.
+type Step struct {
+	// Status of the response, the body is an error with Message unless
+	// Body is given.
+	Status  int               `json:"status,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Delay is waited before responding.
+	Delay Duration `json:"delay,omitempty"`
+	// Timeout is waited before closing the connection without a response.
+	Timeout Duration `json:"timeout,omitempty"`
+	// Times repeats the step, defaults to once.
+	Times int `json:"times,omitempty"`
+}
+
+func (s *Step) passThrough() bool {
+	return s.Status == 0 && s.Timeout == 0
+}
+
+// ParseScenarios parses a YAML or JSON scenario file.
+func ParseScenarios(data []byte) ([]Scenario, error) {
+	var f ScenarioFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	for i := range f.Scenarios {
+		if err := f.Scenarios[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	return f.Scenarios, nil
+}
+
+// LoadScenarios reads a YAML or JSON scenario file.
+func LoadScenarios(path string) ([]Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScenarios(data)
+}
+
+func (sc *Scenario) validate() error {
+	if _, _, err := splitRoute(sc.Route); err != nil {
+		return fmt.Errorf("scenario %q: %v", sc.Name, err)
+	}
+	if len(sc.Steps) == 0 {
+		return fmt.Errorf("scenario %q: no steps", sc.Name)
+	}
+	for i, step := range sc.Steps {
+		if step.Status != 0 && (step.Status < 100 || step.Status > 599) {
+			return fmt.Errorf("scenario %q: step %d: invalid status %d", sc.Name, i+1, step.Status)
+		}
+		if step.Times < 0 || step.Delay < 0 || step.Timeout < 0 {
+			return fmt.Errorf("scenario %q: step %d: negative value", sc.Name, i+1)
+		}
+		if len(step.Body) > 0 && !json.Valid(step.Body) {
+			return fmt.Errorf("scenario %q: step %d: invalid body", sc.Name, i+1)
+		}
+	}
+	return nil
+}
+
+// splitRoute splits "POST /cards" in its method and route template.
+func splitRoute(route string) (string, string, error) {
+	fields := strings.Fields(route)
+	if len(fields) != 2 || !strings.HasPrefix(fields[1], "/") {
+		return "", "", fmt.Errorf("invalid route %q, use \"METHOD /path\"", route)
+	}
+	return strings.ToUpper(fields[0]), fields[1], nil
+}
+
+// ScenarioReport tells how far a loaded scenario went.
+type ScenarioReport struct {
+	Name  string `json:"name"`
+	Route string `json:"route"`
+	Steps int    `json:"steps"`
+	// Consumed is the number of steps consumed in the current round.
+	Consumed int `json:"consumed"`
+	// Rounds is the number of times every step was consumed.
+	Rounds int `json:"rounds"`
+	// Done is set once every step was consumed at least once.
+	Done bool `json:"done"`
+}
+
+// scenarioState is a loaded scenario with its steps expanded by Times.
+type scenarioState struct {
+	Scenario
+	method   string
+	route    string
+	plan     []Step
+	consumed int
+	rounds   int
+}
+
+func (st *scenarioState) active() bool {
+	return st.Repeat || st.rounds == 0
+}
+
+func (st *scenarioState) report() ScenarioReport {
+	return ScenarioReport{
+		Name:     st.Name,
+		Route:    st.Route,
+		Steps:    len(st.plan),
+		Consumed: st.consumed,
+		Rounds:   st.rounds,
+		Done:     st.rounds > 0,
+	}
+}
+
+// scenarioSet holds the loaded scenarios, in load order. The first active
+// scenario matching a request handles it.
+type scenarioSet struct {
+	mu      sync.Mutex
+	list    []*scenarioState
+	metrics *metrics
+	// clock times the delays and timeouts of the steps.
+	clock clock.Clock
+}
+
+func newScenarioSet(m *metrics, clk clock.Clock) *scenarioSet {
+	return &scenarioSet{metrics: m, clock: clk}
+}
+
+// add loads scenarios after the existing ones.
+func (s *scenarioSet) add(scenarios []Scenario) error {
+	states := make([]*scenarioState, 0, len(scenarios))
+	for _, sc := range scenarios {
+		if err := sc.validate(); err != nil {
+			return err
+		}
+		method, route, _ := splitRoute(sc.Route)
+		st := &scenarioState{Scenario: sc, method: method, route: route}
+		for _, step := range sc.Steps {
+			times := step.Times
+			if times == 0 {
+				times = 1
+			}
+			for i := 0; i < times; i++ {
+				st.plan = append(st.plan, step)
+			}
+		}
+		states = append(states, st)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.list = append(s.list, states...)
+	return nil
+}
+
+// clear unloads every scenario.
+func (s *scenarioSet) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.list = nil
+}
+
+// reset replaces the loaded scenarios, starting them from their first step.
+func (s *scenarioSet) reset(scenarios []Scenario) error {
+	s.clear()
+	return s.add(scenarios)
+}
+
+func (s *scenarioSet) reports() []ScenarioReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reports := make([]ScenarioReport, 0, len(s.list))
+	for _, st := range s.list {
+		reports = append(reports, st.report())
+	}
+	return reports
+}
+
+// candidates returns whether a scenario may apply to the route and whether
+// one of them needs the request body.
+func (s *scenarioSet) candidates(method, route string) (found, needBody bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, st := range s.list {
+		if st.active() && st.method == method && st.route == route {
+			found = true
+			needBody = needBody || len(st.Match.Body) > 0
+		}
+	}
+	return found, needBody
+}
+
+// next consumes the step of the first scenario matching the request.
+func (s *scenarioSet) next(r *http.Request, route string, body map[string]interface{}) (*scenarioState, Step, int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, st := range s.list {
+		if !st.active() || st.method != r.Method || st.route != route || !st.Match.matches(r, body) {
+			continue
+		}
+
+		n := st.consumed
+		step := st.plan[n]
+		st.consumed++
+		if st.consumed == len(st.plan) {
+			st.consumed = 0
+			st.rounds++
+		}
+		return st, step, n + 1, true
+	}
+	return nil, Step{}, 0, false
+}
+
+func (m *Matcher) matches(r *http.Request, body map[string]interface{}) bool {
+	for k, v := range m.Headers {
+		if r.Header.Get(k) != v {
+			return false
+		}
+	}
+	query := r.URL.Query()
+	for k, v := range m.Query {
+		if query.Get(k) != v {
+			return false
+		}
+	}
+	for k, v := range m.Body {
+		got, ok := body[k]
+		if !ok || fmt.Sprint(got) != fmt.Sprint(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// readFields reads the top level fields of a JSON or form encoded body,
+// leaving the body readable by the handler.
+func readFields(r *http.Request) (map[string]interface{}, error) {
+	b, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	// clients often send JSON with the default form content type, so JSON is
+	// tried first. Other bodies don't match any body field.
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(b, &fields); err == nil {
+		return fields, nil
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(string(b))
+		if err != nil {
+			return nil, err
+		}
+		for k := range values {
+			fields[k] = values.Get(k)
+		}
+	}
+	return fields, nil
+}
+
+// Handle plays the steps of the scenarios matching the request, the other
+// requests go to next.
+func (s *scenarioSet) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := logger.RouteFromContext(r.Context())
+		found, needBody := s.candidates(r.Method, route)
+		if !found {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body map[string]interface{}
+		if needBody {
+			var err error
+			if body, err = readFields(r); err != nil {
+				apierror.NewError(err.Error(), http.StatusBadRequest).Write(w)
+				return
+			}
+		}
+
+		st, step, n, ok := s.next(r, route, body)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logger.FromContext(r.Context()).WithField("scenario", st.Name).
+			WithField("scenario_step", n).Info("playing scenario step")
+		_, span := tracing.Start(r.Context(), "scenario_step",
+			attribute.String("scenario", st.Name), attribute.Int("step", n))
+		defer span.End()
+
+		if step.Delay > 0 {
+			s.metrics.delaySimulated(r, time.Duration(step.Delay))
+			if !sleepContext(r, s.clock, time.Duration(step.Delay)) {
+				return
+			}
+		}
+		if step.passThrough() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s.metrics.faultInjected(r)
+		if step.Timeout > 0 {
+			if sleepContext(r, s.clock, time.Duration(step.Timeout)) {
+				dropConnection(w)
+			}
+			return
+		}
+
+		for k, v := range step.Headers {
+			w.Header().Set(k, v)
+		}
+		switch {
+		case len(step.Body) > 0:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(step.Status)
+			w.Write(step.Body)
+		case step.Status >= http.StatusBadRequest:
+			msg := step.Message
+			if msg == "" {
+				msg = http.StatusText(step.Status)
+			}
+			apierror.NewError(msg, step.Status).Write(w)
+		default:
+			w.WriteHeader(step.Status)
+		}
+	})
+}
+
+// sleepContext waits for d on clk, it returns false when the client went
+// away before. A frozen virtual clock only wakes it once moved past d.
+func sleepContext(r *http.Request, clk clock.Clock, d time.Duration) bool {
+	done := make(chan struct{})
+	t := clk.AfterFunc(d, func() { close(done) })
+	defer t.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// dropConnection closes the client connection without writing a response.
+func dropConnection(w http.ResponseWriter) {
+	if hj, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hj.Hijack(); err == nil {
+			conn.Close()
+			return
+		}
+	}
+	// the server aborts the response and closes the connection.
+	panic(http.ErrAbortHandler)
+}
+
+var errNoScenarios = errors.New("no scenarios given")
+
+// loadScenarios loads the scenarios of a YAML or JSON scenario file sent as
+// the body.
+func loadScenarios(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	defer r.Body.Close()
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	scenarios, err := ParseScenarios(b)
+	if err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+	if len(scenarios) == 0 {
+		return &response{Status: http.StatusBadRequest, Data: errNoScenarios.Error()}, nil
+	}
+	if err := ctx.scenarios.add(scenarios); err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+
+	return &response{
+		Status: http.StatusCreated,
+		Data:   ctx.scenarios.reports(),
+	}, nil
+}
+
+// listScenarios reports the progress of the loaded scenarios.
+func listScenarios(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	return &response{
+		Status: http.StatusOK,
+		Data:   ctx.scenarios.reports(),
+	}, nil
+}
+
+// clearScenarios unloads every scenario.
+func clearScenarios(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	ctx.scenarios.clear()
+	return &response{
+		Status: http.StatusOK,
+		Data:   []ScenarioReport{},
+	}, nil
+}
@@ -0,0 +1,515 @@
+// Package fakeprovider implements a fake card issuer API. The server can run
+// standalone through cmd/server or be embedded in Go tests:
+//
+//	srv, err := fakeprovider.New(fakeprovider.Options{})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	ts := httptest.NewServer(srv)
+//	defer ts.Close()
+package fakeprovider
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/clock"
+	"github.com/rodrwan/fakeproviders/logger"
+	"github.com/rodrwan/fakeproviders/requestid"
+	"github.com/rodrwan/fakeproviders/tracing"
+	"github.com/rodrwan/fakeproviders/vault"
+	corsLib "github.com/rs/cors"
+)
+
+// Default credentials, used for the empty fields of Credentials.
+const (
+	DefaultAPIToken      = "fasdfadfa9fj987afsdf"
+	DefaultUsername      = "lala@example.org"
+	DefaultPassword      = "lala1234"
+	DefaultUserID        = "ff2ecbed-cca9-413b-90b7-e9bd2a8d54c0"
+	DefaultSessionSecret = "awesome-sess-secret-key"
+	DefaultSessionMaxAge = time.Hour
+)
+
+// Cardholder is a user whose card is created when the server starts.
+type Cardholder struct {
+	// CardID is the id of the card, a random one is used when empty.
+	CardID string `json:"card_id,omitempty"`
+	// ReferenceID, CardNumber and ExpDate, as MM/YY, are generated when
+	// empty.
+	ReferenceID string `json:"reference_id,omitempty"`
+	CardNumber  string `json:"card_number,omitempty"`
+	ExpDate     string `json:"exp_date,omitempty"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	Email       string `json:"email"`
+	// Balance is the balance of the card once Transactions are applied.
+	Balance int64 `json:"balance"`
+	// Status defaults to active.
+	Status string `json:"status,omitempty"`
+	// CreatedAt defaults to the time the server starts.
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	// Transactions are recorded in the ledger of the card.
+	Transactions []Transaction `json:"transactions,omitempty"`
+}
+
+// Transaction is a past movement of the balance of a seeded card, positive
+// amounts are loads and negative ones purchases.
+type Transaction struct {
+	Amount      int64     `json:"amount"`
+	Description string    `json:"description,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+// DefaultSeed returns the cardholders of the standalone server. The last one
+// owns the card of the default session user.
+func DefaultSeed() []Cardholder {
+	return []Cardholder{
+		{FirstName: "louane", LastName: "vidal", Email: "louane.vidal@example.com"},
+		{FirstName: "noel", LastName: "peixoto", Email: "noel.peixoto@example.com"},
+		{FirstName: "manuel", LastName: "lorenzo", Email: "manuel.lorenzo@example.com"},
+		{FirstName: "alberto", LastName: "lozano", Email: "alberto.lozano@example.com"},
+		{CardID: DefaultUserID, FirstName: "lala", LastName: "lalo", Email: "lala@example.com"},
+	}
+}
+
+// Credentials are the secrets accepted by the server.
+type Credentials struct {
+	// APIToken authenticates DELETE /cards/:id and PATCH /cards/:id/info.
+	APIToken string
+	// AdminToken authenticates the /_admin routes, defaults to APIToken.
+	AdminToken string
+	// Username and Password are accepted by /login, which opens a session
+	// for UserID.
+	Username string
+	Password string
+	UserID   string
+
+	SessionSecret []byte
+	SessionMaxAge time.Duration
+}
+
+func (c Credentials) withDefaults() Credentials {
+	if c.APIToken == "" {
+		c.APIToken = DefaultAPIToken
+	}
+	if c.AdminToken == "" {
+		c.AdminToken = c.APIToken
+	}
+	if c.Username == "" {
+		c.Username = DefaultUsername
+	}
+	if c.Password == "" {
+		c.Password = DefaultPassword
+	}
+	if c.UserID == "" {
+		c.UserID = DefaultUserID
+	}
+	if len(c.SessionSecret) == 0 {
+		c.SessionSecret = []byte(DefaultSessionSecret)
+	}
+	if c.SessionMaxAge == 0 {
+		c.SessionMaxAge = DefaultSessionMaxAge
+	}
+	return c
+}
+
+// RateLimit limits the requests per client IP to every API route. The zero
+// value disables it, see Options.RateLimits for finer policies.
+type RateLimit struct {
+	Limit  int64
+	Period time.Duration
+}
+
+func (rl RateLimit) policy() RateLimitPolicy {
+	return RateLimitPolicy{
+		Name:   "default",
+		Key:    RateLimitByIP,
+		Limit:  rl.Limit,
+		Period: Duration(rl.Period),
+	}
+}
+
+// DefaultRateLimit returns the rate limit of the standalone server.
+func DefaultRateLimit() RateLimit {
+	return RateLimit{Limit: 2, Period: 10 * time.Second}
+}
+
+// Options configures a Server. The zero value is a quiet server, without
+// injected faults, delays or rate limits, seeded with DefaultSeed.
+type Options struct {
+	// Seed is the initial set of cardholders, nil uses DefaultSeed and an
+	// empty slice starts without cards.
+	Seed []Cardholder
+	// State is a snapshot written by Server.WriteSnapshot, its tenants are
+	// restored instead of Seed when set. It must be sealed with Keyring.
+	State io.Reader
+	// Clock is the time source of every timestamp, session, TOTP code and
+	// timer. Defaults to a clock.Virtual following the system clock, which
+	// the admin API can freeze, set and advance.
+	Clock clock.Clock
+	// Chaos configures the injected faults and delays.
+	Chaos Chaos
+	// JIT enables the JIT funding mode, see JIT.
+	JIT       JIT
+	RateLimit RateLimit
+	// RateLimits are applied in addition to RateLimit, a request is rejected
+	// when any policy of its route is exhausted.
+	RateLimits []RateLimitPolicy
+	// Scenarios script the responses of some routes, see LoadScenarios.
+	Scenarios   []Scenario
+	Credentials Credentials
+
+	// Keyring encrypts the card secrets, a random key is used when nil.
+	Keyring *vault.Keyring
+	// TOTPSkew is the number of time steps a TOTP code may drift, it can't
+	// be negative.
+	TOTPSkew int
+	// Personalities are the APIs served by ServeHTTP, DefaultPersonality
+	// when empty. Server.Handler serves others on more listeners.
+	Personalities []string
+	// TenantTokens maps API tokens to the tenant of their requests, they are
+	// accepted like Credentials.APIToken.
+	TenantTokens map[string]string
+	// MaxTenants bounds the number of tenants, the default one included,
+	// DefaultMaxTenants when zero.
+	MaxTenants int
+
+	// TrustedProxies are the proxies whose forwarding headers tell the IP of
+	// the client to the rate limits, see logger.ParseTrustedProxies. The
+	// headers are ignored when empty.
+	TrustedProxies []*net.IPNet
+
+	// LoggerOptions configure the access logger.
+	LoggerOptions []logger.Option
+	// ValidateRequests and ValidateResponses check the traffic against the
+	// OpenAPI document.
+	ValidateRequests  bool
+	ValidateResponses bool
+	// CORSDebug logs the CORS decisions.
+	CORSDebug bool
+	// SeparateAdmin leaves the /_admin routes out of the Server handler, they
+	// are only served by AdminHandler.
+	SeparateAdmin bool
+}
+
+// Server is a fake provider instance. It is safe for concurrent use and
+// independent from any other Server.
+type Server struct {
+	ctx     *Context
+	chains  *routeChains
+	cors    *corsLib.Cors
+	handler http.Handler
+	admin   http.Handler
+	// adminRoutes registers the admin routes on every handler, unless they
+	// are served by admin.
+	adminRoutes func(*Router)
+	sweeper     *expirySweeper
+}
+
+// New returns a Server configured by opts.
+func New(opts Options) (*Server, error) {
+	creds := opts.Credentials.withDefaults()
+
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.NewVirtual(time.Now())
+	}
+
+	keyring := opts.Keyring
+	if keyring == nil {
+		var err error
+		if keyring, err = newKeyring(""); err != nil {
+			return nil, err
+		}
+	}
+
+	seed := opts.Seed
+	if seed == nil {
+		seed = DefaultSeed()
+	}
+	if err := opts.Chaos.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.JIT.validate(); err != nil {
+		return nil, err
+	}
+	if opts.TOTPSkew < 0 {
+		return nil, errors.New("the TOTP skew can't be negative")
+	}
+
+	cc := &Context{
+		keyring:          keyring,
+		clock:            clk,
+		seed:             seed,
+		seedScenarios:    opts.Scenarios,
+		seedChaos:        opts.Chaos,
+		seedJIT:          opts.JIT,
+		username:         creds.Username,
+		password:         creds.Password,
+		userUUID:         creds.UserID,
+		sessionSecretKey: creds.SessionSecret,
+		sessionMaxAge:    int(creds.SessionMaxAge / time.Second),
+		totpSkew:         opts.TOTPSkew,
+	}
+	cc.seedState = newSeedStates(nil)
+	if opts.State != nil {
+		snap, err := decodeSnapshot(opts.State)
+		if err != nil {
+			return nil, err
+		}
+		cc.seedState = newSeedStates(snap.Tenants)
+	}
+	cc.metrics = newMetrics(cc)
+	cc.webhooks = startWebhookSender()
+	tenantTokens := make([]string, 0, len(opts.TenantTokens))
+	for token := range opts.TenantTokens {
+		tenantTokens = append(tenantTokens, token)
+	}
+	// the API and admin tokens create the tenants they select.
+	tenantAuth := NewAuthMiddleware(creds.APIToken, append([]string{creds.AdminToken}, tenantTokens...)...)
+	tenants, err := newTenantSet(cc, opts.TenantTokens, tenantAuth, opts.MaxTenants)
+	if err != nil {
+		return nil, err
+	}
+	cc.tenants = tenants
+	// the default tenant is created upfront so an invalid startup state
+	// fails here.
+	defaultTenant, err := tenants.get(DefaultTenant)
+	if err != nil {
+		return nil, err
+	}
+	cc = cc.forTenant(defaultTenant)
+	// so are the tenants of the startup snapshot, which saving the state
+	// keeps even when they aren't used.
+	for _, id := range cc.seedState.ids() {
+		if !validTenantID.MatchString(id) {
+			return nil, fmt.Errorf("tenant %s: %v", id, errInvalidTenant)
+		}
+		if _, err := tenants.get(id); err != nil {
+			return nil, fmt.Errorf("tenant %s: %v", id, err)
+		}
+	}
+
+	logOpts := append([]logger.Option{
+		logger.WithObserver(cc.metrics.observeRequest),
+		logger.WithObserver(tracing.ObserveRequest),
+	}, opts.LoggerOptions...)
+	fakeLogger := logger.NewLogger("fakeprovider", logOpts...)
+
+	policies := opts.RateLimits
+	if opts.RateLimit.Limit > 0 {
+		policies = append([]RateLimitPolicy{opts.RateLimit.policy()}, policies...)
+	}
+	if err := validateRateLimits(policies); err != nil {
+		return nil, err
+	}
+	apiAuth := NewAuthMiddleware(creds.APIToken, tenantTokens...)
+	cc.rateLimits = newRateLimiter(cc, policies, apiAuth, opts.TrustedProxies)
+	adminAuth := NewAuthMiddleware(creds.AdminToken)
+
+	rc := &routeChains{
+		ctx:     cc,
+		logger:  fakeLogger,
+		apiAuth: apiAuth,
+	}
+	if opts.ValidateRequests || opts.ValidateResponses {
+		if rc.validator, err = NewOpenAPIValidator(opts.ValidateRequests, opts.ValidateResponses); err != nil {
+			return nil, err
+		}
+	}
+
+	// admin wraps the routes controlling the server, they require the admin
+	// token and aren't subject to scenarios nor rate limits.
+	adminHandler := func(h handlerFunc) http.Handler {
+		return tracing.Middleware("logger", fakeLogger.Handle(
+			tracing.Middleware("auth", adminAuth.Handle(
+				tracing.Middleware("handler", ContextHandler{ctx: cc, H: h}),
+			)),
+		))
+	}
+	// adminRoutes registers the admin routes, wrapped by wrap.
+	adminRoutes := func(ar *Router, wrap func(http.Handler) http.Handler) {
+		admin := func(h handlerFunc) http.Handler {
+			return wrap(adminHandler(h))
+		}
+		ar.POST("/_admin/reset", admin(resetState))
+		ar.POST("/_admin/clear", admin(clearState))
+		ar.POST("/_admin/import", admin(importCards))
+		ar.PATCH("/_admin/cards/:id", admin(setCard))
+		ar.GET("/_admin/keys", admin(listAuthKeys))
+		ar.POST("/_admin/kek/rotate", admin(rotateKeys))
+		ar.DELETE("/_admin/kek/:id", admin(removeKey))
+		ar.GET("/_admin/snapshot", admin(getSnapshot))
+		ar.PUT("/_admin/snapshot", admin(restoreSnapshotHandler))
+		ar.GET("/_admin/clock", admin(getClock))
+		ar.PUT("/_admin/clock", admin(setClock))
+		ar.POST("/_admin/clock/advance", admin(advanceClock))
+		ar.GET("/_admin/chaos", admin(getChaos))
+		ar.PUT("/_admin/chaos", admin(setChaos))
+		ar.GET("/_admin/jit", admin(getJIT))
+		ar.PUT("/_admin/jit", admin(setJIT))
+		ar.GET("/_admin/scenarios", admin(listScenarios))
+		ar.POST("/_admin/scenarios", admin(loadScenarios))
+		ar.DELETE("/_admin/scenarios", admin(clearScenarios))
+		ar.GET("/_admin/rate-limits", admin(getRateLimits))
+		ar.PUT("/_admin/rate-limits", admin(setRateLimits))
+		ar.GET("/_admin/tenants", admin(listTenants))
+		ar.DELETE("/_admin/tenants/:tenant", admin(removeTenant))
+	}
+
+	s := &Server{
+		ctx:    cc,
+		chains: rc,
+		cors: corsLib.New(corsLib.Options{
+			AllowedOrigins:     []string{"*"},
+			AllowedHeaders:     []string{"Accept", "Authorization", "Content-Type", "Credentials", requestid.HeaderKey, TenantHeader},
+			ExposedHeaders:     []string{requestid.HeaderKey, "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
+			AllowedMethods:     []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowCredentials:   true,
+			OptionsPassthrough: true,
+			Debug:              opts.CORSDebug,
+		}),
+	}
+	if opts.SeparateAdmin {
+		ar := NewRouter()
+		adminRoutes(ar, func(h http.Handler) http.Handler { return h })
+		s.admin = requestid.Handle(tracing.Handle(cc.tenants.Handle(ar)))
+	} else {
+		// the admin routes are documented, they are validated like the API.
+		s.adminRoutes = func(r *Router) {
+			adminRoutes(r, rc.validate)
+		}
+	}
+
+	if s.handler, err = s.Handler(opts.Personalities...); err != nil {
+		return nil, err
+	}
+	s.sweeper = startExpirySweeper(cc)
+	return s, nil
+}
+
+// Handler returns a handler serving the APIs of the named personalities,
+// the default one when none is given, to serve them on another listener.
+// Every handler of a Server shares its state.
+func (s *Server) Handler(names ...string) (http.Handler, error) {
+	ps, err := lookupPersonalities(names)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewRouter()
+	r.GET("/metrics", s.ctx.metrics.Handler())
+	if err := registerRoutes(r, s.chains, ps); err != nil {
+		return nil, err
+	}
+	if s.adminRoutes != nil {
+		s.adminRoutes(r)
+	}
+	return requestid.Handle(tracing.Handle(s.cors.Handler(s.ctx.tenants.Handle(r)))), nil
+}
+
+// Close stops the background jobs of the server, the webhooks not sent yet
+// are dropped.
+func (s *Server) Close() error {
+	s.sweeper.stop()
+	s.ctx.webhooks.stop()
+	return nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// AdminHandler returns the handler of the /_admin routes, to serve them on a
+// separate listener together with Options.SeparateAdmin.
+func (s *Server) AdminHandler() http.Handler {
+	return s.admin
+}
+
+// seedCards creates a card for each cardholder, and the ledger entries of
+// their transactions.
+func seedCards(kr *vault.Keyring, seed []Cardholder, now time.Time) ([]*card, []ledgerEntry, error) {
+	cards := make([]*card, 0, len(seed))
+	var ledger []ledgerEntry
+	for _, ch := range seed {
+		if ch.Status != "" && !validCardStatus(ch.Status) {
+			return nil, nil, fmt.Errorf("cardholder %s: invalid card status %s", ch.Email, ch.Status)
+		}
+		if ch.CardNumber != "" && len(ch.CardNumber) < 12 {
+			return nil, nil, fmt.Errorf("cardholder %s: invalid card number", ch.Email)
+		}
+
+		createdAt := now
+		if !ch.CreatedAt.IsZero() {
+			createdAt = ch.CreatedAt
+		}
+		c, err := newCard(kr, &user{
+			FirstName: ch.FirstName,
+			LastName:  ch.LastName,
+			Email:     ch.Email,
+		}, createdAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ch.CardNumber != "" || ch.ExpDate != "" {
+			secrets, err := c.Reveal(kr)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ch.CardNumber != "" {
+				secrets.PAN = ch.CardNumber
+				secrets.CVV = cardCVV(ch.CardNumber)
+				c.SetPAN(ch.CardNumber)
+			}
+			if ch.ExpDate != "" {
+				secrets.ExpDate = ch.ExpDate
+			}
+			if err := c.SetSecrets(kr, secrets.PAN, secrets.ExpDate, secrets.CVV); err != nil {
+				return nil, nil, err
+			}
+		}
+		if ch.CardID != "" {
+			c.ID = ch.CardID
+		}
+		if ch.ReferenceID != "" {
+			c.ReferenceID = ch.ReferenceID
+		}
+		if ch.Status != "" {
+			c.SetStatus(ch.Status)
+		}
+		c.SetBalance(ch.Balance)
+
+		// the transactions end on the balance of the card.
+		balance := ch.Balance
+		for _, t := range ch.Transactions {
+			balance -= t.Amount
+		}
+		for _, t := range ch.Transactions {
+			balance += t.Amount
+			entryType := ledgerLoad
+			if t.Amount < 0 {
+				entryType = ledgerPurchase
+			}
+			ledger = append(ledger, ledgerEntry{
+				ID:          newID(),
+				CardID:      c.ID,
+				Type:        entryType,
+				Amount:      t.Amount,
+				Balance:     balance,
+				Description: t.Description,
+				CreatedAt:   t.At,
+			})
+			if t.At.After(c.UpdatedAt) {
+				c.UpdatedAt = t.At
+			}
+		}
+		cards = append(cards, c)
+	}
+	return cards, ledger, nil
+}
@@ -0,0 +1,74 @@
+package fakeprovider
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rodrwan/fakeproviders/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// testServer is a Server listening on a local port.
+type testServer struct {
+	*Server
+	http *httptest.Server
+}
+
+// newTestServer starts a quiet server, the caller closes it.
+func newTestServer(t *testing.T, opts Options) *testServer {
+	t.Helper()
+	opts.LoggerOptions = append(opts.LoggerOptions, logger.WithLevel(logrus.PanicLevel))
+	srv, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{Server: srv, http: httptest.NewServer(srv)}
+}
+
+func (ts *testServer) close() {
+	ts.http.Close()
+	ts.Server.Close()
+}
+
+// do sends a request with the API token and decodes the data of the
+// response envelope into out, when not nil.
+func (ts *testServer) do(t *testing.T, method, path string, header http.Header, in, out interface{}) *http.Response {
+	t.Helper()
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, ts.http.URL+path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+DefaultAPIToken)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != nil {
+		if err := json.Unmarshal(b, &struct {
+			Data interface{} `json:"data"`
+		}{out}); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, b)
+		}
+	}
+	return resp
+}
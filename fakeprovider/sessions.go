@@ -0,0 +1,38 @@
+package fakeprovider
+
+import (
+	"context"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/tracing"
+)
+
+// sessionRecord is a session opened by POST /login. Tokens of sessions that
+// aren't recorded, for instance dropped by a reset, are rejected.
+type sessionRecord struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Origin    string    `json:"origin,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *store) addSession(ctx context.Context, sess *sessionRecord) {
+	_, span := tracing.Start(ctx, "store.add_session")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sess.ID] = sess
+}
+
+func (s *store) hasSession(ctx context.Context, id string) bool {
+	_, span := tracing.Start(ctx, "store.get_session")
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.sessions[id]
+	return ok
+}
@@ -0,0 +1,638 @@
+package fakeprovider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/logger"
+	"github.com/rodrwan/fakeproviders/tracing"
+	"github.com/rodrwan/fakeproviders/vault"
+)
+
+// snapshotVersion is the version of the snapshots written by the server.
+// The snapshots of version 1 hold the state of the default tenant and are
+// still read, any other version is rejected.
+const snapshotVersion = 2
+
+// snapshot is the whole state of the server, the state of each tenant by
+// id.
+type snapshot struct {
+	Version int                        `json:"version"`
+	TakenAt time.Time                  `json:"taken_at"`
+	Tenants map[string]*tenantSnapshot `json:"tenants"`
+}
+
+// tenantSnapshot is the state of a tenant. The card secrets, TOTP secrets
+// and webhook signing secrets stay sealed, restoring a snapshot needs the
+// key-encryption key it was taken with.
+type tenantSnapshot struct {
+	Cards       []snapshotCard   `json:"cards"`
+	Ledger      []ledgerEntry    `json:"ledger"`
+	Sessions    []sessionRecord  `json:"sessions"`
+	PendingKeys []pendingAuthKey `json:"pending_keys"`
+	TOTP        []snapshotTOTP   `json:"totp"`
+	// Authorizations, Cardholders and WebhookEndpoints are only set once
+	// the Stripe API is used.
+	Authorizations   []authorization           `json:"authorizations,omitempty"`
+	Cardholders      []cardholderRecord        `json:"cardholders,omitempty"`
+	WebhookEndpoints []snapshotWebhookEndpoint `json:"webhook_endpoints,omitempty"`
+}
+
+type snapshotCard struct {
+	card
+	Secrets *vault.Envelope `json:"secrets"`
+}
+
+type snapshotTOTP struct {
+	UserID    string          `json:"user_id"`
+	Confirmed bool            `json:"confirmed"`
+	LastStep  int64           `json:"last_step"`
+	Secret    *vault.Envelope `json:"secret"`
+	// Pending is the secret replacing Secret once confirmed.
+	Pending *vault.Envelope `json:"pending,omitempty"`
+}
+
+type snapshotWebhookEndpoint struct {
+	webhookEndpoint
+	Secret *vault.Envelope `json:"secret"`
+}
+
+const (
+	secretTOTP    = "totp_secret"
+	secretWebhook = "webhook_secret"
+)
+
+// storeState is the content of a store.
+type storeState struct {
+	cards            []*card
+	ledger           []ledgerEntry
+	sessions         []sessionRecord
+	keys             map[string]authKey
+	authorizations   []authorization
+	cardholders      []cardholderRecord
+	webhookEndpoints []webhookEndpoint
+}
+
+// dump returns a copy of the content of the store, taken at once.
+func (s *store) dump(ctx context.Context) storeState {
+	_, span := tracing.Start(ctx, "store.dump")
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st := storeState{
+		cards:            make([]*card, len(s.cards)),
+		ledger:           make([]ledgerEntry, len(s.ledger)),
+		sessions:         make([]sessionRecord, 0, len(s.sessions)),
+		keys:             make(map[string]authKey, len(s.authKeys)),
+		authorizations:   make([]authorization, len(s.authorizations)),
+		cardholders:      make([]cardholderRecord, len(s.cardholders)),
+		webhookEndpoints: make([]webhookEndpoint, len(s.webhookEndpoints)),
+	}
+	for i, c := range s.cards {
+		st.cards[i] = c.clone()
+	}
+	for i, e := range s.ledger {
+		st.ledger[i] = *e
+	}
+	for _, sess := range s.sessions {
+		st.sessions = append(st.sessions, *sess)
+	}
+	for userID, key := range s.authKeys {
+		st.keys[userID] = *key
+	}
+	for i, a := range s.authorizations {
+		st.authorizations[i] = *a
+	}
+	for i, ch := range s.cardholders {
+		st.cardholders[i] = *ch
+	}
+	for i, e := range s.webhookEndpoints {
+		st.webhookEndpoints[i] = *e
+	}
+	return st
+}
+
+// restore replaces the whole content of the store.
+func (s *store) restore(ctx context.Context, st storeState) {
+	_, span := tracing.Start(ctx, "store.restore")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cards = st.cards
+	s.ledger = make([]*ledgerEntry, len(st.ledger))
+	for i := range st.ledger {
+		e := st.ledger[i]
+		s.ledger[i] = &e
+	}
+	s.sessions = make(map[string]*sessionRecord, len(st.sessions))
+	for i := range st.sessions {
+		sess := st.sessions[i]
+		s.sessions[sess.ID] = &sess
+	}
+	s.authKeys = make(map[string]*authKey, len(st.keys))
+	for userID, key := range st.keys {
+		k := key
+		s.authKeys[userID] = &k
+	}
+	s.authorizations = make([]*authorization, len(st.authorizations))
+	for i := range st.authorizations {
+		a := st.authorizations[i]
+		s.authorizations[i] = &a
+	}
+	s.cardholders = make([]*cardholderRecord, len(st.cardholders))
+	for i := range st.cardholders {
+		ch := st.cardholders[i]
+		s.cardholders[i] = &ch
+	}
+	s.webhookEndpoints = make([]*webhookEndpoint, len(st.webhookEndpoints))
+	for i := range st.webhookEndpoints {
+		e := st.webhookEndpoints[i]
+		s.webhookEndpoints[i] = &e
+	}
+}
+
+// dump returns copies of the enrollments indexed by user id.
+func (s *totpStore) dump() map[string]totpEnrollment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	enrollments := make(map[string]totpEnrollment, len(s.enrollments))
+	for userID, e := range s.enrollments {
+		enrollments[userID] = *e
+	}
+	return enrollments
+}
+
+// restore replaces every enrollment.
+func (s *totpStore) restore(enrollments map[string]totpEnrollment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enrollments = make(map[string]*totpEnrollment, len(enrollments))
+	for userID, e := range enrollments {
+		enrollment := e
+		s.enrollments[userID] = &enrollment
+	}
+}
+
+// takeSnapshot captures the state of every tenant.
+func (ts *tenantSet) takeSnapshot(c context.Context) (*snapshot, error) {
+	tenants := ts.list()
+	snap := &snapshot{
+		Version: snapshotVersion,
+		TakenAt: ts.ctx.now(),
+		Tenants: make(map[string]*tenantSnapshot, len(tenants)),
+	}
+	for _, t := range tenants {
+		state, err := ts.ctx.forTenant(t).takeTenantSnapshot(c)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %v", t.id, err)
+		}
+		snap.Tenants[t.id] = state
+	}
+	return snap, nil
+}
+
+// takeTenantSnapshot captures the state of the tenant of ctx.
+func (ctx *Context) takeTenantSnapshot(c context.Context) (*tenantSnapshot, error) {
+	st := ctx.store.dump(c)
+
+	snap := &tenantSnapshot{
+		Cards:          make([]snapshotCard, len(st.cards)),
+		Ledger:         st.ledger,
+		Sessions:       st.sessions,
+		PendingKeys:    make([]pendingAuthKey, 0, len(st.keys)),
+		TOTP:           []snapshotTOTP{},
+		Authorizations: st.authorizations,
+		Cardholders:    st.cardholders,
+	}
+	for i, card := range st.cards {
+		snap.Cards[i] = snapshotCard{card: *card, Secrets: card.secrets}
+	}
+	sort.Slice(snap.Sessions, func(i, j int) bool { return snap.Sessions[i].CreatedAt.Before(snap.Sessions[j].CreatedAt) })
+	for userID, key := range st.keys {
+		snap.PendingKeys = append(snap.PendingKeys, pendingAuthKey{UserID: userID, Key: key.Key, ExpiresAt: key.ExpiresAt})
+	}
+	sort.Slice(snap.PendingKeys, func(i, j int) bool { return snap.PendingKeys[i].UserID < snap.PendingKeys[j].UserID })
+
+	for userID, e := range ctx.totp.dump() {
+		env, err := ctx.keyring.Seal(map[string]string{
+			secretTOTP: base64.StdEncoding.EncodeToString(e.Secret),
+		})
+		if err != nil {
+			return nil, err
+		}
+		var pending *vault.Envelope
+		if e.Pending != nil {
+			if pending, err = ctx.keyring.Seal(map[string]string{
+				secretTOTP: base64.StdEncoding.EncodeToString(e.Pending),
+			}); err != nil {
+				return nil, err
+			}
+		}
+		snap.TOTP = append(snap.TOTP, snapshotTOTP{
+			UserID:    userID,
+			Confirmed: e.Confirmed,
+			LastStep:  e.LastStep,
+			Secret:    env,
+			Pending:   pending,
+		})
+	}
+	sort.Slice(snap.TOTP, func(i, j int) bool { return snap.TOTP[i].UserID < snap.TOTP[j].UserID })
+
+	for _, e := range st.webhookEndpoints {
+		env, err := ctx.keyring.Seal(map[string]string{secretWebhook: e.secret})
+		if err != nil {
+			return nil, err
+		}
+		snap.WebhookEndpoints = append(snap.WebhookEndpoints, snapshotWebhookEndpoint{webhookEndpoint: e, Secret: env})
+	}
+	return snap, nil
+}
+
+// seedStates is the state of the tenants of the startup snapshot by id.
+// rotateKeys re-wraps its envelopes, it replaces the tenant states instead of
+// updating them so the resets reading them don't need the lock.
+type seedStates struct {
+	mu      sync.RWMutex
+	tenants map[string]*tenantSnapshot
+}
+
+func newSeedStates(tenants map[string]*tenantSnapshot) *seedStates {
+	if tenants == nil {
+		tenants = make(map[string]*tenantSnapshot)
+	}
+	return &seedStates{tenants: tenants}
+}
+
+// get returns the startup state of the tenant id, nil when it has none.
+func (s *seedStates) get(id string) *tenantSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tenants[id]
+}
+
+// ids returns the tenants having a startup state.
+func (s *seedStates) ids() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.tenants))
+	for id := range s.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// rewrap re-wraps the card, TOTP and webhook envelopes with the primary key
+// of kr and returns how many were.
+func (s *seedStates) rewrap(kr *vault.Keyring) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	rewrap := func(env *vault.Envelope) (*vault.Envelope, error) {
+		if env == nil {
+			return nil, nil
+		}
+		n++
+		return kr.Rewrap(env)
+	}
+	tenants := make(map[string]*tenantSnapshot, len(s.tenants))
+	for id, state := range s.tenants {
+		rewrapped := *state
+		rewrapped.Cards = make([]snapshotCard, len(state.Cards))
+		for i, sc := range state.Cards {
+			env, err := rewrap(sc.Secrets)
+			if err != nil {
+				return 0, fmt.Errorf("tenant %s: card %s: %v", id, sc.ID, err)
+			}
+			sc.Secrets = env
+			rewrapped.Cards[i] = sc
+		}
+		rewrapped.TOTP = make([]snapshotTOTP, len(state.TOTP))
+		for i, t := range state.TOTP {
+			env, err := rewrap(t.Secret)
+			if err != nil {
+				return 0, fmt.Errorf("tenant %s: TOTP of %s: %v", id, t.UserID, err)
+			}
+			t.Secret = env
+			if t.Pending, err = rewrap(t.Pending); err != nil {
+				return 0, fmt.Errorf("tenant %s: TOTP of %s: %v", id, t.UserID, err)
+			}
+			rewrapped.TOTP[i] = t
+		}
+		rewrapped.WebhookEndpoints = make([]snapshotWebhookEndpoint, len(state.WebhookEndpoints))
+		for i, e := range state.WebhookEndpoints {
+			env, err := rewrap(e.Secret)
+			if err != nil {
+				return 0, fmt.Errorf("tenant %s: webhook endpoint %s: %v", id, e.ID, err)
+			}
+			e.Secret = env
+			rewrapped.WebhookEndpoints[i] = e
+		}
+		tenants[id] = &rewrapped
+	}
+	s.tenants = tenants
+	return n, nil
+}
+
+// sealedWith counts the envelopes sealed with the key-encryption key id.
+func (s *seedStates) sealedWith(id string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	sealed := func(env *vault.Envelope) {
+		if env != nil && env.KeyID == id {
+			n++
+		}
+	}
+	for _, state := range s.tenants {
+		for _, sc := range state.Cards {
+			sealed(sc.Secrets)
+		}
+		for _, t := range state.TOTP {
+			sealed(t.Secret)
+			sealed(t.Pending)
+		}
+		for _, e := range state.WebhookEndpoints {
+			sealed(e.Secret)
+		}
+	}
+	return n
+}
+
+// restoredTenant is the state of a tenant read from a snapshot, with its
+// secrets checked.
+type restoredTenant struct {
+	store       storeState
+	enrollments map[string]totpEnrollment
+}
+
+// restoreSnapshot replaces the state of every tenant by snap: the tenants of
+// the snapshot are created when missing, the others are dropped and the
+// default tenant gets its startup state when left out. Nothing changes when
+// the snapshot is invalid or was sealed with an unknown key.
+func (ts *tenantSet) restoreSnapshot(c context.Context, snap *snapshot) error {
+	if len(snap.Tenants) > ts.max {
+		return errTooManyTenants
+	}
+	restored := make(map[string]*restoredTenant, len(snap.Tenants))
+	for id, state := range snap.Tenants {
+		if !validTenantID.MatchString(id) {
+			return fmt.Errorf("tenant %s: %v", id, errInvalidTenant)
+		}
+		if state == nil {
+			return fmt.Errorf("tenant %s: missing state", id)
+		}
+		rt, err := ts.ctx.openTenantSnapshot(state)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %v", id, err)
+		}
+		restored[id] = rt
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	tenants := make(map[string]*tenant, len(restored)+1)
+	for id, rt := range restored {
+		t, ok := ts.tenants[id]
+		if !ok {
+			var err error
+			if t, err = ts.newTenant(id); err != nil {
+				return err
+			}
+		}
+		ts.ctx.forTenant(t).applyTenantSnapshot(c, rt)
+		tenants[id] = t
+	}
+	if _, ok := tenants[DefaultTenant]; !ok {
+		t, ok := ts.tenants[DefaultTenant]
+		if !ok {
+			var err error
+			if t, err = ts.newTenant(DefaultTenant); err != nil {
+				return err
+			}
+		} else if err := ts.ctx.forTenant(t).resetTenant(c); err != nil {
+			return err
+		}
+		tenants[DefaultTenant] = t
+	}
+	ts.tenants = tenants
+	return nil
+}
+
+// openTenantSnapshot checks the state of a tenant and opens its secrets.
+func (ctx *Context) openTenantSnapshot(snap *tenantSnapshot) (*restoredTenant, error) {
+	cards := make([]*card, len(snap.Cards))
+	ids := make(map[string]bool, len(snap.Cards))
+	emails := make(map[string]bool, len(snap.Cards))
+	for i := range snap.Cards {
+		sc := snap.Cards[i]
+		if sc.ID == "" || ids[sc.ID] {
+			return nil, fmt.Errorf("card %d: missing or duplicated id", i)
+		}
+		if sc.User == nil || sc.User.Email == "" || (emails[sc.User.Email] && !sc.deleted()) {
+			return nil, fmt.Errorf("card %s: missing or duplicated user email", sc.ID)
+		}
+		if !validCardStatus(sc.Status) {
+			return nil, fmt.Errorf("card %s: invalid card status %s", sc.ID, sc.Status)
+		}
+		if sc.Secrets == nil {
+			return nil, fmt.Errorf("card %s: missing secrets", sc.ID)
+		}
+		if _, err := ctx.keyring.Open(sc.Secrets); err != nil {
+			return nil, fmt.Errorf("card %s: %v", sc.ID, err)
+		}
+		ids[sc.ID] = true
+		if !sc.deleted() {
+			emails[sc.User.Email] = true
+		}
+
+		restored := sc.card
+		u := *sc.User
+		restored.User = &u
+		restored.secrets = sc.Secrets
+		cards[i] = &restored
+	}
+
+	enrollments := make(map[string]totpEnrollment, len(snap.TOTP))
+	for _, t := range snap.TOTP {
+		if t.Secret == nil {
+			return nil, fmt.Errorf("totp %s: missing secret", t.UserID)
+		}
+		secret, err := ctx.openTOTPSecret(t.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("totp %s: %v", t.UserID, err)
+		}
+		var pending []byte
+		if t.Pending != nil {
+			if pending, err = ctx.openTOTPSecret(t.Pending); err != nil {
+				return nil, fmt.Errorf("totp %s: %v", t.UserID, err)
+			}
+		}
+		enrollments[t.UserID] = totpEnrollment{Secret: secret, Confirmed: t.Confirmed, LastStep: t.LastStep, Pending: pending}
+	}
+
+	// expired keys are dropped, the others are deleted once they expire
+	// like the ones created by POST /api/me/verify.
+	now := ctx.now()
+	keys := make(map[string]authKey, len(snap.PendingKeys))
+	for _, k := range snap.PendingKeys {
+		if !k.ExpiresAt.After(now) {
+			continue
+		}
+		keys[k.UserID] = authKey{Key: k.Key, ExpiresAt: k.ExpiresAt}
+	}
+
+	for i, a := range snap.Authorizations {
+		if a.ID == "" || !ids[a.CardID] {
+			return nil, fmt.Errorf("authorization %d: missing id or unknown card", i)
+		}
+	}
+	holderIDs := make(map[string]bool, len(snap.Cardholders))
+	for i, ch := range snap.Cardholders {
+		if ch.ID == "" || holderIDs[ch.ID] {
+			return nil, fmt.Errorf("cardholder %d: missing or duplicated id", i)
+		}
+		holderIDs[ch.ID] = true
+	}
+	endpoints := make([]webhookEndpoint, len(snap.WebhookEndpoints))
+	for i, e := range snap.WebhookEndpoints {
+		if e.ID == "" || e.Secret == nil {
+			return nil, fmt.Errorf("webhook endpoint %d: missing id or secret", i)
+		}
+		fields, err := ctx.keyring.Open(e.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("webhook endpoint %s: %v", e.ID, err)
+		}
+		endpoints[i] = e.webhookEndpoint
+		endpoints[i].secret = fields[secretWebhook]
+	}
+
+	return &restoredTenant{
+		store: storeState{
+			cards:            cards,
+			ledger:           snap.Ledger,
+			sessions:         snap.Sessions,
+			keys:             keys,
+			authorizations:   snap.Authorizations,
+			cardholders:      snap.Cardholders,
+			webhookEndpoints: endpoints,
+		},
+		enrollments: enrollments,
+	}, nil
+}
+
+// openTOTPSecret returns the TOTP secret sealed in env.
+func (ctx *Context) openTOTPSecret(env *vault.Envelope) ([]byte, error) {
+	fields, err := ctx.keyring.Open(env)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(fields[secretTOTP])
+}
+
+// applyTenantSnapshot replaces the state of the tenant of ctx by rt.
+func (ctx *Context) applyTenantSnapshot(c context.Context, rt *restoredTenant) {
+	ctx.store.restore(c, rt.store)
+	ctx.totp.restore(rt.enrollments)
+	now := ctx.now()
+	for userID, k := range rt.store.keys {
+		userID, key := userID, k.Key
+		ctx.clock.AfterFunc(k.ExpiresAt.Sub(now), func() {
+			ctx.store.deleteAuthKey(userID, key)
+		})
+	}
+}
+
+// decodeSnapshot reads a JSON encoded snapshot, those of version 1 become
+// the state of the default tenant.
+func decodeSnapshot(r io.Reader) (*snapshot, error) {
+	var snap struct {
+		snapshot
+		tenantSnapshot
+	}
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, err
+	}
+	switch snap.Version {
+	case 0:
+		return nil, errors.New("missing snapshot version")
+	case 1:
+		state := snap.tenantSnapshot
+		snap.Tenants = map[string]*tenantSnapshot{DefaultTenant: &state}
+	case snapshotVersion:
+	default:
+		return nil, fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+	snap.Version = snapshotVersion
+	return &snap.snapshot, nil
+}
+
+// WriteSnapshot writes the state of every tenant of the server as JSON: the
+// cards and their users, the ledger, the sessions, the pending verification
+// keys, the TOTP enrollments and the state of the Stripe API.
+func (s *Server) WriteSnapshot(w io.Writer) error {
+	snap, err := s.ctx.tenants.takeSnapshot(context.Background())
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(snap)
+}
+
+// RestoreSnapshot replaces the state of the server by a snapshot written by
+// WriteSnapshot. The server must use the keyring the snapshot was taken with.
+func (s *Server) RestoreSnapshot(r io.Reader) error {
+	snap, err := decodeSnapshot(r)
+	if err != nil {
+		return err
+	}
+	return s.ctx.tenants.restoreSnapshot(context.Background(), snap)
+}
+
+// getSnapshot returns the state of every tenant.
+func getSnapshot(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	snap, err := ctx.tenants.takeSnapshot(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   snap,
+	}, nil
+}
+
+// restoreSnapshotHandler replaces the state of the server by the snapshot
+// in the body, it returns the cards of the tenant of the request.
+func restoreSnapshotHandler(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	defer r.Body.Close()
+	snap, err := decodeSnapshot(r.Body)
+	if err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+	if err := ctx.tenants.restoreSnapshot(r.Context(), snap); err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+	logger.FromContext(r.Context()).WithField("tenants", len(snap.Tenants)).Info("snapshot restored")
+
+	// the tenant of the request is dropped when the snapshot leaves it out.
+	cards := []*card{}
+	if t, err := ctx.tenants.open(ctx.tenant, false); err == nil {
+		cards = t.store.list(r.Context())
+	}
+	return &response{
+		Status: http.StatusOK,
+		Data:   cards,
+	}, nil
+}
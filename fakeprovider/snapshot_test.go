@@ -0,0 +1,125 @@
+package fakeprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rodrwan/fakeproviders/vault"
+)
+
+const testPAN = "4111111111111111"
+
+func newTestKeyring(t *testing.T) *vault.Keyring {
+	t.Helper()
+	kr := vault.NewKeyring()
+	key, err := vault.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kr.Add("k1", key, true); err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+// cardIDs returns the sorted ids of the cards of a tenant.
+func cardIDs(t *testing.T, ts *testServer, tenant string) []string {
+	t.Helper()
+	var cards []card
+	resp := ts.do(t, http.MethodGet, "/cards?limit=100", http.Header{TenantHeader: {tenant}}, nil, &cards)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /cards of %s: %s", tenant, resp.Status)
+	}
+	ids := make([]string, len(cards))
+	for i, c := range cards {
+		ids[i] = c.ID
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	kr := newTestKeyring(t)
+	ts := newTestServer(t, Options{Keyring: kr})
+	defer ts.close()
+
+	var created card
+	ts.do(t, http.MethodPost, "/cards", nil, user{FirstName: "Jo", LastName: "Doe", Email: "jo@example.com"}, &created)
+	ts.do(t, http.MethodPatch, "/cards/"+created.ID+"/info", nil, patchRequestData{CardNumber: testPAN, ReferenceID: "r1"}, nil)
+	ts.do(t, http.MethodPost, "/cards", http.Header{TenantHeader: {"suite-1"}}, user{FirstName: "Al", LastName: "Roe", Email: "al@example.com"}, nil)
+
+	var buf bytes.Buffer
+	if err := ts.WriteSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), testPAN) {
+		t.Error("the snapshot holds a plaintext card number")
+	}
+
+	restored := newTestServer(t, Options{Keyring: kr, State: bytes.NewReader(buf.Bytes())})
+	defer restored.close()
+	for _, tenant := range []string{DefaultTenant, "suite-1"} {
+		want := cardIDs(t, ts, tenant)
+		if len(want) != len(DefaultSeed())+1 {
+			t.Fatalf("%s has %d cards, want %d", tenant, len(want), len(DefaultSeed())+1)
+		}
+		if got := cardIDs(t, restored, tenant); !reflect.DeepEqual(got, want) {
+			t.Errorf("cards of %s = %v, want %v", tenant, got, want)
+		}
+	}
+
+	c, secrets, err := restored.ctx.cardByPAN(context.Background(), testPAN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ID != created.ID || c.ReferenceID != "r1" || secrets.CVV == "" {
+		t.Errorf("restored card %s %s, secrets %+v", c.ID, c.ReferenceID, secrets)
+	}
+
+	// a snapshot taken with another key-encryption key isn't restored.
+	if _, err := New(Options{Keyring: newTestKeyring(t), State: bytes.NewReader(buf.Bytes())}); err == nil {
+		t.Error("restored a snapshot sealed with another key")
+	}
+}
+
+func TestSnapshotVersion1(t *testing.T) {
+	kr := newTestKeyring(t)
+	ts := newTestServer(t, Options{Keyring: kr})
+	defer ts.close()
+
+	state, err := ts.ctx.takeTenantSnapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(struct {
+		Version int `json:"version"`
+		*tenantSnapshot
+	}{1, state}); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newTestServer(t, Options{Keyring: kr, State: &buf})
+	defer restored.close()
+	if got, want := cardIDs(t, restored, DefaultTenant), cardIDs(t, ts, DefaultTenant); !reflect.DeepEqual(got, want) {
+		t.Errorf("cards = %v, want %v", got, want)
+	}
+}
+
+func TestSnapshotInvalid(t *testing.T) {
+	for _, state := range []string{
+		`{"version": 3, "tenants": {}}`,
+		`{"version": 2, "tenants": {"not a tenant!": {"cards": []}}}`,
+		`not json`,
+	} {
+		if _, err := New(Options{Keyring: newTestKeyring(t), State: strings.NewReader(state)}); err == nil {
+			t.Errorf("restored %s", state)
+		}
+	}
+}
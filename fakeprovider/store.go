@@ -0,0 +1,246 @@
+package fakeprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var errUserHasCard = errors.New("user already have a card")
+
+// store keeps the cards, their ledger, the sessions, the pending
+// verification keys, the authorizations and the Stripe cardholders and
+// webhook endpoints in memory. It is safe for concurrent use, cards are
+// returned as copies so handlers can encode them while other requests update
+// the store.
+type store struct {
+	mu       sync.RWMutex
+	cards    []*card
+	authKeys map[string]*authKey
+	ledger   []*ledgerEntry
+	sessions map[string]*sessionRecord
+
+	authorizations   []*authorization
+	cardholders      []*cardholderRecord
+	webhookEndpoints []*webhookEndpoint
+}
+
+// authKey is a pending verification key.
+type authKey struct {
+	Key       string
+	ExpiresAt time.Time
+}
+
+func newStore(cards []*card, ledger []ledgerEntry) *store {
+	entries := make([]*ledgerEntry, len(ledger))
+	for i := range ledger {
+		e := ledger[i]
+		entries[i] = &e
+	}
+	return &store{
+		cards:    cards,
+		ledger:   entries,
+		authKeys: make(map[string]*authKey),
+		sessions: make(map[string]*sessionRecord),
+	}
+}
+
+// cardMatcher selects cards in find and update. Deleted cards are only
+// matched by byIDWithDeleted.
+type cardMatcher func(*card) bool
+
+func byID(id string) cardMatcher {
+	return func(c *card) bool { return c.ID == id && !c.deleted() }
+}
+
+func byIDWithDeleted(id string) cardMatcher {
+	return func(c *card) bool { return c.ID == id }
+}
+
+func byReferenceID(referenceID string) cardMatcher {
+	return func(c *card) bool { return c.ReferenceID == referenceID && !c.deleted() }
+}
+
+func byEmail(email string) cardMatcher {
+	return func(c *card) bool { return c.User != nil && c.User.Email == email && !c.deleted() }
+}
+
+func (c *card) clone() *card {
+	cp := *c
+	return &cp
+}
+
+// list returns every card.
+func (s *store) list(ctx context.Context) []*card {
+	_, span := tracing.Start(ctx, "store.list_cards")
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cards := make([]*card, len(s.cards))
+	for i, c := range s.cards {
+		cards[i] = c.clone()
+	}
+	span.SetAttributes(attribute.Int("cards.count", len(cards)))
+	return cards
+}
+
+// find returns the first card matching, or nil.
+func (s *store) find(ctx context.Context, match cardMatcher) *card {
+	_, span := tracing.Start(ctx, "store.find_card")
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.cards {
+		if match(c) {
+			return c.clone()
+		}
+	}
+	return nil
+}
+
+// add adds a new card, a user can only have one card that isn't deleted.
+func (s *store) add(ctx context.Context, c *card) error {
+	_, span := tracing.Start(ctx, "store.add_card")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.cards {
+		if byEmail(c.User.Email)(existing) {
+			return errUserHasCard
+		}
+	}
+	s.cards = append(s.cards, c)
+	return nil
+}
+
+// update applies fn to the first card matching and returns the updated card,
+// or nil when no card matches.
+func (s *store) update(ctx context.Context, match cardMatcher, fn func(*card)) *card {
+	_, span := tracing.Start(ctx, "store.update_card")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.cards {
+		if match(c) {
+			fn(c)
+			return c.clone()
+		}
+	}
+	return nil
+}
+
+// updateAll applies fn to every card, stopping at the first error.
+func (s *store) updateAll(ctx context.Context, fn func(*card) error) (int, error) {
+	_, span := tracing.Start(ctx, "store.update_cards")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.cards {
+		if err := fn(c); err != nil {
+			return i, err
+		}
+	}
+	return len(s.cards), nil
+}
+
+// setAuthKey stores the pending verification key of a user.
+func (s *store) setAuthKey(ctx context.Context, userID, key string, expiresAt time.Time) {
+	_, span := tracing.Start(ctx, "store.set_auth_key")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authKeys[userID] = &authKey{Key: key, ExpiresAt: expiresAt}
+}
+
+// authKey returns the pending verification key of a user.
+func (s *store) authKey(ctx context.Context, userID string) string {
+	_, span := tracing.Start(ctx, "store.get_auth_key")
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if k := s.authKeys[userID]; k != nil {
+		return k.Key
+	}
+	return ""
+}
+
+// authKeyList returns the pending verification keys indexed by user id.
+func (s *store) authKeyList(ctx context.Context) map[string]authKey {
+	_, span := tracing.Start(ctx, "store.list_auth_keys")
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make(map[string]authKey, len(s.authKeys))
+	for userID, key := range s.authKeys {
+		keys[userID] = *key
+	}
+	return keys
+}
+
+// addAll adds cards in bulk, none is added when one of them reuses the id of
+// another card or belongs to a user that already has a card.
+func (s *store) addAll(ctx context.Context, cards []*card) error {
+	_, span := tracing.Start(ctx, "store.add_cards")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make(map[string]bool, len(s.cards)+len(cards))
+	emails := make(map[string]bool, len(s.cards)+len(cards))
+	for _, c := range s.cards {
+		ids[c.ID] = true
+		if !c.deleted() {
+			emails[c.User.Email] = true
+		}
+	}
+	for _, c := range cards {
+		if ids[c.ID] {
+			return fmt.Errorf("card id %s already used", c.ID)
+		}
+		if emails[c.User.Email] {
+			return errUserHasCard
+		}
+		ids[c.ID] = true
+		emails[c.User.Email] = true
+	}
+	s.cards = append(s.cards, cards...)
+	return nil
+}
+
+// reset replaces every card and drops the rest of the state.
+func (s *store) reset(ctx context.Context, cards []*card) {
+	_, span := tracing.Start(ctx, "store.reset")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cards = cards
+	s.authKeys = make(map[string]*authKey)
+	s.ledger = nil
+	s.sessions = make(map[string]*sessionRecord)
+	s.authorizations = nil
+	s.cardholders = nil
+	s.webhookEndpoints = nil
+}
+
+// deleteAuthKey removes the verification key of a user if it is still key.
+func (s *store) deleteAuthKey(userID, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k := s.authKeys[userID]; k != nil && k.Key == key {
+		delete(s.authKeys, userID)
+	}
+}
@@ -0,0 +1,472 @@
+package fakeprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/requestid"
+)
+
+func init() {
+	registerPersonality(stripePersonality{})
+}
+
+// Prefixes of the Stripe object ids. The ids of the objects shared with the
+// native API are the prefix followed by the native id.
+const (
+	stripeCardPrefix            = "ic_"
+	stripeCardholderPrefix      = "ich_"
+	stripeAuthorizationPrefix   = "iauth_"
+	stripeWebhookEndpointPrefix = "we_"
+	stripeEventPrefix           = "evt_"
+)
+
+// stripeAPIVersion is the version of the Stripe API emulated, sent in the
+// events.
+const stripeAPIVersion = "2023-10-16"
+
+// stripePersonality emulates the Stripe Issuing API on top of the cards of
+// the native API, the cardholders and cards created through either API are
+// seen by both.
+type stripePersonality struct{}
+
+func (stripePersonality) name() string {
+	return "stripe"
+}
+
+func (stripePersonality) routes(r *Router, rc *routeChains) {
+	rc = rc.withFormat(stripeFormat{})
+
+	// api wraps every route, they require the API token as a Bearer token
+	// or a Basic username like the Stripe secret keys.
+	api := func(h handlerFunc) http.Handler {
+		return rc.chain(stripeAuth(rc.apiAuth), h)
+	}
+
+	r.POST("/v1/issuing/cardholders", api(stripeCreateCardholder))
+	r.GET("/v1/issuing/cardholders", api(stripeListCardholders))
+	r.GET("/v1/issuing/cardholders/:id", api(stripeGetCardholder))
+	r.POST("/v1/issuing/cardholders/:id", api(stripeUpdateCardholder))
+
+	r.POST("/v1/issuing/cards", api(stripeCreateCard))
+	r.GET("/v1/issuing/cards", api(stripeListCards))
+	r.GET("/v1/issuing/cards/:id", api(stripeGetCard))
+	r.POST("/v1/issuing/cards/:id", api(stripeUpdateCard))
+
+	r.GET("/v1/issuing/authorizations", api(stripeListAuthorizations))
+	r.GET("/v1/issuing/authorizations/:id", api(stripeGetAuthorization))
+	r.POST("/v1/test_helpers/issuing/authorizations", api(stripeCreateAuthorization))
+	r.POST("/v1/test_helpers/issuing/authorizations/:id/capture", api(stripeCaptureAuthorization))
+	r.POST("/v1/test_helpers/issuing/authorizations/:id/reverse", api(stripeReverseAuthorization))
+
+	r.POST("/v1/webhook_endpoints", api(stripeCreateWebhookEndpoint))
+	r.GET("/v1/webhook_endpoints", api(stripeListWebhookEndpoints))
+	r.GET("/v1/webhook_endpoints/:id", api(stripeGetWebhookEndpoint))
+	r.POST("/v1/webhook_endpoints/:id", api(stripeUpdateWebhookEndpoint))
+	r.DELETE("/v1/webhook_endpoints/:id", api(stripeDeleteWebhookEndpoint))
+}
+
+// stripeAuth accepts the API tokens sent like Stripe keys.
+func stripeAuth(m *AuthMiddleware) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key := apiKey(r); key == "" || !m.accepts(key) {
+				stripeFormat{}.writeError(w, r, http.StatusUnauthorized, "")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Types of the Stripe errors.
+const (
+	stripeInvalidRequestError = "invalid_request_error"
+	stripeAPIError            = "api_error"
+)
+
+type stripeError struct {
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+}
+
+type stripeErrorBody struct {
+	Error stripeError `json:"error"`
+}
+
+// stripeErrorResponse is a Stripe error returned by a handler.
+func stripeErrorResponse(status int, code, param, message string) *response {
+	typ := stripeInvalidRequestError
+	if status >= http.StatusInternalServerError {
+		typ = stripeAPIError
+	}
+	return &response{
+		Status: status,
+		Data:   stripeErrorBody{stripeError{Type: typ, Code: code, Message: message, Param: param}},
+	}
+}
+
+// stripeInvalidParam rejects a parameter.
+func stripeInvalidParam(param, message string) *response {
+	return stripeErrorResponse(http.StatusBadRequest, "parameter_invalid", param, message)
+}
+
+// stripeMissing tells an object doesn't exist.
+func stripeMissing(param, object, id string) *response {
+	return stripeErrorResponse(http.StatusNotFound, "resource_missing", param, fmt.Sprintf("No such %s: '%s'", object, id))
+}
+
+// stripeFormat writes the objects as they are and the errors as Stripe
+// error objects, with the request id in Request-Id.
+type stripeFormat struct{}
+
+func (stripeFormat) writeResponse(w http.ResponseWriter, r *http.Request, resp *response) {
+	writeStripeJSON(w, r, resp.Status, resp.Data)
+}
+
+func (stripeFormat) writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	e := stripeErrorResponse(status, "", "", message).Data.(stripeErrorBody)
+	switch status {
+	case http.StatusUnauthorized:
+		e.Error.Message = "Invalid API Key provided."
+	case http.StatusNotFound:
+		e.Error.Code = "resource_missing"
+		if e.Error.Message == "" {
+			e.Error.Message = "Unrecognized request URL."
+		}
+	case http.StatusTooManyRequests:
+		e.Error.Code = "rate_limit"
+		e.Error.Message = "Too many requests hit the API too quickly."
+	}
+	writeStripeJSON(w, r, status, e)
+}
+
+func writeStripeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		b, _ = json.Marshal(stripeErrorResponse(status, "", "", err.Error()).Data)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Request-Id", requestid.FromContext(r.Context()))
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// stripeParams are the parameters of a Stripe request, read from the query
+// string and the form encoded body. Hashes and arrays use brackets, such as
+// metadata[order]=42 and expand[]=cardholder.
+type stripeParams url.Values
+
+func parseStripeParams(r *http.Request) (stripeParams, *response) {
+	if err := r.ParseForm(); err != nil {
+		return nil, stripeErrorResponse(http.StatusBadRequest, "", "", "Invalid request body: "+err.Error())
+	}
+	return stripeParams(r.Form), nil
+}
+
+func (p stripeParams) get(key string) string {
+	return url.Values(p).Get(key)
+}
+
+func (p stripeParams) has(key string) bool {
+	_, ok := p[key]
+	return ok
+}
+
+// unknown returns the first parameter not in names, whose brackets are
+// ignored, or an empty string.
+func (p stripeParams) unknown(names ...string) string {
+	var keys []string
+	for key := range p {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := key
+		if i := strings.Index(key, "["); i >= 0 {
+			name = key[:i]
+		}
+		known := false
+		for _, n := range names {
+			if n == name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return name
+		}
+	}
+	return ""
+}
+
+// check rejects the parameters not in names.
+func (p stripeParams) check(names ...string) *response {
+	if name := p.unknown(names...); name != "" {
+		return stripeErrorResponse(http.StatusBadRequest, "parameter_unknown", name, "Received unknown parameter: "+name)
+	}
+	return nil
+}
+
+// list returns the array key, sent as key[]=a&key[]=b or key[0]=a&key[1]=b.
+func (p stripeParams) list(key string) []string {
+	values := append([]string{}, p[key+"[]"]...)
+	type indexed struct {
+		i     int
+		value string
+	}
+	var items []indexed
+	for k, vs := range p {
+		if !strings.HasPrefix(k, key+"[") || !strings.HasSuffix(k, "]") || len(vs) == 0 {
+			continue
+		}
+		if i, err := strconv.Atoi(k[len(key)+1 : len(k)-1]); err == nil {
+			items = append(items, indexed{i, vs[0]})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].i < items[j].i })
+	for _, item := range items {
+		values = append(values, item.value)
+	}
+	return values
+}
+
+// hash returns the hash key, sent as key[name]=value, nil when absent.
+func (p stripeParams) hash(key string) map[string]string {
+	var m map[string]string
+	for k, vs := range p {
+		if !strings.HasPrefix(k, key+"[") || !strings.HasSuffix(k, "]") || len(vs) == 0 {
+			continue
+		}
+		name := k[len(key)+1 : len(k)-1]
+		if name == "" || strings.ContainsAny(name, "[]") {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]string)
+		}
+		m[name] = vs[0]
+	}
+	return m
+}
+
+// integer returns the integer key, 0 when absent.
+func (p stripeParams) integer(key string) (int64, *response) {
+	v := p.get(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, stripeInvalidParam(key, "Invalid integer: "+v)
+	}
+	return n, nil
+}
+
+// boolean returns the boolean key, false when absent.
+func (p stripeParams) boolean(key string) (bool, *response) {
+	switch p.get(key) {
+	case "", "false":
+		return false, nil
+	case "true":
+		return true, nil
+	}
+	return false, stripeInvalidParam(key, "Invalid boolean: "+p.get(key))
+}
+
+// metadata applies the metadata parameters to m: an empty value removes a
+// key and an empty metadata removes them all. m isn't modified.
+func (p stripeParams) metadata(m map[string]string) (map[string]string, *response) {
+	if p.has("metadata") && p.get("metadata") == "" {
+		return nil, nil
+	}
+	changes := p.hash("metadata")
+	if changes == nil {
+		return m, nil
+	}
+	updated := make(map[string]string, len(m)+len(changes))
+	for k, v := range m {
+		updated[k] = v
+	}
+	for k, v := range changes {
+		if v == "" {
+			delete(updated, k)
+			continue
+		}
+		updated[k] = v
+	}
+	if len(updated) > 50 {
+		return nil, stripeInvalidParam("metadata", "Metadata can have up to 50 keys.")
+	}
+	if len(updated) == 0 {
+		return nil, nil
+	}
+	return updated, nil
+}
+
+// expand returns the fields to expand among allowed. Lists take the fields
+// of their items prefixed by "data.".
+func (p stripeParams) expand(list bool, allowed ...string) (map[string]bool, *response) {
+	fields := make(map[string]bool)
+	for _, field := range p.list("expand") {
+		name := field
+		if list {
+			if !strings.HasPrefix(field, "data.") {
+				return nil, stripeInvalidParam("expand", fmt.Sprintf("This property cannot be expanded (%s).", field))
+			}
+			name = strings.TrimPrefix(field, "data.")
+		}
+		ok := false
+		for _, a := range allowed {
+			if a == name {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return nil, stripeInvalidParam("expand", fmt.Sprintf("This property cannot be expanded (%s).", field))
+		}
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// stripeList is a page of a Stripe list.
+type stripeList struct {
+	Object  string        `json:"object"`
+	Data    []interface{} `json:"data"`
+	HasMore bool          `json:"has_more"`
+	URL     string        `json:"url"`
+}
+
+// stripePage returns the bounds of the page of ids asked for with limit,
+// starting_after and ending_before, the ids being sorted newest first.
+func stripePage(p stripeParams, object string, ids []string) (int, int, bool, *response) {
+	limit, errResp := p.integer("limit")
+	if errResp != nil {
+		return 0, 0, false, errResp
+	}
+	if !p.has("limit") {
+		limit = 10
+	}
+	if limit < 1 || limit > 100 {
+		return 0, 0, false, stripeInvalidParam("limit", "Limit must be between 1 and 100.")
+	}
+
+	index := func(param string) (int, *response) {
+		id := p.get(param)
+		for i, candidate := range ids {
+			if candidate == id {
+				return i, nil
+			}
+		}
+		return 0, stripeMissing(param, object, id)
+	}
+	n := int(limit)
+	switch {
+	case p.get("starting_after") != "":
+		i, errResp := index("starting_after")
+		if errResp != nil {
+			return 0, 0, false, errResp
+		}
+		start := i + 1
+		end := start + n
+		if end > len(ids) {
+			end = len(ids)
+		}
+		return start, end, end < len(ids), nil
+	case p.get("ending_before") != "":
+		end, errResp := index("ending_before")
+		if errResp != nil {
+			return 0, 0, false, errResp
+		}
+		start := end - n
+		if start < 0 {
+			start = 0
+		}
+		return start, end, start > 0, nil
+	}
+	end := n
+	if end > len(ids) {
+		end = len(ids)
+	}
+	return 0, end, end < len(ids), nil
+}
+
+// stripeCreated tells whether t matches the created filter of a list, given
+// as created=<unix> or created[gt|gte|lt|lte]=<unix>.
+func stripeCreated(p stripeParams, t time.Time) (bool, *response) {
+	unix := t.Unix()
+	if p.get("created") != "" {
+		v, errResp := p.integer("created")
+		if errResp != nil {
+			return false, errResp
+		}
+		return unix == v, nil
+	}
+	for op, v := range p.hash("created") {
+		bound, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return false, stripeInvalidParam("created["+op+"]", "Invalid integer: "+v)
+		}
+		var ok bool
+		switch op {
+		case "gt":
+			ok = unix > bound
+		case "gte":
+			ok = unix >= bound
+		case "lt":
+			ok = unix < bound
+		case "lte":
+			ok = unix <= bound
+		default:
+			return false, stripeErrorResponse(http.StatusBadRequest, "parameter_unknown", "created["+op+"]", "Received unknown parameter: created["+op+"]")
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// stripeNullable returns nil for empty strings, encoded as null.
+func stripeNullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// stripeMetadata returns m, encoded as an empty object when nil.
+func stripeMetadata(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+// stripeObjectID returns the id of a field that may be expanded.
+func stripeObjectID(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case *stripeCardholder:
+		return v.ID
+	}
+	return ""
+}
+
+// stripeRouteID returns the id route parameter.
+func stripeRouteID(r *http.Request) string {
+	id, _ := r.Context().Value("id").(string)
+	return id
+}
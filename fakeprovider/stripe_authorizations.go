@@ -0,0 +1,344 @@
+package fakeprovider
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/rodrwan/fakeproviders/requestid"
+)
+
+type stripeMerchantData struct {
+	Category   string  `json:"category"`
+	City       *string `json:"city"`
+	Country    *string `json:"country"`
+	Name       *string `json:"name"`
+	NetworkID  string  `json:"network_id"`
+	PostalCode *string `json:"postal_code"`
+	State      *string `json:"state"`
+}
+
+type stripeRequestHistory struct {
+	Amount           int64  `json:"amount"`
+	Approved         bool   `json:"approved"`
+	Created          int64  `json:"created"`
+	Currency         string `json:"currency"`
+	MerchantAmount   int64  `json:"merchant_amount"`
+	MerchantCurrency string `json:"merchant_currency"`
+	Reason           string `json:"reason"`
+}
+
+type stripeAuthorization struct {
+	ID                  string                 `json:"id"`
+	Object              string                 `json:"object"`
+	Amount              int64                  `json:"amount"`
+	Approved            bool                   `json:"approved"`
+	AuthorizationMethod string                 `json:"authorization_method"`
+	BalanceTransactions []interface{}          `json:"balance_transactions"`
+	Card                *stripeCard            `json:"card"`
+	Cardholder          interface{}            `json:"cardholder"`
+	Created             int64                  `json:"created"`
+	Currency            string                 `json:"currency"`
+	Livemode            bool                   `json:"livemode"`
+	MerchantAmount      int64                  `json:"merchant_amount"`
+	MerchantCurrency    string                 `json:"merchant_currency"`
+	MerchantData        stripeMerchantData     `json:"merchant_data"`
+	Metadata            map[string]string      `json:"metadata"`
+	PendingRequest      interface{}            `json:"pending_request"`
+	RequestHistory      []stripeRequestHistory `json:"request_history"`
+	Status              string                 `json:"status"`
+	Transactions        []interface{}          `json:"transactions"`
+	Wallet              *string                `json:"wallet"`
+}
+
+// stripeRequestReason returns the reason of the decision on a, as listed in
+// its request history. The reasons of the JIT decisions are the Stripe ones.
+func stripeRequestReason(a *authorization) string {
+	if a.JIT != nil {
+		return a.JIT.Reason
+	}
+	switch a.DeclineReason {
+	case "":
+		return "card_active"
+	case declineCardExpired:
+		return declineCardInactive
+	}
+	return a.DeclineReason
+}
+
+// newStripeAuthorization returns a as a Stripe authorization, with its card
+// expanded.
+func (ctx *Context) newStripeAuthorization(c context.Context, a *authorization, cardholders []cardholderRecord, expand map[string]bool) (*stripeAuthorization, error) {
+	cardExpand := map[string]bool{"cardholder": expand["card.cardholder"]}
+	card := ctx.store.find(c, byIDWithDeleted(a.CardID))
+	if card == nil {
+		return nil, errAuthorizationCardAbsent
+	}
+	sc, err := ctx.newStripeCard(card, cardholders, cardExpand)
+	if err != nil {
+		return nil, err
+	}
+	ch := cardholderOf(cardholders, card)
+
+	sa := &stripeAuthorization{
+		ID:                  stripeAuthorizationPrefix + a.ID,
+		Object:              "issuing.authorization",
+		Amount:              a.Amount,
+		Approved:            a.Approved,
+		AuthorizationMethod: "online",
+		BalanceTransactions: []interface{}{},
+		Card:                sc,
+		Cardholder:          ch.ID,
+		Created:             a.CreatedAt.Unix(),
+		Currency:            a.Currency,
+		MerchantAmount:      a.Amount,
+		MerchantCurrency:    a.Currency,
+		MerchantData: stripeMerchantData{
+			Category:  a.Merchant.Category,
+			City:      stripeNullable(a.Merchant.City),
+			Country:   stripeNullable(a.Merchant.Country),
+			Name:      stripeNullable(a.Merchant.Name),
+			NetworkID: "1234567890",
+		},
+		Metadata: stripeMetadata(a.Metadata),
+		RequestHistory: []stripeRequestHistory{{
+			Amount:           a.Amount,
+			Approved:         a.Approved,
+			Created:          a.CreatedAt.Unix(),
+			Currency:         a.Currency,
+			MerchantAmount:   a.Amount,
+			MerchantCurrency: a.Currency,
+			Reason:           stripeRequestReason(a),
+		}},
+		Status:       a.Status,
+		Transactions: []interface{}{},
+	}
+	if expand["cardholder"] {
+		sa.Cardholder = newStripeCardholder(&ch)
+	}
+	return sa, nil
+}
+
+// stripeAuthorization returns the authorization with the given Stripe id.
+func (ctx *Context) stripeAuthorization(c context.Context, id string) *authorization {
+	if !strings.HasPrefix(id, stripeAuthorizationPrefix) {
+		return nil
+	}
+	return ctx.store.findAuthorization(c, strings.TrimPrefix(id, stripeAuthorizationPrefix))
+}
+
+// stripeAuthorizationResponse returns a and sends the event of its change.
+func (ctx *Context) stripeAuthorizationResponse(r *http.Request, a *authorization, event string) (*response, error) {
+	cardholders := ctx.cardholders(r.Context())
+	sa, err := ctx.newStripeAuthorization(r.Context(), a, cardholders, nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx.sendStripeEvent(r, event, sa)
+	return &response{
+		Status: http.StatusOK,
+		Data:   sa,
+	}, nil
+}
+
+// stripeCreateAuthorization simulates a purchase with a card. It is
+// approved when the card is active and its balance covers the amount, which
+// is then held until captured or reversed.
+func stripeCreateAuthorization(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check("card", "amount", "currency", "merchant_data", "authorization_method", "expand"); errResp != nil {
+		return errResp, nil
+	}
+	amount, errResp := p.integer("amount")
+	if errResp != nil {
+		return errResp, nil
+	}
+	switch {
+	case p.get("card") == "":
+		return stripeInvalidParam("card", "Missing required param: card."), nil
+	case amount <= 0:
+		return stripeInvalidParam("amount", "Amount must be a positive integer."), nil
+	case p.get("currency") != "" && p.get("currency") != stripeCurrency:
+		return stripeInvalidParam("currency", "Only usd authorizations are supported."), nil
+	}
+	card := ctx.stripeCard(r.Context(), p.get("card"))
+	if card == nil {
+		return stripeMissing("card", "issuing card", p.get("card")), nil
+	}
+
+	merchant := merchant{Category: "ac_refrigeration_repair"}
+	fields := map[string]*string{
+		"name":     &merchant.Name,
+		"category": &merchant.Category,
+		"city":     &merchant.City,
+		"country":  &merchant.Country,
+	}
+	for name, value := range p.hash("merchant_data") {
+		field, ok := fields[name]
+		if !ok {
+			return stripeErrorResponse(http.StatusBadRequest, "parameter_unknown", "merchant_data["+name+"]", "Received unknown parameter: merchant_data["+name+"]"), nil
+		}
+		*field = value
+	}
+
+	a, err := ctx.authorize(r.Context(), authorizationRequest{
+		CardID:    card.ID,
+		Amount:    amount,
+		Currency:  stripeCurrency,
+		Merchant:  merchant,
+		Channel:   "stripe",
+		RequestID: requestid.FromContext(r.Context()),
+	})
+	if err == errAuthorizationCardAbsent {
+		return stripeMissing("card", "issuing card", p.get("card")), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ctx.stripeAuthorizationResponse(r, a, "issuing_authorization.created")
+}
+
+// stripeCaptureAuthorization captures the whole amount of a pending
+// authorization.
+func stripeCaptureAuthorization(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	return stripeCloseAuthorization(ctx, r, "capture_amount", func(c context.Context, id string) (*authorization, error) {
+		return ctx.captureAuthorization(c, id)
+	})
+}
+
+// stripeReverseAuthorization releases the whole amount of a pending
+// authorization.
+func stripeReverseAuthorization(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	return stripeCloseAuthorization(ctx, r, "reverse_amount", func(c context.Context, id string) (*authorization, error) {
+		return ctx.reverseAuthorization(c, id, requestid.FromContext(r.Context()), false)
+	})
+}
+
+// stripeCloseAuthorization applies close to a pending authorization, the
+// amount param must be the amount of the authorization when sent.
+func stripeCloseAuthorization(ctx *Context, r *http.Request, amountParam string, close func(context.Context, string) (*authorization, error)) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check(amountParam, "close_authorization", "expand"); errResp != nil {
+		return errResp, nil
+	}
+	amount, errResp := p.integer(amountParam)
+	if errResp != nil {
+		return errResp, nil
+	}
+	id := stripeRouteID(r)
+	current := ctx.stripeAuthorization(r.Context(), id)
+	if current == nil {
+		return stripeMissing("authorization", "issuing authorization", id), nil
+	}
+	if p.has(amountParam) && amount != current.Amount {
+		return stripeInvalidParam(amountParam, "Only the whole amount of the authorization is supported."), nil
+	}
+
+	a, err := close(r.Context(), current.ID)
+	if err == errAuthorizationNotPending {
+		return stripeErrorResponse(http.StatusBadRequest, "authorization_not_pending", "", "This authorization is not pending."), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ctx.stripeAuthorizationResponse(r, a, "issuing_authorization.updated")
+}
+
+// stripeGetAuthorization returns an authorization.
+func stripeGetAuthorization(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check("expand"); errResp != nil {
+		return errResp, nil
+	}
+	expand, errResp := p.expand(false, "cardholder", "card.cardholder")
+	if errResp != nil {
+		return errResp, nil
+	}
+	id := stripeRouteID(r)
+	a := ctx.stripeAuthorization(r.Context(), id)
+	if a == nil {
+		return stripeMissing("id", "issuing authorization", id), nil
+	}
+
+	sa, err := ctx.newStripeAuthorization(r.Context(), a, ctx.cardholders(r.Context()), expand)
+	if err != nil {
+		return nil, err
+	}
+	return &response{
+		Status: http.StatusOK,
+		Data:   sa,
+	}, nil
+}
+
+// stripeListAuthorizations lists the authorizations, newest first.
+func stripeListAuthorizations(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check("card", "cardholder", "status", "created", "limit", "starting_after", "ending_before", "expand"); errResp != nil {
+		return errResp, nil
+	}
+	expand, errResp := p.expand(true, "cardholder", "card.cardholder")
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	cardholders := ctx.cardholders(r.Context())
+	authorizations := ctx.store.authorizationList(r.Context())
+	for i, j := 0, len(authorizations)-1; i < j; i, j = i+1, j-1 {
+		authorizations[i], authorizations[j] = authorizations[j], authorizations[i]
+	}
+	sort.SliceStable(authorizations, func(i, j int) bool {
+		return authorizations[i].CreatedAt.After(authorizations[j].CreatedAt)
+	})
+
+	var selected []*stripeAuthorization
+	for _, a := range authorizations {
+		created, errResp := stripeCreated(p, a.CreatedAt)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if !created ||
+			(p.get("card") != "" && stripeCardPrefix+a.CardID != p.get("card")) ||
+			(p.get("status") != "" && a.Status != p.get("status")) {
+			continue
+		}
+		sa, err := ctx.newStripeAuthorization(r.Context(), a, cardholders, expand)
+		if err != nil {
+			return nil, err
+		}
+		if p.get("cardholder") != "" && stripeObjectID(sa.Cardholder) != p.get("cardholder") {
+			continue
+		}
+		selected = append(selected, sa)
+	}
+
+	ids := make([]string, len(selected))
+	for i, sa := range selected {
+		ids[i] = sa.ID
+	}
+	start, end, hasMore, errResp := stripePage(p, "issuing authorization", ids)
+	if errResp != nil {
+		return errResp, nil
+	}
+	list := stripeList{Object: "list", Data: []interface{}{}, HasMore: hasMore, URL: "/v1/issuing/authorizations"}
+	for _, sa := range selected[start:end] {
+		list.Data = append(list.Data, sa)
+	}
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   list,
+	}, nil
+}
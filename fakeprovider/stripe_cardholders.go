@@ -0,0 +1,425 @@
+package fakeprovider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/tracing"
+)
+
+// Types and statuses of the cardholders.
+const (
+	cardholderIndividual = "individual"
+	cardholderCompany    = "company"
+	cardholderActive     = "active"
+	cardholderInactive   = "inactive"
+)
+
+var (
+	errCardholderNotFound   = errors.New("cardholder not found")
+	errCardholderEmailTaken = errors.New("email already used by another cardholder")
+)
+
+type address struct {
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	State      string `json:"state,omitempty"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+}
+
+// cardholderRecord is a cardholder created through the Stripe API. A card
+// belongs to the cardholder with the email of its user, the users without
+// such a cardholder are shown as cardholders too, see userCardholder.
+type cardholderRecord struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Email       string            `json:"email,omitempty"`
+	PhoneNumber string            `json:"phone_number,omitempty"`
+	Type        string            `json:"type"`
+	Status      string            `json:"status"`
+	Billing     address           `json:"billing"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// userCardholder returns the cardholder of the user of c, whose id is
+// derived from the email so it stays the same across calls.
+func userCardholder(c *card) cardholderRecord {
+	sum := sha256.Sum256([]byte(c.User.Email))
+	return cardholderRecord{
+		ID:        stripeCardholderPrefix + hex.EncodeToString(sum[:])[:24],
+		Name:      strings.TrimSpace(c.User.FirstName + " " + c.User.LastName),
+		Email:     c.User.Email,
+		Type:      cardholderIndividual,
+		Status:    cardholderActive,
+		CreatedAt: c.CreatedAt,
+	}
+}
+
+// addCardholder adds a cardholder, the emails are unique.
+func (s *store) addCardholder(ctx context.Context, ch *cardholderRecord) error {
+	_, span := tracing.Start(ctx, "store.add_cardholder")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.cardholders {
+		if ch.Email != "" && existing.Email == ch.Email {
+			return errCardholderEmailTaken
+		}
+	}
+	cp := *ch
+	s.cardholders = append(s.cardholders, &cp)
+	return nil
+}
+
+// cardholderList returns the cardholders created through the Stripe API,
+// oldest first.
+func (s *store) cardholderList(ctx context.Context) []cardholderRecord {
+	_, span := tracing.Start(ctx, "store.list_cardholders")
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cardholders := make([]cardholderRecord, len(s.cardholders))
+	for i, ch := range s.cardholders {
+		cardholders[i] = *ch
+	}
+	return cardholders
+}
+
+// putCardholder applies fn to the cardholder with the id of ch, ch itself
+// is added when missing. Nothing changes when fn fails.
+func (s *store) putCardholder(ctx context.Context, ch cardholderRecord, fn func(*cardholderRecord) error) (*cardholderRecord, error) {
+	_, span := tracing.Start(ctx, "store.update_cardholder")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var target *cardholderRecord
+	for _, existing := range s.cardholders {
+		if existing.ID == ch.ID {
+			target = existing
+			break
+		}
+	}
+	updated := ch
+	if target != nil {
+		updated = *target
+	}
+	if err := fn(&updated); err != nil {
+		return nil, err
+	}
+	for _, existing := range s.cardholders {
+		if existing != target && updated.Email != "" && existing.Email == updated.Email {
+			return nil, errCardholderEmailTaken
+		}
+	}
+	if target == nil {
+		target = &cardholderRecord{}
+		s.cardholders = append(s.cardholders, target)
+	}
+	*target = updated
+	return &updated, nil
+}
+
+// cardholders returns every cardholder, the users of the cards not linked
+// to a cardholder of the Stripe API included, newest first.
+func (ctx *Context) cardholders(c context.Context) []cardholderRecord {
+	cardholders := ctx.store.cardholderList(c)
+	emails := make(map[string]bool, len(cardholders))
+	for _, ch := range cardholders {
+		if ch.Email != "" {
+			emails[ch.Email] = true
+		}
+	}
+	for _, card := range ctx.store.list(c) {
+		if card.deleted() || card.User == nil || emails[card.User.Email] {
+			continue
+		}
+		emails[card.User.Email] = true
+		cardholders = append(cardholders, userCardholder(card))
+	}
+	sort.SliceStable(cardholders, func(i, j int) bool {
+		return cardholders[i].CreatedAt.After(cardholders[j].CreatedAt)
+	})
+	return cardholders
+}
+
+// cardholder returns the cardholder with the given id.
+func (ctx *Context) cardholder(c context.Context, id string) (*cardholderRecord, error) {
+	for _, ch := range ctx.cardholders(c) {
+		if ch.ID == id {
+			return &ch, nil
+		}
+	}
+	return nil, errCardholderNotFound
+}
+
+// cardholderOf returns the cardholder of a card, among cardholders.
+func cardholderOf(cardholders []cardholderRecord, c *card) cardholderRecord {
+	for _, ch := range cardholders {
+		if c.User != nil && ch.Email == c.User.Email {
+			return ch
+		}
+	}
+	return userCardholder(c)
+}
+
+type stripeAddress struct {
+	City       string  `json:"city"`
+	Country    string  `json:"country"`
+	Line1      string  `json:"line1"`
+	Line2      *string `json:"line2"`
+	PostalCode string  `json:"postal_code"`
+	State      *string `json:"state"`
+}
+
+type stripeBilling struct {
+	Address stripeAddress `json:"address"`
+}
+
+type stripeRequirements struct {
+	DisabledReason *string  `json:"disabled_reason"`
+	PastDue        []string `json:"past_due"`
+}
+
+type stripeCardholder struct {
+	ID           string             `json:"id"`
+	Object       string             `json:"object"`
+	Billing      stripeBilling      `json:"billing"`
+	Created      int64              `json:"created"`
+	Email        *string            `json:"email"`
+	Livemode     bool               `json:"livemode"`
+	Metadata     map[string]string  `json:"metadata"`
+	Name         string             `json:"name"`
+	PhoneNumber  *string            `json:"phone_number"`
+	Requirements stripeRequirements `json:"requirements"`
+	Status       string             `json:"status"`
+	Type         string             `json:"type"`
+}
+
+func newStripeCardholder(ch *cardholderRecord) *stripeCardholder {
+	return &stripeCardholder{
+		ID:     ch.ID,
+		Object: "issuing.cardholder",
+		Billing: stripeBilling{Address: stripeAddress{
+			City:       ch.Billing.City,
+			Country:    ch.Billing.Country,
+			Line1:      ch.Billing.Line1,
+			Line2:      stripeNullable(ch.Billing.Line2),
+			PostalCode: ch.Billing.PostalCode,
+			State:      stripeNullable(ch.Billing.State),
+		}},
+		Created:      ch.CreatedAt.Unix(),
+		Email:        stripeNullable(ch.Email),
+		Metadata:     stripeMetadata(ch.Metadata),
+		Name:         ch.Name,
+		PhoneNumber:  stripeNullable(ch.PhoneNumber),
+		Requirements: stripeRequirements{PastDue: []string{}},
+		Status:       ch.Status,
+		Type:         ch.Type,
+	}
+}
+
+var stripeCardholderParams = []string{"name", "email", "phone_number", "type", "status", "billing", "metadata", "expand"}
+
+// applyCardholderParams sets the fields of ch sent in p.
+func applyCardholderParams(p stripeParams, ch *cardholderRecord) *response {
+	if p.has("name") {
+		ch.Name = p.get("name")
+	}
+	if p.has("email") {
+		ch.Email = p.get("email")
+	}
+	if p.has("phone_number") {
+		ch.PhoneNumber = p.get("phone_number")
+	}
+	if p.has("type") {
+		ch.Type = p.get("type")
+	}
+	if p.has("status") {
+		ch.Status = p.get("status")
+	}
+	fields := map[string]*string{
+		"line1":       &ch.Billing.Line1,
+		"line2":       &ch.Billing.Line2,
+		"city":        &ch.Billing.City,
+		"state":       &ch.Billing.State,
+		"postal_code": &ch.Billing.PostalCode,
+		"country":     &ch.Billing.Country,
+	}
+	for name, field := range fields {
+		if key := "billing[address][" + name + "]"; p.has(key) {
+			*field = p.get(key)
+		}
+	}
+	metadata, errResp := p.metadata(ch.Metadata)
+	if errResp != nil {
+		return errResp
+	}
+	ch.Metadata = metadata
+
+	switch {
+	case ch.Name == "":
+		return stripeInvalidParam("name", "Missing required param: name.")
+	case ch.Type != cardholderIndividual && ch.Type != cardholderCompany:
+		return stripeInvalidParam("type", "Invalid type: must be one of individual or company.")
+	case ch.Status != cardholderActive && ch.Status != cardholderInactive:
+		return stripeInvalidParam("status", "Invalid status: must be one of active or inactive.")
+	}
+	return nil
+}
+
+// stripeCreateCardholder creates a cardholder, it gets a card with
+// POST /v1/issuing/cards.
+func stripeCreateCardholder(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check(stripeCardholderParams...); errResp != nil {
+		return errResp, nil
+	}
+
+	ch := &cardholderRecord{
+		ID:        stripeCardholderPrefix + randomHex(12),
+		Type:      cardholderIndividual,
+		Status:    cardholderActive,
+		CreatedAt: ctx.now(),
+	}
+	if errResp := applyCardholderParams(p, ch); errResp != nil {
+		return errResp, nil
+	}
+	for _, name := range []string{"line1", "city", "postal_code", "country"} {
+		if key := "billing[address][" + name + "]"; p.get(key) == "" {
+			return stripeInvalidParam(key, "Missing required param: "+key+"."), nil
+		}
+	}
+	if err := ctx.store.addCardholder(r.Context(), ch); err != nil {
+		return stripeInvalidParam("email", "A cardholder with this email already exists."), nil
+	}
+
+	obj := newStripeCardholder(ch)
+	ctx.sendStripeEvent(r, "issuing_cardholder.created", obj)
+	return &response{
+		Status: http.StatusOK,
+		Data:   obj,
+	}, nil
+}
+
+// stripeGetCardholder returns a cardholder.
+func stripeGetCardholder(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check("expand"); errResp != nil {
+		return errResp, nil
+	}
+	id := stripeRouteID(r)
+	ch, err := ctx.cardholder(r.Context(), id)
+	if err != nil {
+		return stripeMissing("id", "issuing cardholder", id), nil
+	}
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   newStripeCardholder(ch),
+	}, nil
+}
+
+// stripeUpdateCardholder updates a cardholder. The email of a cardholder
+// with a card can't change, it links the card to its cardholder.
+func stripeUpdateCardholder(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check("email", "phone_number", "status", "billing", "metadata", "expand"); errResp != nil {
+		return errResp, nil
+	}
+	id := stripeRouteID(r)
+	current, err := ctx.cardholder(r.Context(), id)
+	if err != nil {
+		return stripeMissing("id", "issuing cardholder", id), nil
+	}
+	if p.has("email") && p.get("email") != current.Email && current.Email != "" &&
+		ctx.store.find(r.Context(), byEmail(current.Email)) != nil {
+		return stripeInvalidParam("email", "The email of a cardholder with a card can't change."), nil
+	}
+
+	var invalid *response
+	ch, err := ctx.store.putCardholder(r.Context(), *current, func(ch *cardholderRecord) error {
+		if invalid = applyCardholderParams(p, ch); invalid != nil {
+			return errors.New("invalid cardholder")
+		}
+		return nil
+	})
+	if invalid != nil {
+		return invalid, nil
+	}
+	if err != nil {
+		return stripeInvalidParam("email", "A cardholder with this email already exists."), nil
+	}
+
+	obj := newStripeCardholder(ch)
+	ctx.sendStripeEvent(r, "issuing_cardholder.updated", obj)
+	return &response{
+		Status: http.StatusOK,
+		Data:   obj,
+	}, nil
+}
+
+// stripeListCardholders lists the cardholders, newest first.
+func stripeListCardholders(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check("email", "phone_number", "status", "type", "created", "limit", "starting_after", "ending_before", "expand"); errResp != nil {
+		return errResp, nil
+	}
+
+	var cardholders []cardholderRecord
+	for _, ch := range ctx.cardholders(r.Context()) {
+		created, errResp := stripeCreated(p, ch.CreatedAt)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if !created ||
+			(p.get("email") != "" && ch.Email != p.get("email")) ||
+			(p.get("phone_number") != "" && ch.PhoneNumber != p.get("phone_number")) ||
+			(p.get("status") != "" && ch.Status != p.get("status")) ||
+			(p.get("type") != "" && ch.Type != p.get("type")) {
+			continue
+		}
+		cardholders = append(cardholders, ch)
+	}
+
+	ids := make([]string, len(cardholders))
+	for i, ch := range cardholders {
+		ids[i] = ch.ID
+	}
+	start, end, hasMore, errResp := stripePage(p, "issuing cardholder", ids)
+	if errResp != nil {
+		return errResp, nil
+	}
+	list := stripeList{Object: "list", Data: []interface{}{}, HasMore: hasMore, URL: "/v1/issuing/cardholders"}
+	for i := start; i < end; i++ {
+		list.Data = append(list.Data, newStripeCardholder(&cardholders[i]))
+	}
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   list,
+	}, nil
+}
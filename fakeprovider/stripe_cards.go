@@ -0,0 +1,370 @@
+package fakeprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Statuses of the Stripe cards, the blocked cards are inactive and the
+// expired and deleted cards are canceled.
+const (
+	stripeCardActive   = "active"
+	stripeCardInactive = "inactive"
+	stripeCardCanceled = "canceled"
+)
+
+// stripeCurrency is the currency of the cards and their balance.
+const stripeCurrency = "usd"
+
+type stripeCard struct {
+	ID                 string            `json:"id"`
+	Object             string            `json:"object"`
+	Brand              string            `json:"brand"`
+	CancellationReason *string           `json:"cancellation_reason"`
+	Cardholder         interface{}       `json:"cardholder"`
+	Created            int64             `json:"created"`
+	Currency           string            `json:"currency"`
+	CVC                *string           `json:"cvc,omitempty"`
+	ExpMonth           int               `json:"exp_month"`
+	ExpYear            int               `json:"exp_year"`
+	Last4              string            `json:"last4"`
+	Livemode           bool              `json:"livemode"`
+	Metadata           map[string]string `json:"metadata"`
+	Number             *string           `json:"number,omitempty"`
+	Status             string            `json:"status"`
+	Type               string            `json:"type"`
+}
+
+func stripeCardStatus(c *card) string {
+	switch {
+	case c.deleted():
+		return stripeCardCanceled
+	case c.Status == cardStatusActive:
+		return stripeCardActive
+	case c.Status == cardStatusBlocked:
+		return stripeCardInactive
+	}
+	return stripeCardCanceled
+}
+
+func cardBrand(pan string) string {
+	switch {
+	case strings.HasPrefix(pan, "4"):
+		return "Visa"
+	case strings.HasPrefix(pan, "34"), strings.HasPrefix(pan, "37"):
+		return "American Express"
+	}
+	return "MasterCard"
+}
+
+// newStripeCard returns c as a Stripe card, the number and cvc are only
+// set when expanded.
+func (ctx *Context) newStripeCard(c *card, cardholders []cardholderRecord, expand map[string]bool) (*stripeCard, error) {
+	secrets, err := c.Reveal(ctx.keyring)
+	if err != nil {
+		return nil, err
+	}
+	var month, year int
+	fmt.Sscanf(secrets.ExpDate, "%02d/%02d", &month, &year)
+
+	ch := cardholderOf(cardholders, c)
+	sc := &stripeCard{
+		ID:         stripeCardPrefix + c.ID,
+		Object:     "issuing.card",
+		Brand:      cardBrand(secrets.PAN),
+		Cardholder: ch.ID,
+		Created:    c.CreatedAt.Unix(),
+		Currency:   stripeCurrency,
+		ExpMonth:   month,
+		ExpYear:    2000 + year,
+		Last4:      secrets.PAN,
+		Metadata:   stripeMetadata(c.Metadata),
+		Status:     stripeCardStatus(c),
+		Type:       "virtual",
+	}
+	if len(sc.Last4) > 4 {
+		sc.Last4 = sc.Last4[len(sc.Last4)-4:]
+	}
+	if expand["cardholder"] {
+		sc.Cardholder = newStripeCardholder(&ch)
+	}
+	if expand["number"] {
+		sc.Number = &secrets.PAN
+	}
+	if expand["cvc"] {
+		sc.CVC = &secrets.CVV
+	}
+	return sc, nil
+}
+
+// stripeCard returns the card with the given Stripe id, the deleted cards
+// included.
+func (ctx *Context) stripeCard(c context.Context, id string) *card {
+	if !strings.HasPrefix(id, stripeCardPrefix) {
+		return nil
+	}
+	return ctx.store.find(c, byIDWithDeleted(strings.TrimPrefix(id, stripeCardPrefix)))
+}
+
+// splitName splits the name of a cardholder in the first and last name of
+// a user.
+func splitName(name string) (string, string) {
+	fields := strings.Fields(name)
+	if len(fields) < 2 {
+		return name, ""
+	}
+	return strings.Join(fields[:len(fields)-1], " "), fields[len(fields)-1]
+}
+
+// stripeCreateCard issues a virtual card to a cardholder, in the same store
+// as POST /cards. A cardholder has one card at most, which the Stripe API
+// doesn't require.
+func stripeCreateCard(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check("cardholder", "currency", "type", "status", "metadata", "expand"); errResp != nil {
+		return errResp, nil
+	}
+	expand, errResp := p.expand(false, "cardholder", "number", "cvc")
+	if errResp != nil {
+		return errResp, nil
+	}
+	switch {
+	case p.get("cardholder") == "":
+		return stripeInvalidParam("cardholder", "Missing required param: cardholder."), nil
+	case p.get("currency") != stripeCurrency:
+		return stripeInvalidParam("currency", "Only usd cards are issued."), nil
+	case p.get("type") != "virtual":
+		return stripeInvalidParam("type", "Only virtual cards are issued."), nil
+	}
+	status := cardStatusBlocked
+	switch p.get("status") {
+	case "", stripeCardInactive:
+	case stripeCardActive:
+		status = cardStatusActive
+	default:
+		return stripeInvalidParam("status", "Invalid status: must be one of active or inactive."), nil
+	}
+	metadata, errResp := p.metadata(nil)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	ch, err := ctx.cardholder(r.Context(), p.get("cardholder"))
+	if err != nil {
+		return stripeMissing("cardholder", "issuing cardholder", p.get("cardholder")), nil
+	}
+	if ch.Email == "" {
+		return stripeInvalidParam("cardholder", "The cardholder needs an email to be issued a card."), nil
+	}
+	if ctx.store.find(r.Context(), byEmail(ch.Email)) != nil {
+		return stripeInvalidParam("cardholder", "The cardholder already has a card."), nil
+	}
+
+	first, last := splitName(ch.Name)
+	c, err := newCard(ctx.keyring, &user{FirstName: first, LastName: last, Email: ch.Email}, ctx.now())
+	if err != nil {
+		return nil, err
+	}
+	c.SetStatus(status)
+	c.Metadata = metadata
+	ctx.simulateProcessing(r, ctx.chaos.get().CreateDelay)
+
+	if err := randomError(ctx, r); err != nil {
+		return nil, err
+	}
+	if err := ctx.store.add(r.Context(), c); err != nil {
+		return stripeInvalidParam("cardholder", "The cardholder already has a card."), nil
+	}
+
+	sc, err := ctx.newStripeCard(c, []cardholderRecord{*ch}, expand)
+	if err != nil {
+		return nil, err
+	}
+	event, err := ctx.newStripeCard(c, []cardholderRecord{*ch}, nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx.sendStripeEvent(r, "issuing_card.created", event)
+	return &response{
+		Status: http.StatusOK,
+		Data:   sc,
+	}, nil
+}
+
+// stripeGetCard returns a card, its number and cvc when expanded.
+func stripeGetCard(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check("expand"); errResp != nil {
+		return errResp, nil
+	}
+	expand, errResp := p.expand(false, "cardholder", "number", "cvc")
+	if errResp != nil {
+		return errResp, nil
+	}
+	id := stripeRouteID(r)
+	c := ctx.stripeCard(r.Context(), id)
+	if c == nil {
+		return stripeMissing("id", "issuing card", id), nil
+	}
+
+	sc, err := ctx.newStripeCard(c, ctx.cardholders(r.Context()), expand)
+	if err != nil {
+		return nil, err
+	}
+	return &response{
+		Status: http.StatusOK,
+		Data:   sc,
+	}, nil
+}
+
+// stripeUpdateCard changes the status or the metadata of a card. Canceling
+// a card is final.
+func stripeUpdateCard(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check("status", "metadata", "expand"); errResp != nil {
+		return errResp, nil
+	}
+	expand, errResp := p.expand(false, "cardholder", "number", "cvc")
+	if errResp != nil {
+		return errResp, nil
+	}
+	status := ""
+	switch p.get("status") {
+	case "":
+	case stripeCardActive:
+		status = cardStatusActive
+	case stripeCardInactive:
+		status = cardStatusBlocked
+	case stripeCardCanceled:
+		status = cardStatusCanceled
+	default:
+		return stripeInvalidParam("status", "Invalid status: must be one of active, inactive or canceled."), nil
+	}
+
+	id := stripeRouteID(r)
+	current := ctx.stripeCard(r.Context(), id)
+	if current == nil {
+		return stripeMissing("id", "issuing card", id), nil
+	}
+	if stripeCardStatus(current) == stripeCardCanceled {
+		return stripeInvalidParam("status", "You cannot update a canceled card."), nil
+	}
+
+	now := ctx.now()
+	var invalid *response
+	c := ctx.store.update(r.Context(), byID(current.ID), func(c *card) {
+		if stripeCardStatus(c) == stripeCardCanceled {
+			invalid = stripeInvalidParam("status", "You cannot update a canceled card.")
+			return
+		}
+		metadata, errResp := p.metadata(c.Metadata)
+		if errResp != nil {
+			invalid = errResp
+			return
+		}
+		if status != "" {
+			c.SetStatus(status)
+		}
+		c.Metadata = metadata
+		c.UpdatedAt = now
+	})
+	if invalid != nil {
+		return invalid, nil
+	}
+	if c == nil {
+		return stripeMissing("id", "issuing card", id), nil
+	}
+
+	cardholders := ctx.cardholders(r.Context())
+	sc, err := ctx.newStripeCard(c, cardholders, expand)
+	if err != nil {
+		return nil, err
+	}
+	event, err := ctx.newStripeCard(c, cardholders, nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx.sendStripeEvent(r, "issuing_card.updated", event)
+	return &response{
+		Status: http.StatusOK,
+		Data:   sc,
+	}, nil
+}
+
+// stripeListCards lists the cards, the deleted ones as canceled, newest
+// first.
+func stripeListCards(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check("cardholder", "status", "type", "last4", "exp_month", "exp_year", "created", "limit", "starting_after", "ending_before", "expand"); errResp != nil {
+		return errResp, nil
+	}
+	expand, errResp := p.expand(true, "cardholder")
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	cardholders := ctx.cardholders(r.Context())
+	cards := ctx.store.list(r.Context())
+	for i, j := 0, len(cards)-1; i < j; i, j = i+1, j-1 {
+		cards[i], cards[j] = cards[j], cards[i]
+	}
+	sort.SliceStable(cards, func(i, j int) bool { return cards[i].CreatedAt.After(cards[j].CreatedAt) })
+
+	var selected []*stripeCard
+	for _, c := range cards {
+		created, errResp := stripeCreated(p, c.CreatedAt)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if !created {
+			continue
+		}
+		sc, err := ctx.newStripeCard(c, cardholders, expand)
+		if err != nil {
+			return nil, err
+		}
+		if (p.get("cardholder") != "" && stripeObjectID(sc.Cardholder) != p.get("cardholder")) ||
+			(p.get("status") != "" && sc.Status != p.get("status")) ||
+			(p.get("type") != "" && sc.Type != p.get("type")) ||
+			(p.get("last4") != "" && sc.Last4 != p.get("last4")) ||
+			(p.get("exp_month") != "" && strconv.Itoa(sc.ExpMonth) != p.get("exp_month")) ||
+			(p.get("exp_year") != "" && strconv.Itoa(sc.ExpYear) != p.get("exp_year")) {
+			continue
+		}
+		selected = append(selected, sc)
+	}
+
+	ids := make([]string, len(selected))
+	for i, sc := range selected {
+		ids[i] = sc.ID
+	}
+	start, end, hasMore, errResp := stripePage(p, "issuing card", ids)
+	if errResp != nil {
+		return errResp, nil
+	}
+	list := stripeList{Object: "list", Data: []interface{}{}, HasMore: hasMore, URL: "/v1/issuing/cards"}
+	for _, sc := range selected[start:end] {
+		list.Data = append(list.Data, sc)
+	}
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   list,
+	}, nil
+}
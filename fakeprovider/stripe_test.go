@@ -0,0 +1,133 @@
+package fakeprovider
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func testStripeParams(t *testing.T, query string) stripeParams {
+	t.Helper()
+	v, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stripeParams(v)
+}
+
+// checkStripeError fails unless resp is a Stripe error of status about
+// param.
+func checkStripeError(t *testing.T, resp *response, status int, param string) {
+	t.Helper()
+	if resp == nil {
+		t.Fatalf("no error, want a %d about %s", status, param)
+	}
+	body, ok := resp.Data.(stripeErrorBody)
+	if resp.Status != status || !ok || body.Error.Param != param {
+		t.Errorf("error = %d %+v, want a %d about %s", resp.Status, resp.Data, status, param)
+	}
+}
+
+func TestStripeParamsList(t *testing.T) {
+	tests := map[string][]string{
+		"":                                       {},
+		"expand[]=cardholder&expand[]=card":      {"cardholder", "card"},
+		"expand[1]=card&expand[0]=cardholder":    {"cardholder", "card"},
+		"expand[10]=c&expand[2]=b&expand[]=a":    {"a", "b", "c"},
+		"expand[x]=card&expand=card&expander[]=": {},
+	}
+	for query, want := range tests {
+		if got := testStripeParams(t, query).list("expand"); !reflect.DeepEqual(got, want) {
+			t.Errorf("list(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestStripeParamsHash(t *testing.T) {
+	tests := map[string]map[string]string{
+		"":                         nil,
+		"metadata=":                nil,
+		"metadata[order]=42":       {"order": "42"},
+		"metadata[a]=1&metadata[]": {"a": "1"},
+		"metadata[a][b]=1&metadata[c]=2&metadatum[d]=3": {"c": "2"},
+	}
+	for query, want := range tests {
+		if got := testStripeParams(t, query).hash("metadata"); !reflect.DeepEqual(got, want) {
+			t.Errorf("hash(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestStripeParamsMetadata(t *testing.T) {
+	current := map[string]string{"order": "42", "team": "cards"}
+	tests := map[string]map[string]string{
+		"":                                   current,
+		"metadata=":                          nil,
+		"metadata[order]=43":                 {"order": "43", "team": "cards"},
+		"metadata[team]=&metadata[env]=test": {"order": "42", "env": "test"},
+		"metadata[order]=&metadata[team]=":   nil,
+	}
+	for query, want := range tests {
+		got, errResp := testStripeParams(t, query).metadata(current)
+		if errResp != nil {
+			t.Fatalf("metadata(%q): %+v", query, errResp.Data)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("metadata(%q) = %v, want %v", query, got, want)
+		}
+	}
+	if current["order"] != "42" || len(current) != 2 {
+		t.Errorf("metadata modified its argument: %v", current)
+	}
+
+	tooMany := url.Values{}
+	for i := 0; i < 51; i++ {
+		tooMany.Set(fmt.Sprintf("metadata[k%d]", i), "v")
+	}
+	_, errResp := stripeParams(tooMany).metadata(nil)
+	checkStripeError(t, errResp, http.StatusBadRequest, "metadata")
+}
+
+func TestStripePage(t *testing.T) {
+	ids := []string{"a", "b", "c", "d", "e"}
+	tests := []struct {
+		query      string
+		start, end int
+		hasMore    bool
+	}{
+		{"", 0, 5, false},
+		{"limit=2", 0, 2, true},
+		{"limit=2&starting_after=b", 2, 4, true},
+		{"limit=2&starting_after=c", 3, 5, false},
+		{"limit=2&ending_before=d", 1, 3, true},
+		{"limit=2&ending_before=b", 0, 1, false},
+		{"limit=100", 0, 5, false},
+	}
+	for _, tt := range tests {
+		start, end, hasMore, errResp := stripePage(testStripeParams(t, tt.query), "card", ids)
+		if errResp != nil {
+			t.Fatalf("stripePage(%q): %+v", tt.query, errResp.Data)
+		}
+		if start != tt.start || end != tt.end || hasMore != tt.hasMore {
+			t.Errorf("stripePage(%q) = %d, %d, %v, want %d, %d, %v", tt.query, start, end, hasMore, tt.start, tt.end, tt.hasMore)
+		}
+	}
+
+	invalid := []struct {
+		query  string
+		status int
+		param  string
+	}{
+		{"limit=0", http.StatusBadRequest, "limit"},
+		{"limit=101", http.StatusBadRequest, "limit"},
+		{"limit=ten", http.StatusBadRequest, "limit"},
+		{"starting_after=z", http.StatusNotFound, "starting_after"},
+		{"ending_before=z", http.StatusNotFound, "ending_before"},
+	}
+	for _, tt := range invalid {
+		_, _, _, errResp := stripePage(testStripeParams(t, tt.query), "card", ids)
+		checkStripeError(t, errResp, tt.status, tt.param)
+	}
+}
@@ -0,0 +1,481 @@
+package fakeprovider
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/logger"
+	"github.com/rodrwan/fakeproviders/requestid"
+	"github.com/rodrwan/fakeproviders/tracing"
+)
+
+// webhookTimeout bounds the deliveries of the events.
+const webhookTimeout = 10 * time.Second
+
+// webhookQueueSize is the number of deliveries waiting to be sent, the
+// events sent when it is full are dropped.
+const webhookQueueSize = 256
+
+var errWebhookEndpointNotFound = errors.New("webhook endpoint not found")
+
+// webhookEndpoint receives the events of the Stripe API.
+type webhookEndpoint struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// EnabledEvents are the types of the events sent, "*" sends them all.
+	EnabledEvents []string          `json:"enabled_events"`
+	Description   string            `json:"description,omitempty"`
+	Disabled      bool              `json:"disabled,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+
+	// secret signs the events sent to the endpoint.
+	secret string
+}
+
+func (e *webhookEndpoint) enabled(event string) bool {
+	if e.Disabled {
+		return false
+	}
+	for _, enabled := range e.EnabledEvents {
+		if enabled == "*" || enabled == event {
+			return true
+		}
+	}
+	return false
+}
+
+// addWebhookEndpoint adds a webhook endpoint.
+func (s *store) addWebhookEndpoint(ctx context.Context, e *webhookEndpoint) {
+	_, span := tracing.Start(ctx, "store.add_webhook_endpoint")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := *e
+	s.webhookEndpoints = append(s.webhookEndpoints, &cp)
+}
+
+// webhookEndpointList returns the webhook endpoints, oldest first.
+func (s *store) webhookEndpointList(ctx context.Context) []webhookEndpoint {
+	_, span := tracing.Start(ctx, "store.list_webhook_endpoints")
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	endpoints := make([]webhookEndpoint, len(s.webhookEndpoints))
+	for i, e := range s.webhookEndpoints {
+		endpoints[i] = *e
+	}
+	return endpoints
+}
+
+// updateWebhookEndpoint applies fn to the webhook endpoint with the given
+// id and returns it updated.
+func (s *store) updateWebhookEndpoint(ctx context.Context, id string, fn func(*webhookEndpoint)) (*webhookEndpoint, error) {
+	_, span := tracing.Start(ctx, "store.update_webhook_endpoint")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.webhookEndpoints {
+		if e.ID == id {
+			fn(e)
+			cp := *e
+			return &cp, nil
+		}
+	}
+	return nil, errWebhookEndpointNotFound
+}
+
+// deleteWebhookEndpoint removes the webhook endpoint with the given id.
+func (s *store) deleteWebhookEndpoint(ctx context.Context, id string) bool {
+	_, span := tracing.Start(ctx, "store.delete_webhook_endpoint")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, e := range s.webhookEndpoints {
+		if e.ID == id {
+			s.webhookEndpoints = append(s.webhookEndpoints[:i], s.webhookEndpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// webhookDelivery is an event to send to an endpoint, signed with secret
+// when it is sent.
+type webhookDelivery struct {
+	tenant  string
+	url     string
+	event   string
+	secret  string
+	header  http.Header
+	payload []byte
+}
+
+// webhookSender sends the events one at a time, in the order they happened.
+// Failed deliveries are logged and not retried.
+type webhookSender struct {
+	client *http.Client
+	queue  chan webhookDelivery
+
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func startWebhookSender() *webhookSender {
+	s := &webhookSender{
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan webhookDelivery, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *webhookSender) run() {
+	for {
+		select {
+		case d := <-s.queue:
+			s.deliver(d)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *webhookSender) deliver(d webhookDelivery) {
+	l := logger.FromContext(context.Background()).
+		WithField("tenant", d.tenant).
+		WithField("event", d.event).
+		WithField("url", d.url)
+
+	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(d.payload))
+	if err != nil {
+		l.WithError(err).Error("could not send webhook")
+		return
+	}
+	req.Header = d.header
+	req.Header.Set("Stripe-Signature", webhookSignature(d.secret, time.Now(), d.payload))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		l.WithError(err).Warn("webhook delivery failed")
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		l.WithField("status", resp.StatusCode).Warn("webhook rejected")
+	}
+}
+
+// send queues a delivery, it is dropped when the queue is full.
+func (s *webhookSender) send(d webhookDelivery) {
+	select {
+	case s.queue <- d:
+	default:
+		logger.FromContext(context.Background()).
+			WithField("event", d.event).
+			WithField("url", d.url).
+			Warn("webhook queue full, event dropped")
+	}
+}
+
+func (s *webhookSender) stop() {
+	s.stopOnce.Do(func() { close(s.done) })
+}
+
+type stripeEventRequest struct {
+	ID             *string `json:"id"`
+	IdempotencyKey *string `json:"idempotency_key"`
+}
+
+type stripeEventData struct {
+	Object interface{} `json:"object"`
+}
+
+type stripeEvent struct {
+	ID              string             `json:"id"`
+	Object          string             `json:"object"`
+	APIVersion      string             `json:"api_version"`
+	Created         int64              `json:"created"`
+	Data            stripeEventData    `json:"data"`
+	Livemode        bool               `json:"livemode"`
+	PendingWebhooks int                `json:"pending_webhooks"`
+	Request         stripeEventRequest `json:"request"`
+	Type            string             `json:"type"`
+}
+
+// webhookSignature signs a payload like the Stripe-Signature header does,
+// the JIT requests are signed alike. t is the wall-clock time, the receivers
+// compare it with theirs even when the server runs on a virtual clock.
+func webhookSignature(secret string, t time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", t.Unix())
+	mac.Write(payload)
+	return fmt.Sprintf("t=%d,v1=%s", t.Unix(), hex.EncodeToString(mac.Sum(nil)))
+}
+
+// sendStripeEvent sends an event about object to the webhook endpoints of
+// the tenant of r enabled for it, signed with their secret.
+func (ctx *Context) sendStripeEvent(r *http.Request, typ string, object interface{}) {
+	var endpoints []webhookEndpoint
+	for _, e := range ctx.store.webhookEndpointList(r.Context()) {
+		if e.enabled(typ) {
+			endpoints = append(endpoints, e)
+		}
+	}
+	if len(endpoints) == 0 {
+		return
+	}
+
+	event := stripeEvent{
+		ID:              stripeEventPrefix + randomHex(12),
+		Object:          "event",
+		APIVersion:      stripeAPIVersion,
+		Created:         ctx.now().Unix(),
+		Data:            stripeEventData{Object: object},
+		PendingWebhooks: len(endpoints),
+		Request: stripeEventRequest{
+			ID:             stripeNullable(requestid.FromContext(r.Context())),
+			IdempotencyKey: stripeNullable(r.Header.Get("Idempotency-Key")),
+		},
+		Type: typ,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.FromContext(r.Context()).WithError(err).Error("could not encode webhook event")
+		return
+	}
+	for _, e := range endpoints {
+		header := make(http.Header)
+		header.Set("Content-Type", "application/json; charset=utf-8")
+		header.Set("User-Agent", "Stripe/1.0 (+https://stripe.com/docs/webhooks)")
+		ctx.webhooks.send(webhookDelivery{
+			tenant:  ctx.tenant,
+			url:     e.URL,
+			event:   typ,
+			secret:  e.secret,
+			header:  header,
+			payload: payload,
+		})
+	}
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+type stripeWebhookEndpoint struct {
+	ID            string            `json:"id"`
+	Object        string            `json:"object"`
+	APIVersion    *string           `json:"api_version"`
+	Application   *string           `json:"application"`
+	Created       int64             `json:"created"`
+	Description   *string           `json:"description"`
+	EnabledEvents []string          `json:"enabled_events"`
+	Livemode      bool              `json:"livemode"`
+	Metadata      map[string]string `json:"metadata"`
+	Secret        string            `json:"secret,omitempty"`
+	Status        string            `json:"status"`
+	URL           string            `json:"url"`
+}
+
+func newStripeWebhookEndpoint(e *webhookEndpoint) *stripeWebhookEndpoint {
+	status := "enabled"
+	if e.Disabled {
+		status = "disabled"
+	}
+	return &stripeWebhookEndpoint{
+		ID:            e.ID,
+		Object:        "webhook_endpoint",
+		Created:       e.CreatedAt.Unix(),
+		Description:   stripeNullable(e.Description),
+		EnabledEvents: e.EnabledEvents,
+		Metadata:      stripeMetadata(e.Metadata),
+		Status:        status,
+		URL:           e.URL,
+	}
+}
+
+// applyWebhookEndpointParams sets the fields of e sent in p.
+func applyWebhookEndpointParams(p stripeParams, e *webhookEndpoint) *response {
+	if p.has("url") {
+		u, err := url.Parse(p.get("url"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return stripeInvalidParam("url", "Invalid URL: "+p.get("url"))
+		}
+		e.URL = u.String()
+	}
+	if events := p.list("enabled_events"); len(events) > 0 {
+		e.EnabledEvents = events
+	}
+	if p.has("description") {
+		e.Description = p.get("description")
+	}
+	if p.has("disabled") {
+		disabled, errResp := p.boolean("disabled")
+		if errResp != nil {
+			return errResp
+		}
+		e.Disabled = disabled
+	}
+	metadata, errResp := p.metadata(e.Metadata)
+	if errResp != nil {
+		return errResp
+	}
+	e.Metadata = metadata
+
+	switch {
+	case e.URL == "":
+		return stripeInvalidParam("url", "Missing required param: url.")
+	case len(e.EnabledEvents) == 0:
+		return stripeInvalidParam("enabled_events", "Missing required param: enabled_events.")
+	}
+	return nil
+}
+
+// stripeCreateWebhookEndpoint adds an endpoint receiving the events of the
+// tenant, its signing secret is only returned here.
+func stripeCreateWebhookEndpoint(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check("url", "enabled_events", "description", "metadata", "api_version", "expand"); errResp != nil {
+		return errResp, nil
+	}
+
+	e := &webhookEndpoint{
+		ID:        stripeWebhookEndpointPrefix + randomHex(12),
+		CreatedAt: ctx.now(),
+		secret:    "whsec_" + randomHex(16),
+	}
+	if errResp := applyWebhookEndpointParams(p, e); errResp != nil {
+		return errResp, nil
+	}
+	ctx.store.addWebhookEndpoint(r.Context(), e)
+	logger.FromContext(r.Context()).WithField("url", e.URL).Info("webhook endpoint added")
+
+	obj := newStripeWebhookEndpoint(e)
+	obj.Secret = e.secret
+	return &response{
+		Status: http.StatusOK,
+		Data:   obj,
+	}, nil
+}
+
+// stripeGetWebhookEndpoint returns a webhook endpoint.
+func stripeGetWebhookEndpoint(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	id := stripeRouteID(r)
+	for _, e := range ctx.store.webhookEndpointList(r.Context()) {
+		if e.ID == id {
+			return &response{
+				Status: http.StatusOK,
+				Data:   newStripeWebhookEndpoint(&e),
+			}, nil
+		}
+	}
+	return stripeMissing("id", "webhook endpoint", id), nil
+}
+
+// stripeUpdateWebhookEndpoint updates a webhook endpoint.
+func stripeUpdateWebhookEndpoint(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check("url", "enabled_events", "description", "disabled", "metadata", "expand"); errResp != nil {
+		return errResp, nil
+	}
+
+	id := stripeRouteID(r)
+	var invalid *response
+	e, err := ctx.store.updateWebhookEndpoint(r.Context(), id, func(e *webhookEndpoint) {
+		updated := *e
+		if invalid = applyWebhookEndpointParams(p, &updated); invalid == nil {
+			*e = updated
+		}
+	})
+	if err != nil {
+		return stripeMissing("id", "webhook endpoint", id), nil
+	}
+	if invalid != nil {
+		return invalid, nil
+	}
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   newStripeWebhookEndpoint(e),
+	}, nil
+}
+
+// stripeDeleteWebhookEndpoint removes a webhook endpoint.
+func stripeDeleteWebhookEndpoint(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	id := stripeRouteID(r)
+	if !ctx.store.deleteWebhookEndpoint(r.Context(), id) {
+		return stripeMissing("id", "webhook endpoint", id), nil
+	}
+
+	return &response{
+		Status: http.StatusOK,
+		Data: struct {
+			ID      string `json:"id"`
+			Object  string `json:"object"`
+			Deleted bool   `json:"deleted"`
+		}{id, "webhook_endpoint", true},
+	}, nil
+}
+
+// stripeListWebhookEndpoints lists the webhook endpoints, newest first.
+func stripeListWebhookEndpoints(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	p, errResp := parseStripeParams(r)
+	if errResp != nil {
+		return errResp, nil
+	}
+	if errResp := p.check("limit", "starting_after", "ending_before", "expand"); errResp != nil {
+		return errResp, nil
+	}
+
+	endpoints := ctx.store.webhookEndpointList(r.Context())
+	for i, j := 0, len(endpoints)-1; i < j; i, j = i+1, j-1 {
+		endpoints[i], endpoints[j] = endpoints[j], endpoints[i]
+	}
+	sort.SliceStable(endpoints, func(i, j int) bool { return endpoints[i].CreatedAt.After(endpoints[j].CreatedAt) })
+
+	ids := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		ids[i] = e.ID
+	}
+	start, end, hasMore, errResp := stripePage(p, "webhook endpoint", ids)
+	if errResp != nil {
+		return errResp, nil
+	}
+	list := stripeList{Object: "list", Data: []interface{}{}, HasMore: hasMore, URL: "/v1/webhook_endpoints"}
+	for i := start; i < end; i++ {
+		list.Data = append(list.Data, newStripeWebhookEndpoint(&endpoints[i]))
+	}
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   list,
+	}, nil
+}
@@ -0,0 +1,350 @@
+package fakeprovider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apierror "github.com/rodrwan/fakeproviders/api-error"
+)
+
+// TenantHeader selects the tenant of a request. Requests bearing a tenant
+// API token don't need it.
+const TenantHeader = "X-Tenant-ID"
+
+// DefaultTenant is the tenant of the requests that don't select one.
+const DefaultTenant = "default"
+
+// DefaultMaxTenants is the number of tenants a server holds when
+// Options.MaxTenants is zero.
+const DefaultMaxTenants = 100
+
+var validTenantID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+var (
+	errInvalidTenant        = errors.New("invalid tenant id, use up to 64 letters, digits, dots, dashes or underscores")
+	errTenantTokenMismatch  = errors.New("the tenant header doesn't match the tenant of the API token")
+	errDefaultTenantRemoval = errors.New("the default tenant can't be removed")
+	errUnknownTenant        = errors.New("unknown tenant, it is created by the first request bearing an API or admin token")
+	errTooManyTenants       = errors.New("too many tenants, remove some through DELETE /_admin/tenants/:tenant")
+	errTenantNeedsToken     = errors.New("the tenant header needs an API or admin token on this route")
+)
+
+// tenant is an isolated partition of the server state: its cards and users,
+// ledger, sessions, verification keys, TOTP enrollments, scenarios, chaos
+// and JIT settings. The clock and the key-encryption keys are shared.
+type tenant struct {
+	id        string
+	createdAt time.Time
+
+	store     *store
+	totp      *totpStore
+	scenarios *scenarioSet
+	chaos     *chaosSettings
+	jit       *jitSettings
+}
+
+// tenantSet holds the tenants, they are created with the startup state the
+// first time an authenticated request uses them.
+type tenantSet struct {
+	ctx *Context
+	// tokens maps the tenant API tokens to their tenant.
+	tokens map[string]string
+	// auth accepts the tokens allowed to create tenants: the API, tenant
+	// API and admin tokens.
+	auth *AuthMiddleware
+	max  int
+
+	mu      sync.Mutex
+	tenants map[string]*tenant
+}
+
+func newTenantSet(ctx *Context, tokens map[string]string, auth *AuthMiddleware, max int) (*tenantSet, error) {
+	for _, id := range tokens {
+		if !validTenantID.MatchString(id) {
+			return nil, errInvalidTenant
+		}
+	}
+	if max < 0 {
+		return nil, errors.New("the maximum number of tenants can't be negative")
+	}
+	if max == 0 {
+		max = DefaultMaxTenants
+	}
+	return &tenantSet{
+		ctx:     ctx,
+		tokens:  tokens,
+		auth:    auth,
+		max:     max,
+		tenants: make(map[string]*tenant),
+	}, nil
+}
+
+// get returns the tenant with the given id, creating it when missing.
+func (ts *tenantSet) get(id string) (*tenant, error) {
+	return ts.open(id, true)
+}
+
+// open returns the tenant with the given id, creating it when missing if
+// create is set. Up to max tenants are created.
+func (ts *tenantSet) open(id string, create bool) (*tenant, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if t, ok := ts.tenants[id]; ok {
+		return t, nil
+	}
+	if !create {
+		return nil, errUnknownTenant
+	}
+	if len(ts.tenants) >= ts.max {
+		return nil, errTooManyTenants
+	}
+	t, err := ts.newTenant(id)
+	if err != nil {
+		return nil, err
+	}
+	ts.tenants[id] = t
+	return t, nil
+}
+
+// newTenant returns a tenant with the startup state, it isn't added to the
+// set.
+func (ts *tenantSet) newTenant(id string) (*tenant, error) {
+	t := &tenant{
+		id:        id,
+		createdAt: ts.ctx.now(),
+		store:     newStore(nil, nil),
+		totp:      newTOTPStore(ts.ctx.totpSkew),
+		scenarios: newScenarioSet(ts.ctx.metrics, ts.ctx.clock),
+		chaos:     &chaosSettings{},
+		jit:       &jitSettings{},
+	}
+	if err := ts.ctx.forTenant(t).resetTenant(context.Background()); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// list returns the tenants sorted by id.
+func (ts *tenantSet) list() []*tenant {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	tenants := make([]*tenant, 0, len(ts.tenants))
+	for _, t := range ts.tenants {
+		tenants = append(tenants, t)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].id < tenants[j].id })
+	return tenants
+}
+
+// remove drops a tenant, it is created again with the startup state by the
+// next authenticated request using it.
+func (ts *tenantSet) remove(id string) (bool, error) {
+	if id == DefaultTenant {
+		return false, errDefaultTenantRemoval
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	_, ok := ts.tenants[id]
+	delete(ts.tenants, id)
+	return ok, nil
+}
+
+// tenantID returns the tenant selected by a request: the tenant of its API
+// token, the TenantHeader or DefaultTenant.
+func (ts *tenantSet) tenantID(r *http.Request) (string, error) {
+	header := r.Header.Get(TenantHeader)
+	if token := apiKey(r); token != "" {
+		if id, ok := ts.tokens[token]; ok {
+			if header != "" && header != id {
+				return "", errTenantTokenMismatch
+			}
+			return id, nil
+		}
+	}
+	if header == "" {
+		return DefaultTenant, nil
+	}
+	if !validTenantID.MatchString(header) {
+		return "", errInvalidTenant
+	}
+	return header, nil
+}
+
+// ParseTenantTokens parses comma separated token:tenant pairs, as used by
+// Options.TenantTokens.
+func ParseTenantTokens(s string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.LastIndex(pair, ":")
+		if i <= 0 {
+			return nil, errors.New("invalid tenant token, use token:tenant")
+		}
+		token, id := pair[:i], pair[i+1:]
+		if !validTenantID.MatchString(id) {
+			return nil, errInvalidTenant
+		}
+		if _, ok := tokens[token]; ok {
+			return nil, errors.New("duplicated tenant token")
+		}
+		tokens[token] = id
+	}
+	return tokens, nil
+}
+
+type tenantContextKey struct{}
+
+// Handle resolves the tenant of the request, handlers served by
+// ContextHandler then only see its state. Only the requests bearing a token
+// of the server create the missing tenants, the others can't use them.
+func (ts *tenantSet) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := ts.tenantID(r)
+		if err != nil {
+			apierror.NewError(err.Error(), http.StatusBadRequest).Write(w)
+			return
+		}
+		key := apiKey(r)
+		t, err := ts.open(id, key != "" && ts.auth.accepts(key))
+		switch err {
+		case nil:
+		case errUnknownTenant:
+			apierror.NewError(err.Error(), http.StatusNotFound).Write(w)
+			return
+		case errTooManyTenants:
+			apierror.NewError(err.Error(), http.StatusBadRequest).Write(w)
+			return
+		default:
+			apierror.NewError(err.Error(), http.StatusInternalServerError).Write(w)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, t)))
+	})
+}
+
+// requireToken rejects the requests selecting a tenant other than
+// DefaultTenant with the TenantHeader but without a token of the server, so
+// the public card routes don't disclose the cards of the tenants. The
+// cardholder routes don't need it, the credentials or the session of the
+// tenant authenticate them.
+func (ts *tenantSet) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get(TenantHeader)
+		if key := apiKey(r); header != "" && header != DefaultTenant && (key == "" || !ts.auth.accepts(key)) {
+			apierror.NewError(errTenantNeedsToken.Error(), http.StatusUnauthorized).Write(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tenantFromContext returns the tenant resolved by tenantSet.Handle.
+func tenantFromContext(ctx context.Context) (*tenant, bool) {
+	t, ok := ctx.Value(tenantContextKey{}).(*tenant)
+	return t, ok
+}
+
+// scenarioMiddleware plays the scenarios of the tenant of the request.
+func (ts *tenantSet) scenarioMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, ok := tenantFromContext(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		t.scenarios.Handle(next).ServeHTTP(w, r)
+	})
+}
+
+// forTenant returns a copy of ctx bound to the state of t.
+func (ctx *Context) forTenant(t *tenant) *Context {
+	c := *ctx
+	c.tenant = t.id
+	c.store = t.store
+	c.totp = t.totp
+	c.scenarios = t.scenarios
+	c.chaos = t.chaos
+	c.jit = t.jit
+	return &c
+}
+
+// resetTenant restores the startup state of the tenant: its state in the
+// startup snapshot or the seed cards, the startup scenarios, chaos and JIT
+// settings.
+func (ctx *Context) resetTenant(c context.Context) error {
+	if err := ctx.scenarios.reset(ctx.seedScenarios); err != nil {
+		return err
+	}
+	if state := ctx.seedState.get(ctx.tenant); state != nil {
+		rt, err := ctx.openTenantSnapshot(state)
+		if err != nil {
+			return err
+		}
+		ctx.applyTenantSnapshot(c, rt)
+	} else {
+		cards, ledger, err := seedCards(ctx.keyring, ctx.seed, ctx.now())
+		if err != nil {
+			return err
+		}
+		ctx.store.restore(c, storeState{cards: cards, ledger: ledger})
+		ctx.totp.reset()
+	}
+	ctx.chaos.set(ctx.seedChaos)
+	ctx.jit.set(ctx.seedJIT)
+	return nil
+}
+
+type tenantInfo struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Cards     int       `json:"cards"`
+}
+
+// listTenants lists the tenants created so far.
+func listTenants(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	tenants := ctx.tenants.list()
+	infos := make([]tenantInfo, len(tenants))
+	for i, t := range tenants {
+		infos[i] = tenantInfo{
+			ID:        t.id,
+			CreatedAt: t.createdAt,
+			Cards:     len(t.store.list(r.Context())),
+		}
+	}
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   infos,
+	}, nil
+}
+
+// removeTenant drops a tenant and its whole state.
+func removeTenant(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	id, ok := r.Context().Value("tenant").(string)
+	if !ok {
+		return nil, errors.New("missing tenant")
+	}
+
+	removed, err := ctx.tenants.remove(id)
+	if err != nil {
+		return &response{Status: http.StatusBadRequest, Data: err.Error()}, nil
+	}
+	if !removed {
+		return &response{Status: http.StatusNotFound}, nil
+	}
+
+	return &response{
+		Status: http.StatusOK,
+		Data:   "tenant removed",
+	}, nil
+}
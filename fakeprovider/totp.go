@@ -0,0 +1,218 @@
+package fakeprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/totp"
+)
+
+// totpIssuer names the fake in the otpauth:// URIs.
+const totpIssuer = "fakeprovider"
+
+var (
+	errTOTPNotEnrolled = errors.New("totp is not enrolled")
+	errTOTPInvalidCode = errors.New("invalid totp code")
+	errTOTPCodeReused  = errors.New("totp code already used")
+	errTOTPEnrolled    = errors.New("totp is already enrolled, send a current totp_code to replace it")
+)
+
+// totpEnrollment holds the authenticator app secret of a cardholder.
+type totpEnrollment struct {
+	Secret    []byte
+	Confirmed bool
+	// LastStep is the last accepted time step, codes for it or any earlier
+	// step are rejected.
+	LastStep int64
+	// Pending replaces Secret once confirmed, Secret is used until then.
+	Pending []byte
+}
+
+// totpStore keeps the TOTP enrollments indexed by user id.
+type totpStore struct {
+	mu          sync.Mutex
+	enrollments map[string]*totpEnrollment
+	skew        int
+}
+
+func newTOTPStore(skew int) *totpStore {
+	return &totpStore{
+		enrollments: make(map[string]*totpEnrollment),
+		skew:        skew,
+	}
+}
+
+// enroll creates a new unconfirmed secret for the given user, replacing any
+// unconfirmed one. A confirmed enrollment is only replaced with a valid code,
+// its secret stays in use until the new one is confirmed.
+func (s *totpStore) enroll(userID, code string, now time.Time) ([]byte, error) {
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.enrollments[userID]
+	if !ok || !e.Confirmed {
+		s.enrollments[userID] = &totpEnrollment{Secret: secret}
+		return secret, nil
+	}
+	if code == "" {
+		return nil, errTOTPEnrolled
+	}
+	if err := s.accept(e, e.Secret, code, now); err != nil {
+		return nil, err
+	}
+	e.Pending = secret
+	return secret, nil
+}
+
+// reset drops every enrollment.
+func (s *totpStore) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enrollments = make(map[string]*totpEnrollment)
+}
+
+// enabled reports whether the user has a confirmed enrollment.
+func (s *totpStore) enabled(userID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.enrollments[userID]
+	return ok && e.Confirmed
+}
+
+// verify validates code for the given user and marks its time step as used.
+// When confirm is true an unconfirmed enrollment, or the pending secret of a
+// confirmed one, is accepted and confirmed.
+func (s *totpStore) verify(userID, code string, confirm bool, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.enrollments[userID]
+	if !ok || (!e.Confirmed && !confirm) {
+		return errTOTPNotEnrolled
+	}
+
+	if confirm && e.Pending != nil {
+		// the steps used with the previous secret don't apply to the new one.
+		step, ok := totp.Validate(e.Pending, code, now, s.skew)
+		if !ok {
+			return errTOTPInvalidCode
+		}
+		e.Secret, e.Pending, e.LastStep = e.Pending, nil, step
+		return nil
+	}
+
+	if err := s.accept(e, e.Secret, code, now); err != nil {
+		return err
+	}
+	e.Confirmed = true
+	return nil
+}
+
+// accept validates code for secret and marks its time step as used, s.mu
+// must be held.
+func (s *totpStore) accept(e *totpEnrollment, secret []byte, code string, now time.Time) error {
+	step, ok := totp.Validate(secret, code, now, s.skew)
+	if !ok {
+		return errTOTPInvalidCode
+	}
+	if step <= e.LastStep {
+		return errTOTPCodeReused
+	}
+	e.LastStep = step
+	return nil
+}
+
+func enrollTOTP(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	sess, err := checkSession(ctx, r)
+	if err != nil {
+		return &response{
+			Data:   err.Error(),
+			Status: http.StatusUnauthorized,
+		}, nil
+	}
+
+	// the body is only needed to replace a confirmed enrollment.
+	var payload struct {
+		TOTPCode string `json:"totp_code"`
+	}
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return &response{
+				Data:   err.Error(),
+				Status: http.StatusBadRequest,
+			}, nil
+		}
+	}
+
+	secret, err := ctx.totp.enroll(sess.UserID, payload.TOTPCode, ctx.now())
+	switch err {
+	case nil:
+	case errTOTPEnrolled:
+		return &response{
+			Data:   err.Error(),
+			Status: http.StatusConflict,
+		}, nil
+	case errTOTPInvalidCode, errTOTPCodeReused:
+		return &response{
+			Data:   err.Error(),
+			Status: http.StatusBadRequest,
+		}, nil
+	default:
+		return nil, err
+	}
+
+	return &response{
+		Data: struct {
+			Secret string `json:"secret"`
+			URI    string `json:"uri"`
+		}{
+			Secret: totp.EncodeSecret(secret),
+			URI:    totp.URI(totpIssuer, sess.Email, secret),
+		},
+		Status: http.StatusCreated,
+	}, nil
+}
+
+func confirmTOTP(ctx *Context, w http.ResponseWriter, r *http.Request) (*response, error) {
+	sess, err := checkSession(ctx, r)
+	if err != nil {
+		return &response{
+			Data:   err.Error(),
+			Status: http.StatusUnauthorized,
+		}, nil
+	}
+
+	var payload struct {
+		TOTPCode string `json:"totp_code"`
+	}
+
+	defer r.Body.Close()
+	if err := unmarshalJSON(r.Body, &payload); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.totp.verify(sess.UserID, payload.TOTPCode, true, ctx.now()); err != nil {
+		return &response{
+			Data:   err.Error(),
+			Status: http.StatusBadRequest,
+		}, nil
+	}
+
+	return &response{
+		Data:   "totp enrolled",
+		Status: http.StatusOK,
+	}, nil
+}
@@ -0,0 +1,290 @@
+// Package fixtures generates synthetic cardholders for demo and load-test
+// environments, to be used as fakeprovider.Options.Seed.
+//
+// Names and emails follow the given locale, cards have realistic ages,
+// statuses and balances and, optionally, a history of loads and purchases.
+// The output only depends on Options, the same seed always generates the same
+// cardholders.
+package fixtures
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rodrwan/fakeproviders/fakeprovider"
+)
+
+// DefaultLocale is used when Options.Locale is empty.
+const DefaultLocale = "en-US"
+
+// Options configures Generate.
+type Options struct {
+	// Count is the number of cardholders.
+	Count int
+	// Locale selects the names, one of Locales.
+	Locale string
+	// Seed makes the output reproducible.
+	Seed int64
+	// Now is the time the cards ages are relative to, defaults to the system
+	// time. It must be set for the output to be reproducible.
+	Now time.Time
+	// MaxTransactions is the maximum number of transactions of each card,
+	// zero generates no history.
+	MaxTransactions int
+}
+
+// Locales returns the supported locales.
+func Locales() []string {
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cardValidity is how long cards are valid after they are issued.
+const cardValidity = 5
+
+// Generate returns opts.Count cardholders with unique emails.
+func Generate(opts Options) ([]fakeprovider.Cardholder, error) {
+	if opts.Count < 0 {
+		return nil, errors.New("fixtures: negative count")
+	}
+	if opts.MaxTransactions < 0 {
+		return nil, errors.New("fixtures: negative number of transactions")
+	}
+	if opts.Locale == "" {
+		opts.Locale = DefaultLocale
+	}
+	loc, ok := locales[opts.Locale]
+	if !ok {
+		return nil, fmt.Errorf("fixtures: unknown locale %q, use one of %s", opts.Locale, strings.Join(Locales(), ", "))
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	g := &generator{
+		rnd:    rand.New(rand.NewSource(opts.Seed)),
+		loc:    loc,
+		now:    opts.Now.UTC(),
+		emails: make(map[string]bool, opts.Count),
+	}
+	cardholders := make([]fakeprovider.Cardholder, opts.Count)
+	for i := range cardholders {
+		cardholders[i] = g.cardholder(opts.MaxTransactions)
+	}
+	return cardholders, nil
+}
+
+type generator struct {
+	rnd    *rand.Rand
+	loc    *locale
+	now    time.Time
+	emails map[string]bool
+}
+
+func (g *generator) pick(items []string) string {
+	return items[g.rnd.Intn(len(items))]
+}
+
+func (g *generator) cardholder(maxTransactions int) fakeprovider.Cardholder {
+	first := g.pick(g.loc.firstNames)
+	last := g.pick(g.loc.lastNames)
+	if g.loc.compoundLastName {
+		second := g.pick(g.loc.lastNames)
+		for second == last {
+			second = g.pick(g.loc.lastNames)
+		}
+		last += " " + second
+	}
+
+	id, _ := uuid.NewRandomFromReader(g.rnd)
+	ch := fakeprovider.Cardholder{
+		CardID:      id.String(),
+		ReferenceID: g.digits(8),
+		CardNumber:  g.cardNumber(),
+		FirstName:   first,
+		LastName:    last,
+		Email:       g.email(first, last),
+		Status:      g.status(),
+	}
+
+	// expired cards were issued more than cardValidity years ago, the others
+	// within the last four years.
+	var age time.Duration
+	if ch.Status == "expired" {
+		age = years(cardValidity) + g.duration(years(1))
+	} else {
+		age = g.duration(years(cardValidity - 1))
+	}
+	ch.CreatedAt = g.now.Add(-age).Truncate(time.Second)
+	ch.ExpDate = ch.CreatedAt.AddDate(cardValidity, 0, 0).Format("01/06")
+
+	if maxTransactions > 0 {
+		ch.Transactions = g.transactions(ch.CreatedAt, g.rnd.Intn(maxTransactions+1))
+		for _, t := range ch.Transactions {
+			ch.Balance += t.Amount
+		}
+	} else {
+		ch.Balance = g.balance()
+	}
+	return ch
+}
+
+func years(n int) time.Duration {
+	return time.Duration(n) * 365 * 24 * time.Hour
+}
+
+// duration returns a random duration in [0, max).
+func (g *generator) duration(max time.Duration) time.Duration {
+	return time.Duration(g.rnd.Int63n(int64(max)))
+}
+
+func (g *generator) digits(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('0' + g.rnd.Intn(10))
+	}
+	return string(b)
+}
+
+// cardNumber returns a 16 digits number in the range of the fake provider,
+// with a valid Luhn check digit.
+func (g *generator) cardNumber() string {
+	pan := "5432" + g.digits(11)
+	return pan + string(byte('0'+luhn(pan)))
+}
+
+// luhn returns the check digit of number.
+func luhn(number string) int {
+	sum := 0
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if (len(number)-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
+
+// statusWeights are the share of each card status, in percent.
+var statusWeights = []struct {
+	status string
+	weight int
+}{
+	{"active", 85},
+	{"blocked", 7},
+	{"canceled", 5},
+	{"expired", 3},
+}
+
+func (g *generator) status() string {
+	n := g.rnd.Intn(100)
+	for _, s := range statusWeights {
+		if n < s.weight {
+			return s.status
+		}
+		n -= s.weight
+	}
+	return "active"
+}
+
+// balance returns a balance skewed towards small amounts, a fifth of the
+// cards being empty.
+func (g *generator) balance() int64 {
+	if g.rnd.Intn(5) == 0 {
+		return 0
+	}
+	f := g.rnd.Float64()
+	return int64(f*f*500000) / 10 * 10
+}
+
+// maxPurchase is the largest amount of a generated purchase.
+const maxPurchase = 60000
+
+// transactions returns n transactions between issued and now, oldest first.
+// The first one is always a load and purchases never exceed the balance.
+func (g *generator) transactions(issued time.Time, n int) []fakeprovider.Transaction {
+	if n == 0 {
+		return nil
+	}
+
+	span := g.now.Sub(issued)
+	times := make([]time.Time, n)
+	for i := range times {
+		times[i] = issued.Add(g.duration(span)).Truncate(time.Second)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	var balance int64
+	transactions := make([]fakeprovider.Transaction, n)
+	for i, at := range times {
+		t := fakeprovider.Transaction{At: at}
+		if balance < 1000 || g.rnd.Intn(4) == 0 {
+			t.Amount = int64(5+g.rnd.Intn(196)) * 1000
+			t.Description = "Load"
+		} else {
+			max := balance
+			if max > maxPurchase {
+				max = maxPurchase
+			}
+			t.Amount = -(1 + g.rnd.Int63n(max/10)) * 10
+			t.Description = g.pick(g.loc.merchants)
+		}
+		balance += t.Amount
+		transactions[i] = t
+	}
+	return transactions
+}
+
+// email returns an unused email for the given names.
+func (g *generator) email(first, last string) string {
+	first = emailPart(first)
+	lastNames := strings.Fields(emailPart(last))
+	last = lastNames[0]
+
+	var local string
+	switch g.rnd.Intn(4) {
+	case 0:
+		local = first + "." + last
+	case 1:
+		local = first[:1] + last
+	case 2:
+		local = first + "_" + last
+	default:
+		local = first + last + g.digits(2)
+	}
+	domain := g.pick(g.loc.domains)
+
+	email := local + "@" + domain
+	for i := 2; g.emails[email]; i++ {
+		email = fmt.Sprintf("%s%d@%s", local, i, domain)
+	}
+	g.emails[email] = true
+	return email
+}
+
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "õ", "o", "ö", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ñ", "n", "ç", "c",
+)
+
+// emailPart lowercases a name and strips its accents.
+func emailPart(name string) string {
+	return accents.Replace(strings.ToLower(name))
+}
@@ -0,0 +1,115 @@
+package fixtures
+
+// locale holds the names used to generate the cardholders of a country.
+type locale struct {
+	firstNames []string
+	lastNames  []string
+	// compoundLastName joins two last names, paternal and maternal, as
+	// usual in Spanish speaking countries.
+	compoundLastName bool
+	merchants        []string
+	domains          []string
+}
+
+// exampleDomains are reserved for documentation, generated emails never
+// reach anybody.
+var exampleDomains = []string{"example.com", "example.org", "example.net"}
+
+var locales = map[string]*locale{
+	"en-US": {
+		firstNames: []string{
+			"Olivia", "Emma", "Charlotte", "Amelia", "Sophia", "Mia", "Isabella",
+			"Ava", "Evelyn", "Harper", "Abigail", "Emily", "Madison", "Grace",
+			"Liam", "Noah", "Oliver", "James", "Elijah", "William", "Henry",
+			"Lucas", "Benjamin", "Theodore", "Jack", "Michael", "Daniel", "Ethan",
+		},
+		lastNames: []string{
+			"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller",
+			"Davis", "Rodriguez", "Martinez", "Wilson", "Anderson", "Taylor",
+			"Thomas", "Moore", "Jackson", "Martin", "Lee", "Thompson", "White",
+			"Harris", "Clark", "Lewis", "Robinson", "Walker", "Young", "Allen",
+		},
+		merchants: []string{
+			"Walmart", "Target", "Costco", "Starbucks", "Shell", "Amazon",
+			"Walgreens", "Home Depot", "Uber", "Netflix",
+		},
+		domains: exampleDomains,
+	},
+	"es-CL": {
+		firstNames: []string{
+			"Sofía", "Isidora", "Agustina", "Florencia", "Catalina", "Josefa",
+			"Emilia", "Valentina", "Antonella", "Martina", "Fernanda", "Constanza",
+			"Javiera", "Camila", "Francisca", "Benjamín", "Vicente", "Martín",
+			"Matías", "Joaquín", "Agustín", "Tomás", "Cristóbal", "Maximiliano",
+			"Sebastián", "Diego", "Felipe", "Ignacio", "Nicolás", "José",
+		},
+		lastNames: []string{
+			"González", "Muñoz", "Rojas", "Díaz", "Pérez", "Soto", "Contreras",
+			"Silva", "Martínez", "Sepúlveda", "Morales", "Rodríguez", "López",
+			"Araya", "Fuentes", "Hernández", "Torres", "Espinoza", "Flores",
+			"Castillo", "Valenzuela", "Ramírez", "Reyes", "Gutiérrez", "Castro",
+			"Vargas", "Álvarez", "Vásquez", "Tapia", "Fernández",
+		},
+		compoundLastName: true,
+		merchants: []string{
+			"Líder", "Jumbo", "Unimarc", "Falabella", "Copec", "Farmacias Ahumada",
+			"Cruz Verde", "Sodimac", "Ripley", "Metro de Santiago",
+		},
+		domains: exampleDomains,
+	},
+	"es-ES": {
+		firstNames: []string{
+			"Lucía", "Sofía", "Martina", "María", "Julia", "Paula", "Valeria",
+			"Emma", "Daniela", "Carla", "Alba", "Noa", "Hugo", "Mateo", "Martín",
+			"Lucas", "Leo", "Daniel", "Alejandro", "Manuel", "Pablo", "Álvaro",
+			"Adrián", "Enzo", "Mario", "Diego",
+		},
+		lastNames: []string{
+			"García", "Rodríguez", "González", "Fernández", "López", "Martínez",
+			"Sánchez", "Pérez", "Gómez", "Martín", "Jiménez", "Ruiz", "Hernández",
+			"Díaz", "Moreno", "Muñoz", "Álvarez", "Romero", "Alonso", "Gutiérrez",
+			"Navarro", "Torres", "Domínguez", "Vázquez", "Ramos", "Lozano",
+		},
+		compoundLastName: true,
+		merchants: []string{
+			"Mercadona", "Carrefour", "El Corte Inglés", "Lidl", "Repsol", "Zara",
+			"Dia", "Renfe", "Cepsa", "Eroski",
+		},
+		domains: exampleDomains,
+	},
+	"fr-FR": {
+		firstNames: []string{
+			"Louise", "Ambre", "Jade", "Emma", "Rose", "Alice", "Chloé", "Léa",
+			"Louane", "Inès", "Anna", "Gabriel", "Léo", "Raphaël", "Arthur",
+			"Louis", "Jules", "Adam", "Maël", "Lucas", "Hugo", "Noé", "Théo",
+		},
+		lastNames: []string{
+			"Martin", "Bernard", "Thomas", "Petit", "Robert", "Richard", "Durand",
+			"Dubois", "Moreau", "Laurent", "Simon", "Michel", "Lefèvre", "Leroy",
+			"Roux", "David", "Bertrand", "Morel", "Fournier", "Girard", "Vidal",
+		},
+		merchants: []string{
+			"Carrefour", "Leclerc", "Auchan", "Monoprix", "Fnac", "TotalEnergies",
+			"SNCF", "Decathlon", "Boulangerie Paul", "Franprix",
+		},
+		domains: exampleDomains,
+	},
+	"pt-BR": {
+		firstNames: []string{
+			"Helena", "Alice", "Laura", "Maria", "Valentina", "Heloísa", "Cecília",
+			"Júlia", "Beatriz", "Manuela", "Miguel", "Arthur", "Gael", "Heitor",
+			"Théo", "Davi", "Gabriel", "Bernardo", "Samuel", "João", "Noel",
+		},
+		lastNames: []string{
+			"Silva", "Santos", "Oliveira", "Souza", "Rodrigues", "Ferreira",
+			"Alves", "Pereira", "Lima", "Gomes", "Costa", "Ribeiro", "Martins",
+			"Carvalho", "Almeida", "Lopes", "Soares", "Fernandes", "Vieira",
+			"Barbosa", "Peixoto",
+		},
+		merchants: []string{
+			"Pão de Açúcar", "Carrefour", "Magazine Luiza", "Drogasil", "Petrobras",
+			"Americanas", "iFood", "Renner", "Extra", "Riachuelo",
+		},
+		domains: exampleDomains,
+	},
+}
@@ -4,10 +4,17 @@ go 1.13
 
 require (
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
-	github.com/google/uuid v1.1.1
+	github.com/getkin/kin-openapi v0.76.0
+	github.com/ghodss/yaml v1.0.0
+	github.com/google/uuid v1.1.2
 	github.com/julienschmidt/httprouter v1.3.0
-	github.com/pkg/errors v0.8.1 // indirect
+	github.com/prometheus/client_golang v1.7.1
 	github.com/rs/cors v1.7.0
 	github.com/sirupsen/logrus v1.4.2
-	github.com/ulule/limiter v2.2.2+incompatible
+	go.opentelemetry.io/otel v1.3.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.3.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.3.0
+	go.opentelemetry.io/otel/sdk v1.3.0
+	go.opentelemetry.io/otel/trace v1.3.0
+	gopkg.in/square/go-jose.v2 v2.5.1
 )
@@ -0,0 +1,260 @@
+package iso8583
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Message is an ISO 8583 message.
+type Message struct {
+	MTI string
+	// Fields holds the present fields by number, the binary ones as hex
+	// digits.
+	Fields map[int]string
+}
+
+// NewMessage returns a message without fields.
+func NewMessage(mti string) *Message {
+	return &Message{MTI: mti, Fields: make(map[int]string)}
+}
+
+// Get returns field n, empty when absent.
+func (m *Message) Get(n int) string {
+	return m.Fields[n]
+}
+
+// Has reports whether field n is present.
+func (m *Message) Has(n int) bool {
+	_, ok := m.Fields[n]
+	return ok
+}
+
+// Set sets field n.
+func (m *Message) Set(n int, v string) {
+	m.Fields[n] = v
+}
+
+// ResponseMTI returns the MTI of the response to a request, 0110 for 0100.
+func ResponseMTI(mti string) string {
+	if !validMTI(mti) || (mti[2]-'0')%2 != 0 {
+		return mti
+	}
+	return mti[:2] + string(mti[2]+1) + mti[3:]
+}
+
+func validMTI(mti string) bool {
+	if len(mti) != 4 {
+		return false
+	}
+	for _, c := range mti {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Pack encodes m, without its frame.
+func (s *Spec) Pack(m *Message) ([]byte, error) {
+	if !validMTI(m.MTI) {
+		return nil, fmt.Errorf("invalid MTI %q", m.MTI)
+	}
+	numbers := make([]int, 0, len(m.Fields))
+	size := 8
+	for n := range m.Fields {
+		if _, ok := s.Fields[n]; !ok {
+			return nil, fmt.Errorf("field %d isn't in the spec", n)
+		}
+		if n > 64 {
+			size = 16
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	bitmap := make([]byte, size)
+	if size == 16 {
+		bitmap[0] |= 0x80
+	}
+	for _, n := range numbers {
+		bitmap[(n-1)/8] |= 0x80 >> uint((n-1)%8)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(m.MTI)
+	if s.Bitmap == BitmapHex {
+		buf.WriteString(strings.ToUpper(hex.EncodeToString(bitmap)))
+	} else {
+		buf.Write(bitmap)
+	}
+	for _, n := range numbers {
+		f := s.Fields[n]
+		v := []byte(m.Fields[n])
+		if f.Encoding == Binary {
+			var err error
+			if v, err = hex.DecodeString(m.Fields[n]); err != nil {
+				return nil, fmt.Errorf("field %d: binary values are written as hex digits", n)
+			}
+		}
+		switch {
+		case f.Length == Fixed && len(v) != f.Max:
+			return nil, fmt.Errorf("field %d: length %d, want %d", n, len(v), f.Max)
+		case len(v) > f.Max:
+			return nil, fmt.Errorf("field %d: length %d, want %d at most", n, len(v), f.Max)
+		case f.Length == LLVar:
+			fmt.Fprintf(&buf, "%02d", len(v))
+		case f.Length == LLLVar:
+			fmt.Fprintf(&buf, "%03d", len(v))
+		}
+		buf.Write(v)
+	}
+	return buf.Bytes(), nil
+}
+
+// Unpack decodes a message, without its frame.
+func (s *Spec) Unpack(b []byte) (*Message, error) {
+	r := bytes.NewReader(b)
+	mti, err := next(r, 4)
+	if err != nil || !validMTI(string(mti)) {
+		return nil, errors.New("invalid MTI")
+	}
+	m := NewMessage(string(mti))
+
+	bitmap, err := s.readBitmap(r)
+	if err != nil {
+		return nil, err
+	}
+	if bitmap[0]&0x80 != 0 {
+		secondary, err := s.readBitmap(r)
+		if err != nil {
+			return nil, err
+		}
+		bitmap = append(bitmap, secondary...)
+	}
+
+	for n := 2; n <= len(bitmap)*8; n++ {
+		if bitmap[(n-1)/8]&(0x80>>uint((n-1)%8)) == 0 {
+			continue
+		}
+		f, ok := s.Fields[n]
+		if !ok {
+			return nil, fmt.Errorf("field %d isn't in the spec", n)
+		}
+		length := f.Max
+		switch f.Length {
+		case LLVar:
+			length, err = readLength(r, 2)
+		case LLLVar:
+			length, err = readLength(r, 3)
+		}
+		if err != nil || length < 0 || length > f.Max {
+			return nil, fmt.Errorf("field %d: invalid length", n)
+		}
+		v, err := next(r, length)
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %v", n, err)
+		}
+		if f.Encoding == Binary {
+			m.Fields[n] = strings.ToUpper(hex.EncodeToString(v))
+		} else {
+			m.Fields[n] = string(v)
+		}
+	}
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("%d trailing bytes", r.Len())
+	}
+	return m, nil
+}
+
+func (s *Spec) readBitmap(r *bytes.Reader) ([]byte, error) {
+	if s.Bitmap != BitmapHex {
+		b, err := next(r, 8)
+		if err != nil {
+			return nil, errors.New("invalid bitmap")
+		}
+		return b, nil
+	}
+	digits, err := next(r, 16)
+	if err != nil {
+		return nil, errors.New("invalid bitmap")
+	}
+	b, err := hex.DecodeString(string(digits))
+	if err != nil {
+		return nil, errors.New("invalid bitmap")
+	}
+	return b, nil
+}
+
+func next(r *bytes.Reader, n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b, nil
+}
+
+func readLength(r *bytes.Reader, digits int) (int, error) {
+	b, err := next(r, digits)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(b))
+}
+
+// maxFrame is the largest message a frame can hold.
+func (s *Spec) maxFrame() int {
+	if s.Frame == FrameASCII4 {
+		return 9999
+	}
+	return 65535
+}
+
+// ReadFrame reads the next message of r, without its frame.
+func (s *Spec) ReadFrame(r io.Reader) ([]byte, error) {
+	var length int
+	if s.Frame == FrameASCII4 {
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(string(b))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid frame length %q", b)
+		}
+		length = n
+	} else {
+		var n uint16
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, err
+		}
+		length = int(n)
+	}
+
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// WriteFrame writes the message b to w in a frame.
+func (s *Spec) WriteFrame(w io.Writer, b []byte) error {
+	if len(b) > s.maxFrame() {
+		return fmt.Errorf("message of %d bytes too long for its frame", len(b))
+	}
+	header := make([]byte, 2)
+	if s.Frame == FrameASCII4 {
+		header = []byte(fmt.Sprintf("%04d", len(b)))
+	} else {
+		binary.BigEndian.PutUint16(header, uint16(len(b)))
+	}
+	_, err := w.Write(append(header, b...))
+	return err
+}
@@ -0,0 +1,179 @@
+package iso8583
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func authorizationRequest() *Message {
+	m := NewMessage("0100")
+	m.Set(2, "5432123412341234")
+	m.Set(3, "000000")
+	m.Set(4, "000000001000")
+	m.Set(11, "000042")
+	m.Set(48, "additional data")
+	m.Set(52, "0123456789ABCDEF")
+	return m
+}
+
+func TestPackUnpack(t *testing.T) {
+	for _, bitmap := range []string{BitmapBinary, BitmapHex} {
+		spec := DefaultSpec()
+		spec.Bitmap = bitmap
+		m := authorizationRequest()
+
+		b, err := spec.Pack(m)
+		if err != nil {
+			t.Fatalf("%s: %v", bitmap, err)
+		}
+		got, err := spec.Unpack(b)
+		if err != nil {
+			t.Fatalf("%s: %v", bitmap, err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("%s: Unpack = %+v, want %+v", bitmap, got, m)
+		}
+	}
+}
+
+func TestPackLayout(t *testing.T) {
+	spec := DefaultSpec()
+	spec.Bitmap = BitmapHex
+	m := NewMessage("0800")
+	m.Set(2, "4111")
+	m.Set(3, "990000")
+
+	b, err := spec.Pack(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fields 2 and 3 set the second and third bits of the bitmap.
+	if want := "0800" + "6000000000000000" + "044111" + "990000"; string(b) != want {
+		t.Errorf("Pack = %s, want %s", b, want)
+	}
+}
+
+func TestPackSecondaryBitmap(t *testing.T) {
+	spec := DefaultSpec()
+	m := NewMessage("0800")
+	m.Set(70, "301")
+
+	b, err := spec.Pack(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 4+16+3 || b[4]&0x80 == 0 {
+		t.Fatalf("Pack = %x, want a secondary bitmap", b)
+	}
+	got, err := spec.Unpack(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("Unpack = %+v, want %+v", got, m)
+	}
+}
+
+func TestPackErrors(t *testing.T) {
+	spec := DefaultSpec()
+	tests := map[string]*Message{
+		"invalid MTI":       NewMessage("01"),
+		"unknown field":     {MTI: "0100", Fields: map[int]string{5: "1"}},
+		"fixed length":      {MTI: "0100", Fields: map[int]string{3: "1"}},
+		"too long":          {MTI: "0100", Fields: map[int]string{2: "12345678901234567890"}},
+		"binary not in hex": {MTI: "0100", Fields: map[int]string{52: "not hex!"}},
+	}
+	for name, m := range tests {
+		if _, err := spec.Pack(m); err == nil {
+			t.Errorf("%s: Pack succeeded", name)
+		}
+	}
+}
+
+func TestUnpackErrors(t *testing.T) {
+	spec := DefaultSpec()
+	b, err := spec.Pack(authorizationRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string][]byte{
+		"empty":          nil,
+		"invalid MTI":    append([]byte("01X0"), b[4:]...),
+		"truncated":      b[:len(b)-1],
+		"trailing bytes": append(append([]byte{}, b...), '0'),
+	}
+	for name, data := range tests {
+		if _, err := spec.Unpack(data); err == nil {
+			t.Errorf("%s: Unpack succeeded", name)
+		}
+	}
+}
+
+func TestFrames(t *testing.T) {
+	for _, frame := range []string{FrameBinary2, FrameASCII4} {
+		spec := DefaultSpec()
+		spec.Frame = frame
+
+		var buf bytes.Buffer
+		for _, msg := range []string{"first", "second"} {
+			if err := spec.WriteFrame(&buf, []byte(msg)); err != nil {
+				t.Fatalf("%s: %v", frame, err)
+			}
+		}
+		for _, want := range []string{"first", "second"} {
+			got, err := spec.ReadFrame(&buf)
+			if err != nil {
+				t.Fatalf("%s: %v", frame, err)
+			}
+			if string(got) != want {
+				t.Errorf("%s: ReadFrame = %q, want %q", frame, got, want)
+			}
+		}
+	}
+
+	spec := DefaultSpec()
+	spec.Frame = FrameASCII4
+	if err := spec.WriteFrame(&bytes.Buffer{}, make([]byte, 10000)); err == nil {
+		t.Error("wrote a message too long for its frame")
+	}
+}
+
+func TestResponseMTI(t *testing.T) {
+	tests := map[string]string{
+		"0100": "0110",
+		"0200": "0210",
+		"0800": "0810",
+		"0110": "0110",
+		"01":   "01",
+	}
+	for mti, want := range tests {
+		if got := ResponseMTI(mti); got != want {
+			t.Errorf("ResponseMTI(%s) = %s, want %s", mti, got, want)
+		}
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	spec, err := ParseSpec([]byte("frame: ascii4\nfields:\n  2: {length: llvar, max: 12}\n  62: {length: lllvar, max: 500}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Frame != FrameASCII4 || spec.Bitmap != BitmapBinary {
+		t.Errorf("frame, bitmap = %s, %s", spec.Frame, spec.Bitmap)
+	}
+	if spec.Fields[2].Max != 12 || spec.Fields[62].Length != LLLVar || spec.Fields[4].Max != 12 {
+		t.Errorf("fields = %v", spec.Fields)
+	}
+
+	for _, data := range []string{
+		"frame: tcp",
+		"fields:\n  1: {length: fixed, max: 8}",
+		"fields:\n  62: {length: llvar, max: 100}",
+		"fields:\n  62: {length: var, max: 10}",
+	} {
+		if _, err := ParseSpec([]byte(data)); err == nil {
+			t.Errorf("ParseSpec(%q) succeeded", data)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Package iso8583 packs and unpacks ISO 8583 messages described by a Spec,
+// and frames them on stream connections.
+//
+// A message is a 4 digit MTI, the primary bitmap, the secondary bitmap when
+// a field above 64 is present, and the present fields in increasing order.
+// Field 1 is the secondary bitmap, it isn't listed in a Spec.
+package iso8583
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+)
+
+// Length types of the fields, the variable lengths are prefixed by their
+// length as 2 or 3 ASCII digits.
+const (
+	Fixed  = "fixed"
+	LLVar  = "llvar"
+	LLLVar = "lllvar"
+)
+
+// Encodings of the fields. The values of the binary fields are written as
+// hex digits in a Message.
+const (
+	ASCII  = "ascii"
+	Binary = "binary"
+)
+
+// Frames of the messages on a connection: a 2 byte big endian length or a
+// 4 ASCII digits length, followed by the message.
+const (
+	FrameBinary2 = "binary2"
+	FrameASCII4  = "ascii4"
+)
+
+// Encodings of the bitmaps: 8 bytes or 16 hex digits each.
+const (
+	BitmapBinary = "binary"
+	BitmapHex    = "hex"
+)
+
+// Field describes a data element.
+type Field struct {
+	Name string `json:"name,omitempty"`
+	// Length is fixed, llvar or lllvar.
+	Length string `json:"length"`
+	// Max is the length of the fixed fields and the maximum length of the
+	// variable ones, in characters, or bytes for binary fields.
+	Max int `json:"max"`
+	// Encoding is ascii, the default, or binary.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Spec describes the messages exchanged with a peer.
+type Spec struct {
+	// Frame is binary2, the default, or ascii4.
+	Frame string `json:"frame,omitempty"`
+	// Bitmap is binary, the default, or hex.
+	Bitmap string `json:"bitmap,omitempty"`
+	// Fields are the data elements 2 to 128 by number, a message holding
+	// any other field is rejected.
+	Fields map[int]Field `json:"fields"`
+}
+
+// DefaultSpec returns the fields of ISO 8583:1987 used by authorization,
+// financial, reversal and network management messages, all ASCII encoded.
+func DefaultSpec() *Spec {
+	return &Spec{
+		Frame:  FrameBinary2,
+		Bitmap: BitmapBinary,
+		Fields: map[int]Field{
+			2:   {Name: "Primary account number", Length: LLVar, Max: 19},
+			3:   {Name: "Processing code", Length: Fixed, Max: 6},
+			4:   {Name: "Amount, transaction", Length: Fixed, Max: 12},
+			7:   {Name: "Transmission date and time", Length: Fixed, Max: 10},
+			11:  {Name: "System trace audit number", Length: Fixed, Max: 6},
+			12:  {Name: "Time, local transaction", Length: Fixed, Max: 6},
+			13:  {Name: "Date, local transaction", Length: Fixed, Max: 4},
+			14:  {Name: "Date, expiration", Length: Fixed, Max: 4},
+			18:  {Name: "Merchant type", Length: Fixed, Max: 4},
+			22:  {Name: "POS entry mode", Length: Fixed, Max: 3},
+			25:  {Name: "POS condition code", Length: Fixed, Max: 2},
+			32:  {Name: "Acquiring institution identification code", Length: LLVar, Max: 11},
+			35:  {Name: "Track 2 data", Length: LLVar, Max: 37},
+			37:  {Name: "Retrieval reference number", Length: Fixed, Max: 12},
+			38:  {Name: "Authorization identification response", Length: Fixed, Max: 6},
+			39:  {Name: "Response code", Length: Fixed, Max: 2},
+			41:  {Name: "Card acceptor terminal identification", Length: Fixed, Max: 8},
+			42:  {Name: "Card acceptor identification code", Length: Fixed, Max: 15},
+			43:  {Name: "Card acceptor name/location", Length: Fixed, Max: 40},
+			48:  {Name: "Additional data, private", Length: LLLVar, Max: 999},
+			49:  {Name: "Currency code, transaction", Length: Fixed, Max: 3},
+			52:  {Name: "PIN data", Length: Fixed, Max: 8, Encoding: Binary},
+			54:  {Name: "Additional amounts", Length: LLLVar, Max: 120},
+			64:  {Name: "Message authentication code", Length: Fixed, Max: 8, Encoding: Binary},
+			70:  {Name: "Network management information code", Length: Fixed, Max: 3},
+			90:  {Name: "Original data elements", Length: Fixed, Max: 42},
+			95:  {Name: "Replacement amounts", Length: Fixed, Max: 42},
+			128: {Name: "Message authentication code", Length: Fixed, Max: 8, Encoding: Binary},
+		},
+	}
+}
+
+// ParseSpec parses a YAML or JSON spec. Its fields replace or add to the
+// fields of DefaultSpec, as do its frame and bitmap when set.
+func ParseSpec(data []byte) (*Spec, error) {
+	var s Spec
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	spec := DefaultSpec()
+	if s.Frame != "" {
+		spec.Frame = s.Frame
+	}
+	if s.Bitmap != "" {
+		spec.Bitmap = s.Bitmap
+	}
+	for n, f := range s.Fields {
+		spec.Fields[n] = f
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// LoadSpec reads a YAML or JSON spec, see ParseSpec.
+func LoadSpec(path string) (*Spec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSpec(data)
+}
+
+// Validate checks the frame, the bitmap and the fields of s.
+func (s *Spec) Validate() error {
+	switch s.Frame {
+	case "", FrameBinary2, FrameASCII4:
+	default:
+		return fmt.Errorf("invalid frame %q, use binary2 or ascii4", s.Frame)
+	}
+	switch s.Bitmap {
+	case "", BitmapBinary, BitmapHex:
+	default:
+		return fmt.Errorf("invalid bitmap %q, use binary or hex", s.Bitmap)
+	}
+	for n, f := range s.Fields {
+		if n < 2 || n > 128 {
+			return fmt.Errorf("field %d: only fields 2 to 128 can be described", n)
+		}
+		switch f.Encoding {
+		case "", ASCII, Binary:
+		default:
+			return fmt.Errorf("field %d: invalid encoding %q, use ascii or binary", n, f.Encoding)
+		}
+		max := 0
+		switch f.Length {
+		case Fixed:
+			max = 9999
+		case LLVar:
+			max = 99
+		case LLLVar:
+			max = 999
+		default:
+			return fmt.Errorf("field %d: invalid length %q, use fixed, llvar or lllvar", n, f.Length)
+		}
+		if f.Max <= 0 || f.Max > max {
+			return fmt.Errorf("field %d: max must be between 1 and %d", n, max)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/rodrwan/fakeproviders/requestid"
+	"github.com/sirupsen/logrus"
+)
+
+type entryContextKey struct{}
+
+// NewContext returns a copy of ctx carrying the given log entry.
+func NewContext(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, entryContextKey{}, entry)
+}
+
+// FromContext returns the log entry of the request handled with ctx. When the
+// request didn't go through Logger.Handle an entry of the standard logger is
+// returned, tagged with the request id if there is one.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(entryContextKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+
+	entry := logrus.NewEntry(logrus.StandardLogger())
+	if id := requestid.FromContext(ctx); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+	return entry
+}
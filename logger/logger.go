@@ -1,36 +1,121 @@
 package logger
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
+	"github.com/rodrwan/fakeproviders/requestid"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // LoggerDefaultDateFormat is the format used for date by the default Logger instance.
 var LoggerDefaultDateFormat = time.RFC3339
 
+// DefaultBodyLimit is the default maximum number of body bytes captured.
+const DefaultBodyLimit = 4096
+
+// Supported output formats.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
 // Logger provides a middleware to log an incoming request.
 type Logger struct {
 	name   string
 	logger *logrus.Logger
 	before func(*logrus.Entry, *http.Request, string) *logrus.Entry
 	after  func(*logrus.Entry, *responseWriter, time.Time, string) *logrus.Entry
+
+	// bodyLimit is the maximum number of body bytes captured, zero disables
+	// body logging.
+	bodyLimit int
+	redactor  *Redactor
+
+	trustedProxies []*net.IPNet
+	observers      []Observer
+}
+
+// Observer is notified of every handled request, e.g. to record metrics.
+type Observer func(r *http.Request, status int, written int64, took time.Duration)
+
+// Option configures a Logger.
+type Option func(*Logger)
+
+// WithBodies enables logging of request headers and of request and response
+// bodies, capturing at most limit bytes of each body.
+func WithBodies(limit int) Option {
+	return func(l *Logger) {
+		l.bodyLimit = limit
+	}
+}
+
+// WithRedactor sets the Redactor applied to logged headers and bodies.
+func WithRedactor(rd *Redactor) Option {
+	return func(l *Logger) {
+		l.redactor = rd
+	}
+}
+
+// WithLevel sets the minimum level of the logged entries.
+func WithLevel(level logrus.Level) Option {
+	return func(l *Logger) {
+		l.logger.SetLevel(level)
+	}
+}
+
+// WithFormat sets the output format, either "json" (the default) or "text".
+func WithFormat(format string) Option {
+	return func(l *Logger) {
+		if format == FormatText {
+			l.logger.Formatter = &logrus.TextFormatter{
+				FullTimestamp:   true,
+				TimestampFormat: LoggerDefaultDateFormat,
+			}
+			return
+		}
+		l.logger.Formatter = &logrus.JSONFormatter{}
+	}
+}
+
+// WithTrustedProxies sets the proxies whose forwarding headers are used to
+// find out the client IP.
+func WithTrustedProxies(nets []*net.IPNet) Option {
+	return func(l *Logger) {
+		l.trustedProxies = nets
+	}
+}
+
+// WithObserver adds an Observer notified once a request has been handled.
+func WithObserver(o Observer) Option {
+	return func(l *Logger) {
+		l.observers = append(l.observers, o)
+	}
 }
 
 // NewLogger creates a new AuthMiddleware with the given user session service.
-func NewLogger(svc string) *Logger {
+func NewLogger(svc string, opts ...Option) *Logger {
 	log.SetFlags(0)
 	logger := logrus.New()
 	logger.Formatter = &logrus.JSONFormatter{}
-	return &Logger{
-		name:   svc,
-		logger: logger,
-		before: DefaultBefore,
-		after:  DefaultAfter,
+	l := &Logger{
+		name:     svc,
+		logger:   logger,
+		before:   DefaultBefore,
+		after:    DefaultAfter,
+		redactor: DefaultRedactor(),
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
 // Handle print incoming request
@@ -40,39 +125,91 @@ func (l *Logger) Handle(next http.Handler) http.Handler {
 
 		entry := logrus.NewEntry(l.logger)
 		entry = l.before(entry, r, l.name)
+		entry = entry.WithField("client_ip", ClientIP(r, l.trustedProxies))
+
+		if l.bodyLimit > 0 {
+			entry = l.withRequestBody(entry, r)
+		}
 
 		entry.Info("starting request")
+		r = r.WithContext(NewContext(r.Context(), entry))
 
 		if r.Method == http.MethodOptions {
 			// router handles the OPTIONS request to obtain the list of allowed methods.
-			res := newResponseWriter(rw)
+			res := newResponseWriter(rw, 0)
 			next.ServeHTTP(res, r)
 			l.after(entry, res, start, l.name).Info("request completed")
 			return
 		}
 
-		res := newResponseWriter(rw)
+		res := newResponseWriter(rw, l.bodyLimit)
 		next.ServeHTTP(res, r)
+		for _, observe := range l.observers {
+			observe(r, res.Status(), res.BytesWritten(), time.Since(start))
+		}
 
-		l.after(entry, res, start, l.name).Info("request completed")
+		entry = l.after(entry, res, start, l.name)
+		if l.bodyLimit > 0 {
+			entry = entry.WithField("response_body", l.redactor.Body(res.Header().Get("Content-Type"), res.body.Bytes()))
+		}
+		entry.Info("request completed")
 	})
 }
 
+// withRequestBody adds the redacted request headers and body to the entry.
+// The captured bytes are put back so the next handler reads the whole body.
+func (l *Logger) withRequestBody(entry *logrus.Entry, r *http.Request) *logrus.Entry {
+	entry = entry.WithField("request_headers", l.redactor.Headers(r.Header))
+	if r.Body == nil || r.Body == http.NoBody {
+		return entry
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, int64(l.bodyLimit)))
+	if err != nil {
+		return entry.WithField("request_body_error", err.Error())
+	}
+	r.Body = &replayBody{
+		Reader: io.MultiReader(bytes.NewReader(body), r.Body),
+		Closer: r.Body,
+	}
+
+	return entry.WithField("request_body", l.redactor.Body(r.Header.Get("Content-Type"), body))
+}
+
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
 // DefaultBefore print log before request
 func DefaultBefore(entry *logrus.Entry, r *http.Request, name string) *logrus.Entry {
-	return entry.WithFields(logrus.Fields{
-		"service": name,
-		"method":  r.Method,
-		"URL":     r.URL.Path,
-	})
+	fields := logrus.Fields{
+		"service":    name,
+		"method":     r.Method,
+		"URL":        r.URL.Path,
+		"user_agent": r.UserAgent(),
+	}
+	if route := RouteFromContext(r.Context()); route != "" {
+		fields["route"] = route
+	}
+	if id := requestid.FromContext(r.Context()); id != "" {
+		fields["request_id"] = id
+	}
+	if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+		fields["trace_id"] = sc.TraceID().String()
+	}
+	return entry.WithFields(fields)
 }
 
 // DefaultAfter print log after request
 func DefaultAfter(entry *logrus.Entry, res *responseWriter, start time.Time, name string) *logrus.Entry {
+	took := time.Since(start)
 	return entry.WithFields(logrus.Fields{
 		"service":     name,
 		"status_code": res.Status(),
 		"status":      http.StatusText(res.Status()),
-		"took":        fmt.Sprintf("%.2fs", time.Since(start).Seconds()),
+		"bytes":       res.BytesWritten(),
+		"took":        fmt.Sprintf("%.2fs", took.Seconds()),
+		"latency_ms":  float64(took) / float64(time.Millisecond),
 	})
 }
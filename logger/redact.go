@@ -0,0 +1,178 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// RedactedValue replaces every masked value.
+const RedactedValue = "[REDACTED]"
+
+var (
+	// DefaultRedactedFields are the body fields masked by default. Plain
+	// names match at any depth while dotted paths match from the root.
+	DefaultRedactedFields = []string{
+		"pan",
+		"card_number",
+		"cvv",
+		// number and cvc of the expanded Stripe Issuing cards.
+		"number",
+		"cvc",
+		"password",
+		"verification_token",
+		"totp_code",
+		"secret",
+		"data.uri",
+	}
+
+	// DefaultRedactedHeaders are the headers masked by default.
+	DefaultRedactedHeaders = []string{"Authorization"}
+)
+
+// Redactor masks sensitive values in headers and bodies before they are
+// logged.
+type Redactor struct {
+	names   map[string]bool
+	paths   map[string]bool
+	headers map[string]bool
+}
+
+// NewRedactor creates a Redactor masking the given body fields and headers.
+// A field containing a dot is handled as a JSON path (a leading "$." is
+// allowed), arrays are transparent so "data.pan" matches the pan of every
+// element of data.
+func NewRedactor(fields, headers []string) *Redactor {
+	rd := &Redactor{
+		names:   make(map[string]bool),
+		paths:   make(map[string]bool),
+		headers: make(map[string]bool),
+	}
+
+	for _, f := range fields {
+		f = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(f), "$."))
+		if f == "" {
+			continue
+		}
+		if strings.Contains(f, ".") {
+			rd.paths[f] = true
+		} else {
+			rd.names[f] = true
+		}
+	}
+
+	for _, h := range headers {
+		if h = strings.TrimSpace(h); h != "" {
+			rd.headers[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+	return rd
+}
+
+// DefaultRedactor returns a Redactor masking the default fields and headers.
+func DefaultRedactor() *Redactor {
+	return NewRedactor(DefaultRedactedFields, DefaultRedactedHeaders)
+}
+
+// Headers returns a copy of h suitable for logging.
+func (rd *Redactor) Headers(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		if rd.headers[http.CanonicalHeaderKey(k)] {
+			out[k] = RedactedValue
+			continue
+		}
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+// Body returns a representation of body suitable for logging. JSON and form
+// encoded bodies are decoded and masked, anything else, including JSON cut
+// at the body limit, is replaced by a placeholder with its size. JSON is
+// tried first whatever the content type, clients often send JSON without
+// setting it.
+func (rd *Redactor) Body(contentType string, body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	if v, ok := rd.mask(contentType, body); ok {
+		return v
+	}
+	return fmt.Sprintf("[UNPARSEABLE BODY, %d bytes]", len(body))
+}
+
+// Redact returns body in its own encoding with the sensitive fields masked,
+// for bodies written to disk rather than logged. Digit runs as long as PANs
+// are masked in the bodies neither JSON nor form encoded.
+func (rd *Redactor) Redact(contentType string, body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	v, ok := rd.mask(contentType, body)
+	if !ok {
+		return panPattern.ReplaceAll(body, []byte(RedactedValue))
+	}
+	if values, ok := v.(url.Values); ok {
+		return []byte(values.Encode())
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return panPattern.ReplaceAll(body, []byte(RedactedValue))
+	}
+	return b
+}
+
+// panPattern matches the digit runs that could be PANs.
+var panPattern = regexp.MustCompile(`\d{13,19}`)
+
+// mask decodes a JSON or form encoded body and masks its sensitive fields,
+// it returns false when body is neither.
+func (rd *Redactor) mask(contentType string, body []byte) (interface{}, bool) {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err == nil {
+		return rd.walk(v, ""), true
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/x-www-form-urlencoded" {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			for k := range values {
+				if rd.match(k, strings.ToLower(k)) {
+					values[k] = []string{RedactedValue}
+				}
+			}
+			return values, true
+		}
+	}
+	return nil, false
+}
+
+func (rd *Redactor) walk(v interface{}, path string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			p := strings.ToLower(k)
+			if path != "" {
+				p = path + "." + p
+			}
+			if rd.match(k, p) {
+				t[k] = RedactedValue
+				continue
+			}
+			t[k] = rd.walk(child, p)
+		}
+	case []interface{}:
+		for i, child := range t {
+			t[i] = rd.walk(child, path)
+		}
+	}
+	return v
+}
+
+func (rd *Redactor) match(name, path string) bool {
+	return rd.names[strings.ToLower(name)] || rd.paths[path]
+}
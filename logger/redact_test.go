@@ -0,0 +1,98 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedactorBodyJSON(t *testing.T) {
+	rd := NewRedactor([]string{"pan", "$.data.uri"}, nil)
+	body := `{"id": "c1", "PAN": "5432123412341234", "data": {"uri": "otpauth://x", "pan": "1"}, "cards": [{"pan": "2", "id": "c2"}], "uri": "kept"}`
+
+	got := rd.Body("application/json", []byte(body))
+	want := map[string]interface{}{
+		"id":    "c1",
+		"PAN":   RedactedValue,
+		"data":  map[string]interface{}{"uri": RedactedValue, "pan": RedactedValue},
+		"cards": []interface{}{map[string]interface{}{"pan": RedactedValue, "id": "c2"}},
+		"uri":   "kept",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Body = %v, want %v", got, want)
+	}
+}
+
+func TestRedactorBodyForm(t *testing.T) {
+	rd := DefaultRedactor()
+	body := "number=4242424242424242&cvc=123&name=Jo"
+
+	got, ok := rd.Body("application/x-www-form-urlencoded; charset=utf-8", []byte(body)).(url.Values)
+	if !ok {
+		t.Fatalf("Body = %T, want url.Values", got)
+	}
+	want := url.Values{"number": {RedactedValue}, "cvc": {RedactedValue}, "name": {"Jo"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Body = %v, want %v", got, want)
+	}
+}
+
+func TestRedactorBodyUnparseable(t *testing.T) {
+	rd := DefaultRedactor()
+	// JSON cut at the body limit isn't logged raw.
+	body := `{"pan": "5432123412341234", "cv`
+	got := rd.Body("application/json", []byte(body))
+	if s, ok := got.(string); !ok || strings.Contains(s, "5432") {
+		t.Errorf("Body = %v, want a placeholder", got)
+	}
+	if got := rd.Body("", nil); got != nil {
+		t.Errorf("Body of an empty body = %v, want nil", got)
+	}
+}
+
+func TestRedactorRedact(t *testing.T) {
+	rd := DefaultRedactor()
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(rd.Redact("application/json", []byte(`{"card_number": "5432123412341234", "id": "c1"}`)), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["card_number"] != RedactedValue || got["id"] != "c1" {
+		t.Errorf("Redact = %v", got)
+	}
+
+	form := rd.Redact("application/x-www-form-urlencoded", []byte("number=4242424242424242&name=Jo"))
+	values, err := url.ParseQuery(string(form))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values.Get("number") != RedactedValue || values.Get("name") != "Jo" {
+		t.Errorf("Redact = %s", form)
+	}
+
+	plain := rd.Redact("text/plain", []byte("card 5432123412341234 id 42"))
+	if string(plain) != "card "+RedactedValue+" id 42" {
+		t.Errorf("Redact = %s", plain)
+	}
+}
+
+func TestRedactorHeaders(t *testing.T) {
+	rd := NewRedactor(nil, []string{"authorization", "X-Api-Key"})
+	h := http.Header{}
+	h.Set("Authorization", "Bearer secret")
+	h.Set("X-Api-Key", "secret")
+	h.Add("Accept", "application/json")
+	h.Add("Accept", "text/plain")
+
+	want := map[string]string{
+		"Authorization": RedactedValue,
+		"X-Api-Key":     RedactedValue,
+		"Accept":        "application/json, text/plain",
+	}
+	if got := rd.Headers(h); !reflect.DeepEqual(got, want) {
+		t.Errorf("Headers = %v, want %v", got, want)
+	}
+}
@@ -1,18 +1,31 @@
 package logger
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
 	"net/http"
 )
 
-// responseWriter wraps a standard http.ResponseWriter
-// so we can store the status code.
+// responseWriter wraps a standard http.ResponseWriter so we can store the
+// status code, the number of bytes written and, optionally, the body.
+//
+// It implements http.Flusher, http.Hijacker and io.ReaderFrom by passing
+// the calls through to the wrapped writer, so streaming handlers keep
+// working when logged.
 type responseWriter struct {
 	http.ResponseWriter
 	status int
+	bytes  int64
+
+	body      bytes.Buffer
+	bodyLimit int
 }
 
-func newResponseWriter(rw http.ResponseWriter) *responseWriter {
-	return &responseWriter{rw, http.StatusOK}
+func newResponseWriter(rw http.ResponseWriter, bodyLimit int) *responseWriter {
+	return &responseWriter{ResponseWriter: rw, status: http.StatusOK, bodyLimit: bodyLimit}
 }
 
 // WriteHeader ...
@@ -23,6 +36,63 @@ func (rw *responseWriter) WriteHeader(statusCode int) {
 	rw.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Write captures up to bodyLimit bytes of the body before writing it onward.
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if n := rw.bodyLimit - rw.body.Len(); n > 0 {
+		if n > len(b) {
+			n = len(b)
+		}
+		rw.body.Write(b[:n])
+	}
+
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom uses the io.ReaderFrom of the wrapped writer when available and
+// the body doesn't have to be captured.
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok && rw.bodyLimit == 0 {
+		n, err := rf.ReadFrom(src)
+		rw.bytes += n
+		return n, err
+	}
+	return io.Copy(writerOnly{rw}, src)
+}
+
+// Flush sends any buffered data to the client.
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("logger: response writer does not implement http.Hijacker")
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the wrapped writer, used by http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (rw *responseWriter) Status() int {
 	return rw.status
 }
+
+// BytesWritten returns the number of body bytes written.
+func (rw *responseWriter) BytesWritten() int64 {
+	return rw.bytes
+}
+
+// writerOnly hides the io.ReaderFrom implementation of a writer so io.Copy
+// doesn't call it back.
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,18 @@
+package logger
+
+import "context"
+
+type routeContextKey struct{}
+
+// WithRoute returns a copy of ctx carrying the route template, e.g.
+// /cards/:id/info, matched by the router.
+func WithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeContextKey{}, route)
+}
+
+// RouteFromContext returns the route template stored in ctx, or an empty
+// string.
+func RouteFromContext(ctx context.Context) string {
+	route, _ := ctx.Value(routeContextKey{}).(string)
+	return route
+}
@@ -0,0 +1,118 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rodrwan/fakeproviders/logger"
+)
+
+// Recorder is a reverse proxy appending every exchange with the target to a
+// cassette file.
+type Recorder struct {
+	proxy    *httputil.ReverseProxy
+	redactor *logger.Redactor
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	f   *os.File
+}
+
+type recordedRequestKey struct{}
+
+// recordedRequest is what the proxied request looked like before being
+// rewritten for the target.
+type recordedRequest struct {
+	uri  string
+	body []byte
+}
+
+// NewRecorder returns a Recorder proxying to target. The exchanges are
+// appended to the cassette at path, which is created when missing, their
+// bodies masked by rd, logger.DefaultRedactor when nil.
+func NewRecorder(target *url.URL, path string, rd *logger.Redactor) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if rd == nil {
+		rd = logger.DefaultRedactor()
+	}
+	rec := &Recorder{
+		redactor: rd,
+		enc:      json.NewEncoder(f),
+		f:        f,
+	}
+	rec.proxy = httputil.NewSingleHostReverseProxy(target)
+	director := rec.proxy.Director
+	rec.proxy.Director = func(r *http.Request) {
+		director(r)
+		// the target checks the host, not the one the proxy was called with.
+		r.Host = target.Host
+		// the transport then asks for and decompresses gzip bodies itself, so
+		// the cassette only holds plain bodies.
+		r.Header.Del("Accept-Encoding")
+	}
+	rec.proxy.ModifyResponse = rec.record
+	return rec, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (rec *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	ctx := context.WithValue(r.Context(), recordedRequestKey{}, &recordedRequest{
+		uri:  r.URL.RequestURI(),
+		body: body,
+	})
+	rec.proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (rec *Recorder) record(resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	r := resp.Request
+	orig, ok := r.Context().Value(recordedRequestKey{}).(*recordedRequest)
+	if !ok {
+		orig = &recordedRequest{uri: r.URL.RequestURI()}
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.enc.Encode(&Exchange{
+		Method:         r.Method,
+		URI:            orig.uri,
+		RequestHeader:  cleanHeader(r.Header),
+		RequestBody:    encodeBody(rec.redactor.Redact(r.Header.Get("Content-Type"), orig.body)),
+		Status:         resp.StatusCode,
+		ResponseHeader: cleanHeader(resp.Header),
+		ResponseBody:   encodeBody(rec.redactor.Redact(resp.Header.Get("Content-Type"), body)),
+		RecordedAt:     time.Now().UTC(),
+	})
+}
+
+// Close closes the cassette file.
+func (rec *Recorder) Close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.f.Close()
+}
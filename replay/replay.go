@@ -0,0 +1,190 @@
+// Package replay records the exchanges of a reverse proxy to a cassette file
+// and serves them back offline.
+//
+// A cassette holds one JSON encoded Exchange per line, in the order they were
+// recorded. A Replayer matches requests by method, path and body, JSON bodies
+// being compared regardless of the order of their fields.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	apierror "github.com/rodrwan/fakeproviders/api-error"
+	"github.com/rodrwan/fakeproviders/logger"
+)
+
+// Exchange is a recorded request and its response.
+type Exchange struct {
+	Method string `json:"method"`
+	// URI is the path and query of the request.
+	URI            string          `json:"uri"`
+	RequestHeader  http.Header     `json:"request_header,omitempty"`
+	RequestBody    json.RawMessage `json:"request_body,omitempty"`
+	Status         int             `json:"status"`
+	ResponseHeader http.Header     `json:"response_header,omitempty"`
+	ResponseBody   json.RawMessage `json:"response_body,omitempty"`
+	RecordedAt     time.Time       `json:"recorded_at"`
+}
+
+// skippedHeaders are neither recorded nor replayed, either because they hold
+// credentials or because they are set for each response.
+var skippedHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"Content-Length",
+	"Date",
+	"X-Request-Id",
+}
+
+func cleanHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, k := range skippedHeaders {
+		h.Del(k)
+	}
+	return h
+}
+
+// encodeBody keeps JSON bodies as they are, any other body is stored as a
+// JSON string.
+func encodeBody(b []byte) json.RawMessage {
+	if len(b) == 0 {
+		return nil
+	}
+	if json.Valid(b) {
+		return json.RawMessage(b)
+	}
+	s, _ := json.Marshal(string(b))
+	return json.RawMessage(s)
+}
+
+// decodeBody reverts encodeBody.
+func decodeBody(raw json.RawMessage, header http.Header) []byte {
+	var s string
+	if len(raw) > 0 && raw[0] == '"' && !isJSON(header) {
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return []byte(s)
+		}
+	}
+	return raw
+}
+
+func isJSON(h http.Header) bool {
+	return bytes.Contains([]byte(h.Get("Content-Type")), []byte("json"))
+}
+
+// canonicalBody returns a comparable form of a body, JSON values are
+// re-encoded so the order of the object fields doesn't matter.
+func canonicalBody(b []byte) string {
+	b = bytes.TrimSpace(b)
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return string(b)
+	}
+	c, _ := json.Marshal(v)
+	return string(c)
+}
+
+// LoadCassette reads the exchanges recorded in a cassette file.
+func LoadCassette(path string) ([]Exchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var exchanges []Exchange
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var e Exchange
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		exchanges = append(exchanges, e)
+	}
+	return exchanges, sc.Err()
+}
+
+// Replayer serves recorded exchanges. When a request was recorded several
+// times the responses are served in order, the last one being repeated.
+type Replayer struct {
+	redactor *logger.Redactor
+
+	mu        sync.Mutex
+	exchanges map[string][]Exchange
+	served    map[string]int
+}
+
+// NewReplayer returns a Replayer of the given exchanges. The requests are
+// masked by rd, logger.DefaultRedactor when nil, before being matched, like
+// the recorded ones were.
+func NewReplayer(exchanges []Exchange, rd *logger.Redactor) *Replayer {
+	if rd == nil {
+		rd = logger.DefaultRedactor()
+	}
+	rp := &Replayer{
+		redactor:  rd,
+		exchanges: make(map[string][]Exchange),
+		served:    make(map[string]int),
+	}
+	for _, e := range exchanges {
+		k := matchKey(e.Method, e.URI, decodeBody(e.RequestBody, e.RequestHeader))
+		rp.exchanges[k] = append(rp.exchanges[k], e)
+	}
+	return rp
+}
+
+func matchKey(method, uri string, body []byte) string {
+	return method + " " + uri + "\n" + canonicalBody(body)
+}
+
+func (rp *Replayer) next(k string) (Exchange, bool) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	recorded := rp.exchanges[k]
+	if len(recorded) == 0 {
+		return Exchange{}, false
+	}
+	n := rp.served[k]
+	if n < len(recorded)-1 {
+		rp.served[k] = n + 1
+	}
+	return recorded[n], true
+}
+
+// ServeHTTP implements http.Handler. Requests that were not recorded get a
+// 404.
+func (rp *Replayer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		apierror.NewError(err.Error(), http.StatusBadRequest).Write(w)
+		return
+	}
+
+	body = rp.redactor.Redact(r.Header.Get("Content-Type"), body)
+	e, ok := rp.next(matchKey(r.Method, r.URL.RequestURI(), body))
+	if !ok {
+		msg := fmt.Sprintf("no recorded exchange for %s %s", r.Method, r.URL.RequestURI())
+		apierror.NewError(msg, http.StatusNotFound).Write(w)
+		return
+	}
+
+	for k, v := range cleanHeader(e.ResponseHeader) {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(e.Status)
+	w.Write(decodeBody(e.ResponseBody, e.ResponseHeader))
+}
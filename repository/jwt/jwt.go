@@ -51,12 +51,16 @@ type Session struct {
 
 // NewSession creates a new user session.
 func NewSession(username, uuid, origin string) (*Session, error) {
+	return NewSessionAt(username, uuid, origin, time.Now())
+}
+
+// NewSessionAt creates a new user session issued at iat.
+func NewSessionAt(username, uuid, origin string, iat time.Time) (*Session, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
 		return nil, err
 	}
 
-	iat := time.Now()
 	id := base64.StdEncoding.EncodeToString(b)
 
 	return &Session{
@@ -89,6 +93,16 @@ func (sc *sessionClaims) Session() *Session {
 type SessionService struct {
 	SecretKey []byte
 	MaxAge    time.Duration
+	// Now returns the time tokens are issued and validated at, defaults to
+	// time.Now.
+	Now func() time.Time
+}
+
+func (uss *SessionService) now() time.Time {
+	if uss.Now != nil {
+		return uss.Now()
+	}
+	return time.Now()
 }
 
 // Session validates and returns the user session associated with the given
@@ -117,7 +131,7 @@ func (uss *SessionService) RefreshSession(ctx context.Context, c *SessionCredent
 	}
 
 	s := authClaims.Session()
-	s.UpdatedAt = time.Now()
+	s.UpdatedAt = uss.now()
 	return s, nil
 }
 
@@ -151,7 +165,7 @@ func (uss *SessionService) sessionCredentials(us *Session) (*SessionCredentials,
 		return nil, err
 	}
 
-	iat := time.Now()
+	iat := uss.now()
 	exp := iat.Add(uss.MaxAge)
 	stdClms := jwt.StandardClaims{
 		Id:        id,
@@ -217,7 +231,10 @@ func (uss *SessionService) parseTokens(authToken string) (*sessionClaims, error)
 func (uss *SessionService) tokenClaims(tokenStr string) (*sessionClaims, error) {
 	claims := &sessionClaims{}
 	tkn := strings.TrimSpace(tokenStr)
-	token, err := jwt.ParseWithClaims(tkn, claims, uss.verifySigningMethod)
+	// the time claims are checked against uss.now instead of the global
+	// jwt.TimeFunc.
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.ParseWithClaims(tkn, claims, uss.verifySigningMethod)
 	if err != nil {
 		return nil, err
 	}
@@ -226,7 +243,32 @@ func (uss *SessionService) tokenClaims(tokenStr string) (*sessionClaims, error)
 		claims = c
 	}
 
-	return claims, nil
+	return claims, uss.validateTime(claims)
+}
+
+// validateTime checks the exp, iat and nbf claims, the returned claims are
+// still usable when the token only expired.
+func (uss *SessionService) validateTime(c *sessionClaims) error {
+	now := uss.now().Unix()
+	vErr := &jwt.ValidationError{}
+
+	if !c.VerifyExpiresAt(now, false) {
+		vErr.Inner = errors.New("Token is expired")
+		vErr.Errors |= jwt.ValidationErrorExpired
+	}
+	if !c.VerifyIssuedAt(now, false) {
+		vErr.Inner = errors.New("Token used before issued")
+		vErr.Errors |= jwt.ValidationErrorIssuedAt
+	}
+	if !c.VerifyNotBefore(now, false) {
+		vErr.Inner = errors.New("Token is not valid yet")
+		vErr.Errors |= jwt.ValidationErrorNotValidYet
+	}
+
+	if vErr.Errors == 0 {
+		return nil
+	}
+	return vErr
 }
 
 func isTokenExpired(err error) bool {
@@ -0,0 +1,57 @@
+// Package requestid provides a middleware that assigns every incoming request
+// an identifier, so a request, its log lines and its error response can be
+// correlated.
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// HeaderKey is the header used to receive and echo the request id.
+const HeaderKey = "X-Request-ID"
+
+// maxLength bounds the length of a client supplied request id.
+const maxLength = 128
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the given request id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request id stored in ctx, or an empty string.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Handle reuses the X-Request-ID sent by the client, or generates a new one,
+// stores it in the request context and echoes it back as a response header.
+func Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderKey)
+		if !valid(id) {
+			id = uuid.New().String()
+		}
+
+		w.Header().Set(HeaderKey, id)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// valid reports whether id is safe to log and echo back.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
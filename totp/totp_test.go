@@ -0,0 +1,86 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 secret of the test vectors of RFC 6238 appendix B.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCodeRFC6238(t *testing.T) {
+	// the RFC lists 8 digit codes, the 6 digit ones are their last digits.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := Code(rfcSecret, time.Unix(tt.unix, 0)); got != tt.code {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code := Code(rfcSecret, now)
+
+	step, ok := Validate(rfcSecret, code, now, 0)
+	if !ok || step != Step(now) {
+		t.Errorf("Validate = %d, %v, want %d, true", step, ok, Step(now))
+	}
+
+	later := now.Add(Period)
+	if _, ok := Validate(rfcSecret, code, later, 0); ok {
+		t.Error("accepted the code of the previous step without skew")
+	}
+	if step, ok := Validate(rfcSecret, code, later, 1); !ok || step != Step(now) {
+		t.Errorf("Validate with skew = %d, %v, want %d, true", step, ok, Step(now))
+	}
+
+	for _, code := range []string{"", "12345", "1234567", "000000"} {
+		if _, ok := Validate(rfcSecret, code, now, 1); ok {
+			t.Errorf("accepted %q", code)
+		}
+	}
+}
+
+func TestSecretEncoding(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := EncodeSecret(secret)
+	for _, s := range []string{encoded, encoded + "====", strings.ToLower(encoded)} {
+		got, err := DecodeSecret(s)
+		if err != nil {
+			t.Fatalf("DecodeSecret(%q): %v", s, err)
+		}
+		if string(got) != string(secret) {
+			t.Errorf("DecodeSecret(%q) = %x, want %x", s, got, secret)
+		}
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("fakeprovider", "lala@example.org", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/fakeprovider:lala@example.org" {
+		t.Errorf("URI = %s", u)
+	}
+	q := u.Query()
+	if q.Get("secret") != EncodeSecret(rfcSecret) || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("query = %v", q)
+	}
+}
@@ -0,0 +1,263 @@
+// Package vault implements field level envelope encryption.
+//
+// Every record is sealed with its own random data key, the data key itself is
+// stored next to the ciphertexts wrapped (encrypted) by one of the
+// key-encryption keys (KEK) held by a Keyring. Rotating the KEK only requires
+// re-wrapping the data keys, the fields are never re-encrypted.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// KeySize is the size in bytes of both key-encryption and data keys (AES-256).
+const KeySize = 32
+
+var (
+	// ErrUnknownKey is returned when an envelope was wrapped by a KEK that is
+	// not part of the keyring.
+	ErrUnknownKey = errors.New("vault: unknown key-encryption key")
+	// ErrNoPrimaryKey is returned when sealing with an empty keyring.
+	ErrNoPrimaryKey = errors.New("vault: keyring has no primary key")
+	// ErrPrimaryKey is returned when removing the primary key.
+	ErrPrimaryKey = errors.New("vault: the primary key can't be removed")
+)
+
+// Envelope holds a set of encrypted fields and the wrapped data key needed to
+// decrypt them.
+type Envelope struct {
+	KeyID      string            `json:"key_id"`
+	WrappedKey []byte            `json:"wrapped_key"`
+	Fields     map[string][]byte `json:"fields"`
+}
+
+// Keyring holds the key-encryption keys indexed by id. New envelopes are
+// always wrapped by the primary key, the others are kept to open envelopes
+// that have not been re-wrapped yet.
+type Keyring struct {
+	mu      sync.RWMutex
+	primary string
+	keys    map[string][]byte
+}
+
+// NewKeyring returns an empty keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string][]byte)}
+}
+
+// ParseKeyring parses a comma separated list of id:base64-key pairs, the first
+// one becomes the primary key.
+func ParseKeyring(spec string) (*Keyring, error) {
+	kr := NewKeyring()
+	for i, pair := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("vault: invalid key %q, expected id:base64-key", pair)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("vault: invalid key %q: %v", parts[0], err)
+		}
+
+		if err := kr.Add(parts[0], key, i == 0); err != nil {
+			return nil, err
+		}
+	}
+	return kr, nil
+}
+
+// NewKey returns a new random key suitable as a KEK.
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Add adds a key-encryption key to the keyring, optionally making it the
+// primary key.
+func (kr *Keyring) Add(id string, key []byte, primary bool) error {
+	if id == "" {
+		return errors.New("vault: key id is required")
+	}
+	if len(key) != KeySize {
+		return fmt.Errorf("vault: key %q must be %d bytes long", id, KeySize)
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if _, ok := kr.keys[id]; ok {
+		return fmt.Errorf("vault: key %q already exists", id)
+	}
+	kr.keys[id] = key
+	if primary || kr.primary == "" {
+		kr.primary = id
+	}
+	return nil
+}
+
+// Remove drops a key-encryption key that is not the primary one, the
+// envelopes it wraps can't be opened anymore.
+func (kr *Keyring) Remove(id string) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if _, ok := kr.keys[id]; !ok {
+		return ErrUnknownKey
+	}
+	if id == kr.primary {
+		return ErrPrimaryKey
+	}
+	delete(kr.keys, id)
+	return nil
+}
+
+// Primary returns the id of the primary key.
+func (kr *Keyring) Primary() string {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.primary
+}
+
+// Seal encrypts the given fields with a new data key wrapped by the primary
+// key.
+func (kr *Keyring) Seal(fields map[string]string) (*Envelope, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+
+	kr.mu.RLock()
+	keyID, kek := kr.primary, kr.keys[kr.primary]
+	kr.mu.RUnlock()
+	if kek == nil {
+		return nil, ErrNoPrimaryKey
+	}
+
+	wrapped, err := encrypt(kek, dataKey, []byte(keyID))
+	if err != nil {
+		return nil, err
+	}
+
+	env := &Envelope{
+		KeyID:      keyID,
+		WrappedKey: wrapped,
+		Fields:     make(map[string][]byte, len(fields)),
+	}
+	for name, value := range fields {
+		ct, err := encrypt(dataKey, []byte(value), []byte(name))
+		if err != nil {
+			return nil, err
+		}
+		env.Fields[name] = ct
+	}
+	return env, nil
+}
+
+// Open decrypts every field of the envelope.
+func (kr *Keyring) Open(env *Envelope) (map[string]string, error) {
+	dataKey, err := kr.unwrap(env)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string, len(env.Fields))
+	for name, ct := range env.Fields {
+		pt, err := decrypt(dataKey, ct, []byte(name))
+		if err != nil {
+			return nil, fmt.Errorf("vault: could not decrypt field %q: %v", name, err)
+		}
+		fields[name] = string(pt)
+	}
+	return fields, nil
+}
+
+// Rewrap returns a copy of the envelope with its data key wrapped by the
+// primary key. The envelope is returned as is when it already is.
+func (kr *Keyring) Rewrap(env *Envelope) (*Envelope, error) {
+	kr.mu.RLock()
+	keyID, kek := kr.primary, kr.keys[kr.primary]
+	kr.mu.RUnlock()
+	if kek == nil {
+		return nil, ErrNoPrimaryKey
+	}
+	if env.KeyID == keyID {
+		return env, nil
+	}
+
+	dataKey, err := kr.unwrap(env)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := encrypt(kek, dataKey, []byte(keyID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		KeyID:      keyID,
+		WrappedKey: wrapped,
+		Fields:     env.Fields,
+	}, nil
+}
+
+func (kr *Keyring) unwrap(env *Envelope) ([]byte, error) {
+	kr.mu.RLock()
+	kek := kr.keys[env.KeyID]
+	kr.mu.RUnlock()
+	if kek == nil {
+		return nil, ErrUnknownKey
+	}
+
+	dataKey, err := decrypt(kek, env.WrappedKey, []byte(env.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("vault: could not unwrap data key: %v", err)
+	}
+	return dataKey, nil
+}
+
+// encrypt seals plaintext with AES-GCM, the random nonce is prepended to the
+// returned ciphertext.
+func encrypt(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func decrypt(key, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ct := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ct, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,153 @@
+package vault
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestKeyring(t *testing.T, ids ...string) *Keyring {
+	t.Helper()
+	kr := NewKeyring()
+	for _, id := range ids {
+		key, err := NewKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := kr.Add(id, key, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return kr
+}
+
+func TestSealOpen(t *testing.T) {
+	kr := newTestKeyring(t, "k1")
+	fields := map[string]string{"pan": "5432123412341234", "cvv": "123"}
+
+	env, err := kr.Seal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.KeyID != "k1" {
+		t.Errorf("key id = %q, want k1", env.KeyID)
+	}
+	if bytes.Contains(env.Fields["pan"], []byte(fields["pan"])) {
+		t.Error("the sealed pan holds the plaintext")
+	}
+
+	got, err := kr.Open(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range fields {
+		if got[name] != want {
+			t.Errorf("%s = %q, want %q", name, got[name], want)
+		}
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	kr := newTestKeyring(t, "k1")
+	env, err := kr.Seal(map[string]string{"cvv": "123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a field moved under another name doesn't open, the name is
+	// authenticated.
+	env.Fields["pan"] = env.Fields["cvv"]
+	delete(env.Fields, "cvv")
+	if _, err := kr.Open(env); err == nil {
+		t.Error("opened a renamed field")
+	}
+}
+
+func TestOpenUnknownKey(t *testing.T) {
+	env, err := newTestKeyring(t, "k1").Seal(map[string]string{"cvv": "123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestKeyring(t, "k2").Open(env); err != ErrUnknownKey {
+		t.Errorf("err = %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestSealWithoutKey(t *testing.T) {
+	if _, err := NewKeyring().Seal(map[string]string{"cvv": "123"}); err != ErrNoPrimaryKey {
+		t.Errorf("err = %v, want %v", err, ErrNoPrimaryKey)
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	kr := newTestKeyring(t, "k1")
+	env, err := kr.Seal(map[string]string{"pan": "5432123412341234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	same, err := kr.Rewrap(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same != env {
+		t.Error("an envelope of the primary key was re-wrapped")
+	}
+
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kr.Add("k2", key, true); err != nil {
+		t.Fatal(err)
+	}
+	rewrapped, err := kr.Rewrap(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewrapped.KeyID != "k2" {
+		t.Errorf("key id = %q, want k2", rewrapped.KeyID)
+	}
+	if !bytes.Equal(rewrapped.Fields["pan"], env.Fields["pan"]) {
+		t.Error("re-wrapping re-encrypted the fields")
+	}
+
+	if err := kr.Remove("k1"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := kr.Open(rewrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["pan"] != "5432123412341234" {
+		t.Errorf("pan = %q", got["pan"])
+	}
+	if _, err := kr.Open(env); err != ErrUnknownKey {
+		t.Errorf("opening with a removed key: err = %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestRemovePrimary(t *testing.T) {
+	kr := newTestKeyring(t, "k1")
+	if err := kr.Remove("k1"); err != ErrPrimaryKey {
+		t.Errorf("err = %v, want %v", err, ErrPrimaryKey)
+	}
+	if err := kr.Remove("k2"); err != ErrUnknownKey {
+		t.Errorf("err = %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	kr, err := ParseKeyring("k1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=,k2:AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kr.Primary() != "k1" {
+		t.Errorf("primary = %q, want k1", kr.Primary())
+	}
+
+	for _, spec := range []string{"", "k1", "k1:not base64", "k1:AAAA"} {
+		if _, err := ParseKeyring(spec); err == nil {
+			t.Errorf("ParseKeyring(%q) succeeded", spec)
+		}
+	}
+}